@@ -0,0 +1,273 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/charmbracelet/log"
+	"github.com/desertthunder/quotesky/lib/api"
+	"github.com/desertthunder/quotesky/lib/db"
+	"github.com/desertthunder/quotesky/lib/utils"
+	"github.com/urfave/cli/v2"
+)
+
+// App passwords are four groups of four characters, e.g. abcd-efgh-ijkl-mnop
+var appPassword = regexp.MustCompile(`^[a-z0-9]{4}(-[a-z0-9]{4}){3}$`)
+
+// Authenticates and stores an account, prompting for anything missing
+func addAccount(ctx *cli.Context) error {
+	if err := utils.LoadEnv(env_path); err != nil {
+		log.Warnf("continuing without %s", env_path)
+	}
+
+	h := ctx.String("handle")
+	pw := ctx.String("password")
+
+	if h == "" && interactive() {
+		var err error
+		h, err = prompt("Handle: ")
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if h == "" {
+		return fmt.Errorf("a handle is required")
+	}
+
+	if pw == "" && interactive() {
+		log.Info("create an app password under Settings > Privacy and security > App passwords")
+
+		var err error
+		pw, err = prompt(fmt.Sprintf("App password for %s: ", h))
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if pw == "" {
+		return fmt.Errorf("a password is required for %s", h)
+	}
+
+	if !appPassword.MatchString(pw) {
+		log.Warn("this doesn't look like an app password, consider creating one for the bot")
+	}
+
+	app := &db.App{Handle: h, Password: pw, Service: ctx.String("service")}
+	c := accountClient(app, "", false)
+	s, err := authenticate(ctx, c)
+
+	if err != nil {
+		return err
+	}
+
+	a, err := db.InitAppRepo(false)
+
+	if err != nil {
+		return err
+	}
+
+	if err := saveAccount(a, h, pw, c.Service, s, ctx.Bool("default")); err != nil {
+		return err
+	}
+
+	log.Infof("added %s (%s)", h, s.Did)
+
+	return nil
+}
+
+// Stores a signed in account with its session
+//
+// The account becomes the default when def is set or there's none yet.
+func saveAccount(
+	a *db.AppRepository, h string, pw string, service string, s *api.Session, def bool,
+) error {
+	if err := a.SaveAccount(h, pw, service); err != nil {
+		return err
+	}
+
+	err := a.SetSession(h, s.Did, s.GetServiceEndpoint(), s.AccessJwt, s.RefreshJwt)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = a.GetDefault()
+
+	if def || errors.Is(err, sql.ErrNoRows) {
+		return a.SetDefault(h)
+	}
+
+	return nil
+}
+
+func loginFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{Name: "handle", Usage: "account handle, prompted when omitted"},
+		&cli.StringFlag{Name: "password", Usage: "app password, prompted when omitted"},
+		&cli.BoolFlag{Name: "default", Usage: "make this the default account"},
+		serviceFlag(),
+		authFactorFlag(),
+	}
+}
+
+func listAccounts(ctx *cli.Context) error {
+	a, err := db.InitAppRepo(false)
+
+	if err != nil {
+		return err
+	}
+
+	apps, err := a.List()
+
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "\tHANDLE\tDID\tSERVICE\tREPLIES\tQUOTES")
+
+	for _, app := range apps {
+		marker := ""
+
+		if app.Default {
+			marker = "*"
+		}
+
+		replies, quotes := app.ReplyRules, "allowed"
+
+		if replies == "" {
+			replies = api.ReplyEveryone
+		}
+
+		if app.NoQuotes {
+			quotes = "disabled"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			marker, app.Handle, app.DID, app.Service, replies, quotes)
+	}
+
+	return w.Flush()
+}
+
+func removeAccount(ctx *cli.Context) error {
+	h := ctx.Args().First()
+
+	if h == "" {
+		return fmt.Errorf("usage: qsky accounts remove <handle>")
+	}
+
+	a, err := db.InitAppRepo(false)
+
+	if err != nil {
+		return err
+	}
+
+	if err := a.Remove(h); err != nil {
+		return err
+	}
+
+	log.Infof("removed %s", h)
+
+	return nil
+}
+
+// Sets who may reply to and quote an account's posts by default
+//
+// Passing neither flag opens replies and quotes up again.
+func gatesAccount(ctx *cli.Context) error {
+	a, err := db.InitAppRepo(false)
+
+	if err != nil {
+		return err
+	}
+
+	app, err := storedAccount(a, ctx.String("account"))
+
+	if err != nil {
+		return err
+	}
+
+	g := api.Gates{
+		Replies:  api.ParseReplyRules(ctx.String("replies")),
+		NoQuotes: ctx.Bool("no-quotes"),
+	}
+
+	if err := g.Validate(); err != nil {
+		return err
+	}
+
+	if err := a.SetGates(app.Handle, strings.Join(g.Replies, ","), g.NoQuotes); err != nil {
+		return err
+	}
+
+	log.Infof("updated interaction defaults for %s", app.Handle)
+
+	return nil
+}
+
+func defaultAccount(ctx *cli.Context) error {
+	h := ctx.Args().First()
+
+	if h == "" {
+		return fmt.Errorf("usage: qsky accounts default <handle>")
+	}
+
+	a, err := db.InitAppRepo(false)
+
+	if err != nil {
+		return err
+	}
+
+	if err := a.SetDefault(h); err != nil {
+		return err
+	}
+
+	log.Infof("%s is now the default account", h)
+
+	return nil
+}
+
+// accounts Command definition
+func Accounts() *cli.Command {
+	return &cli.Command{
+		Name:    "accounts",
+		Usage:   "manage the accounts messages can be posted as",
+		Aliases: []string{"a"},
+		Subcommands: []*cli.Command{
+			{
+				Name:   "add",
+				Usage:  "store and authenticate an account",
+				Flags:  loginFlags(),
+				Action: addAccount,
+			},
+			{Name: "list", Usage: "list stored accounts", Action: listAccounts},
+			{
+				Name:      "remove",
+				Usage:     "forget an account",
+				ArgsUsage: "<handle>",
+				Action:    removeAccount,
+			},
+			{
+				Name:   "gates",
+				Usage:  "set who may reply to and quote an account's posts by default",
+				Flags:  append(gateFlags(), accountFlag()),
+				Action: gatesAccount,
+			},
+			{
+				Name:      "default",
+				Usage:     "set the account used when messages don't name one",
+				ArgsUsage: "<handle>",
+				Action:    defaultAccount,
+			},
+		},
+	}
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/desertthunder/quotesky/lib/api"
+	"github.com/urfave/cli/v2"
+)
+
+// Emailed sign-in code for accounts with two-factor auth
+func authFactorFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "auth-factor-token",
+		Usage: "code emailed by your PDS when 2FA is enabled (or BLUESKY_AUTH_FACTOR_TOKEN)",
+	}
+}
+
+// Reports whether stdin is attached to a terminal
+func interactive() bool {
+	info, err := os.Stdin.Stat()
+
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// Reads a line of input after showing msg
+func prompt(msg string) (string, error) {
+	fmt.Fprint(os.Stderr, msg)
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(line), nil
+}
+
+// Creates a session, asking for the emailed code when the account needs one
+//
+// Non-interactive runs must pass the code with --auth-factor-token or
+// BLUESKY_AUTH_FACTOR_TOKEN.
+func authenticate(ctx *cli.Context, c *api.Client) (*api.Session, error) {
+	if t := ctx.String("auth-factor-token"); t != "" {
+		c.Credentials.AuthFactorToken = t
+	}
+
+	s, err := c.CreateSession(ctx.Context)
+
+	if !errors.Is(err, api.ErrAuthFactorTokenRequired) {
+		return s, err
+	}
+
+	if !interactive() {
+		log.Error("this account requires the code sent to its email address")
+		log.Error("pass it with --auth-factor-token or BLUESKY_AUTH_FACTOR_TOKEN")
+		return nil, err
+	}
+
+	log.Infof("%s has email two-factor auth enabled, check your inbox", c.Credentials.Handle)
+
+	token, err := prompt("Sign-in code: ")
+
+	if err != nil {
+		return nil, err
+	}
+
+	c.Credentials.AuthFactorToken = token
+
+	return c.CreateSession(ctx.Context)
+}
@@ -0,0 +1,264 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/desertthunder/quotesky/lib/api"
+	"github.com/desertthunder/quotesky/lib/db"
+	"github.com/desertthunder/quotesky/lib/utils"
+	"github.com/urfave/cli/v2"
+)
+
+// Repositories & blobs can take a while to download
+const backupTimeout time.Duration = 5 * time.Minute
+
+// Posts among a repository's records, ready to archive
+func archivePosts(did string, records []api.RepoRecord) ([]db.ArchivedPost, error) {
+	posts := []db.ArchivedPost{}
+
+	for _, r := range records {
+		if r.Collection != api.PostType {
+			continue
+		}
+
+		v, _ := r.Value.(map[string]any)
+		data, err := json.Marshal(api.JSONValue(v))
+
+		if err != nil {
+			return nil, err
+		}
+
+		p := db.ArchivedPost{
+			Account: did,
+			URI:     api.ATURI{Authority: did, Collection: r.Collection, Rkey: r.Rkey}.String(),
+			CID:     r.CID.String(),
+			Record:  string(data),
+		}
+		p.Text, _ = v["text"].(string)
+		p.PostedAt, _ = v["createdAt"].(string)
+
+		posts = append(posts, p)
+	}
+
+	return posts, nil
+}
+
+// Downloads the blobs records reference that aren't stored yet
+//
+// Returns the number of blobs fetched. Blobs the PDS no longer has are
+// skipped with a warning.
+func backupBlobs(
+	ctx context.Context, c *api.Client, r *db.BackupRepository, records []api.RepoRecord,
+) (int, error) {
+	seen := map[string]bool{}
+	n := 0
+
+	for _, rec := range records {
+		for _, cid := range api.BlobRefs(rec.Value) {
+			if seen[cid] {
+				continue
+			}
+
+			seen[cid] = true
+			stored, err := r.HasBlob(cid)
+
+			if err != nil {
+				return n, err
+			}
+
+			if stored {
+				continue
+			}
+
+			data, mime, err := c.GetBlob(ctx, c.Credentials.DID, cid)
+
+			if err != nil {
+				log.Warnf("unable to fetch blob %s: %s", cid, err.Error())
+				continue
+			}
+
+			b := db.Blob{CID: cid, Account: c.Credentials.DID, MimeType: mime, Data: data}
+
+			if err := r.SaveBlob(b); err != nil {
+				return n, err
+			}
+
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+func backup(ctx *cli.Context) error {
+	if err := utils.LoadEnv(env_path); err != nil {
+		log.Warnf("continuing without %s", env_path)
+	}
+
+	c, err := sessionClient(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	c.HTTP = &http.Client{Timeout: backupTimeout}
+	did := c.Credentials.DID
+	data, err := c.GetRepo(ctx.Context, did)
+
+	if err != nil {
+		return err
+	}
+
+	car, err := api.ReadCAR(bytes.NewReader(data))
+
+	if err != nil {
+		return err
+	}
+
+	commit, err := car.Commit()
+
+	if err != nil {
+		return err
+	}
+
+	if commit.DID != did {
+		return fmt.Errorf("downloaded the repo of %s instead of %s", commit.DID, did)
+	}
+
+	records, err := car.Records()
+
+	if err != nil {
+		return err
+	}
+
+	posts, err := archivePosts(did, records)
+
+	if err != nil {
+		return err
+	}
+
+	r := db.InitBackupRepo(false)
+	b := db.Backup{
+		Account: did,
+		Rev:     commit.Rev,
+		Commit:  car.Roots[0].String(),
+		CAR:     data,
+		Records: len(records),
+	}
+	id, err := r.Save(b, posts)
+
+	if err != nil {
+		return err
+	}
+
+	if out := ctx.String("out"); out != "" {
+		if err := os.WriteFile(out, data, 0o600); err != nil {
+			return err
+		}
+	}
+
+	blobs := 0
+
+	if !ctx.Bool("no-blobs") {
+		if blobs, err = backupBlobs(ctx.Context, c, r, records); err != nil {
+			return err
+		}
+	}
+
+	log.Infof("backup %d of %s at rev %s: %d records, %d posts, %d new blobs",
+		id, did, commit.Rev, len(records), len(posts), blobs)
+
+	return nil
+}
+
+func listBackups(ctx *cli.Context) error {
+	a, err := db.InitAppRepo(false)
+
+	if err != nil {
+		return err
+	}
+
+	app, err := storedAccount(a, ctx.String("account"))
+
+	if err != nil {
+		return err
+	}
+
+	backups, err := db.InitBackupRepo(false).List(app.DID)
+
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tREV\tRECORDS\tSIZE\tCREATED")
+
+	for _, b := range backups {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%d\t%s\n",
+			b.ID, b.Rev, b.Records, b.Size, b.CreatedAt.Local().Format(time.DateTime))
+	}
+
+	return w.Flush()
+}
+
+func exportBackup(ctx *cli.Context) error {
+	if ctx.NArg() != 1 || ctx.String("out") == "" {
+		return fmt.Errorf("usage: qsky backup export --out <file.car> <id>")
+	}
+
+	id, err := strconv.Atoi(ctx.Args().First())
+
+	if err != nil {
+		return fmt.Errorf("invalid backup id %s", ctx.Args().First())
+	}
+
+	car, err := db.InitBackupRepo(false).CAR(id)
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(ctx.String("out"), car, 0o600)
+}
+
+// backup Command definition
+func Backup() *cli.Command {
+	return &cli.Command{
+		Name:  "backup",
+		Usage: "download the account's repo and archive its posts & blobs",
+		Flags: []cli.Flag{
+			accountFlag(),
+			serviceFlag(),
+			authFactorFlag(),
+			&cli.StringFlag{Name: "out", Usage: "also write the CAR file here"},
+			&cli.BoolFlag{Name: "no-blobs", Usage: "skip downloading images & other blobs"},
+		},
+		Action: backup,
+		Subcommands: []*cli.Command{
+			{
+				Name:   "list",
+				Usage:  "list an account's backups",
+				Flags:  []cli.Flag{accountFlag()},
+				Action: listBackups,
+			},
+			{
+				Name:      "export",
+				Usage:     "write a stored backup's CAR file",
+				ArgsUsage: "<id>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "out", Usage: "file to write", Required: true},
+				},
+				Action: exportBackup,
+			},
+		},
+	}
+}
@@ -17,7 +17,10 @@ func Execute(p int) error {
 			log.Info("execute quotesky")
 			return nil
 		},
-		Commands: []*cli.Command{RunServer(p), Post(), Setup()},
+		Commands: append([]*cli.Command{
+			RunServer(p), Post(), Delete(), Setup(), Accounts(), Login(), Logout(), Whoami(),
+			Secrets(), Feed(), Blocklist(), Stats(), Profile(), Drafts(), Backup(),
+		}, Engagements()...),
 	}
 
 	return app.Run(os.Args)
@@ -0,0 +1,308 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/desertthunder/quotesky/lib/api"
+	"github.com/desertthunder/quotesky/lib/db"
+)
+
+const quotePrefix string = "QUOTE:"
+const draftPrefix string = "DRAFT:"
+
+// QUOTE:*, DRAFT:* and FOLLOW:/LIKE:/REPOST: protocol verbs
+//
+// Shared by the TCP server and the bots that answer mentions & messages.
+type Commands struct {
+	quotes   *db.QuoteRepository
+	history  *db.HistoryRepository
+	drafts   *db.DraftRepository
+	sessions *Sessions
+}
+
+// Commands constructor
+func NewCommands(s *Sessions, dbg bool) *Commands {
+	return &Commands{
+		quotes:   db.InitQuoteRepo(dbg),
+		history:  db.InitHistoryRepo(dbg),
+		drafts:   db.InitDraftRepo(dbg),
+		sessions: s,
+	}
+}
+
+// Posts m as account and records it in the history for engagement stats
+//
+// from carries the quote or draft the post was made from.
+func (c *Commands) publish(
+	ctx context.Context, account string, m api.Message, from db.HistoryPost,
+) (*api.PostResult, error) {
+	client, err := c.sessions.Client(ctx, account)
+
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := client.CreatePost(ctx, m)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Dry runs never posted, so they aren't history
+	if client.DryRun != nil {
+		return res, nil
+	}
+
+	from.Account = client.Credentials.DID
+	from.URI = res.URI
+	from.CID = res.CID
+	from.Text = m.Content
+	from.Tags = m.Hashtags
+	from.PostedAt = time.Now()
+
+	err = c.history.Record(from)
+
+	if err != nil {
+		client.Log.Warnf("unable to record %s in history: %s", res.URI, err.Error())
+	}
+
+	return res, nil
+}
+
+// Reports whether line is a protocol verb rather than a JSON message or text
+//
+// Verbs are upper case and end in or follow a colon, e.g. QUOTE:GET or LIKE:,
+// so text that merely starts with "like" isn't taken for one.
+func isCommand(line string) bool {
+	verb, _ := parseCommand(line)
+	_, ok := engagementVerb(verb)
+
+	return ok || strings.HasPrefix(verb, quotePrefix) || strings.HasPrefix(verb, draftPrefix)
+}
+
+// Splits "VERB args" into the verb and its trimmed arguments
+func parseCommand(line string) (string, string) {
+	verb, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+
+	return verb, strings.TrimSpace(arg)
+}
+
+// Parses "<text> [| <author>] [| <tag>,<tag>] [| <lang>,<lang>] [| <label>,<label>]"
+func ParseQuote(s string) (db.Quote, error) {
+	parts := strings.SplitN(s, "|", 5)
+	list := func(s string) []string {
+		return strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+
+	q := db.Quote{Text: strings.TrimSpace(parts[0])}
+
+	if q.Text == "" {
+		return q, errors.New("quote text is empty")
+	}
+
+	if len(parts) > 1 {
+		q.Author = strings.TrimSpace(parts[1])
+	}
+
+	if len(parts) > 2 {
+		q.Tags = list(parts[2])
+	}
+
+	if len(parts) > 3 {
+		q.Langs = list(parts[3])
+
+		if err := api.ValidateLangs(q.Langs); err != nil {
+			return q, err
+		}
+	}
+
+	if len(parts) > 4 {
+		q.Labels = list(parts[4])
+
+		if err := api.ValidateLabels(q.Labels); err != nil {
+			return q, err
+		}
+	}
+
+	return q, nil
+}
+
+// Parses "<id> <quote>"
+func parseID(s string) (int, string, error) {
+	raw, rest, _ := strings.Cut(s, " ")
+	id, err := strconv.Atoi(raw)
+
+	if err != nil {
+		return 0, "", fmt.Errorf("expected a quote id, got %q", raw)
+	}
+
+	return id, strings.TrimSpace(rest), nil
+}
+
+// Finds a random quote matching term
+func (c *Commands) find(term string) (*db.Quote, error) {
+	q, err := c.quotes.Random(term)
+
+	if errors.Is(err, sql.ErrNoRows) && term != "" {
+		return nil, fmt.Errorf("no quotes about %s", term)
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("no quotes yet")
+	}
+
+	return q, err
+}
+
+// Runs a single protocol line as account and returns the response body
+//
+// The empty account is the default. Engagements may name another after the
+// target, e.g. "LIKE: <post> | brand.bsky.social".
+func (c *Commands) Handle(ctx context.Context, account string, line string) (string, error) {
+	verb, arg := parseCommand(line)
+
+	if engage, ok := engagementVerb(verb); ok {
+		arg, as, _ := strings.Cut(arg, "|")
+		arg = strings.TrimSpace(arg)
+
+		if as = strings.TrimSpace(as); as != "" {
+			account = as
+		}
+
+		if arg == "" {
+			return "", fmt.Errorf("%s needs a target", verb)
+		}
+
+		client, err := c.sessions.Client(ctx, account)
+
+		if err != nil {
+			return "", err
+		}
+
+		uri, err := engage(*client, ctx, arg)
+
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("OK %s", uri), nil
+	}
+
+	switch verb {
+	case "QUOTE:GET":
+		q, err := c.find(arg)
+
+		if err != nil {
+			return "", err
+		}
+
+		return q.String(), nil
+	case "QUOTE:POST":
+		q, err := c.find(arg)
+
+		if err != nil {
+			return "", err
+		}
+
+		res, err := c.publish(ctx, account, quoteMessage(*q), db.HistoryPost{QuoteID: q.ID})
+
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("OK %s %s", res.URI, res.WebURL()), nil
+	case "QUOTE:LIST":
+		quotes, err := c.quotes.List()
+
+		if err != nil {
+			return "", err
+		}
+
+		lines := []string{}
+
+		for _, q := range quotes {
+			lines = append(lines, fmt.Sprintf("%d: %s", q.ID, q.String()))
+		}
+
+		return strings.Join(lines, "\n"), nil
+	case "QUOTE:ADD":
+		q, err := ParseQuote(arg)
+
+		if err != nil {
+			return "", err
+		}
+
+		id, err := c.quotes.Add(q)
+
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("OK %d", id), nil
+	case "DRAFT:ADD":
+		m, err := ParseDraft(arg)
+
+		if err != nil {
+			return "", err
+		}
+
+		id, err := saveDraft(c.drafts, m, "tcp")
+
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("OK %d", id), nil
+	case "QUOTE:REMOVE":
+		id, _, err := parseID(arg)
+
+		if err != nil {
+			return "", err
+		}
+
+		if err := c.quotes.Remove(id); err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("OK %d", id), nil
+	case "QUOTE:UPDATE":
+		id, rest, err := parseID(arg)
+
+		if err != nil {
+			return "", err
+		}
+
+		q, err := ParseQuote(rest)
+
+		if err != nil {
+			return "", err
+		}
+
+		q.ID = id
+
+		if err := c.quotes.Update(q); err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("OK %d", id), nil
+	}
+
+	return "", fmt.Errorf("unknown command %s", verb)
+}
+
+// Message posting quote q with its tags
+func quoteMessage(q db.Quote) api.Message {
+	tags := []string{}
+
+	for _, t := range q.Tags {
+		tags = append(tags, "#"+t)
+	}
+
+	return api.Message{Content: q.String(), Hashtags: tags, Langs: q.Langs, Labels: q.Labels}
+}
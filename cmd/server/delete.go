@@ -0,0 +1,48 @@
+package server
+
+import (
+	"github.com/charmbracelet/log"
+	"github.com/desertthunder/quotesky/lib/api"
+	"github.com/desertthunder/quotesky/lib/utils"
+	"github.com/urfave/cli/v2"
+)
+
+func Delete() *cli.Command {
+	return &cli.Command{
+		Name:    "delete",
+		Aliases: []string{"d"},
+		Usage:   "delete posts in batches",
+		Flags: []cli.Flag{
+			serviceFlag(),
+			authFactorFlag(),
+			&cli.StringSliceFlag{
+				Name:     "uri",
+				Aliases:  []string{"u"},
+				Usage:    "at-uri of a post to delete",
+				Required: true,
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			if err := utils.LoadEnv(env_path); err != nil {
+				return err
+			}
+
+			c := api.Init(ctx.String("service"), false)
+
+			if _, err := authenticate(ctx, c); err != nil {
+				return err
+			}
+
+			uris := ctx.StringSlice("uri")
+
+			if err := c.DeletePosts(ctx.Context, uris); err != nil {
+				log.Errorf("unable to delete posts: %s", err.Error())
+				return err
+			}
+
+			log.Infof("deleted %d posts", len(uris))
+
+			return nil
+		},
+	}
+}
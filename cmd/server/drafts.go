@@ -0,0 +1,443 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/charmbracelet/log"
+	"github.com/desertthunder/quotesky/lib/api"
+	"github.com/desertthunder/quotesky/lib/db"
+	"github.com/desertthunder/quotesky/lib/utils"
+	"github.com/urfave/cli/v2"
+)
+
+// Parses DRAFT:ADD arguments, a JSON message or plain text content
+func ParseDraft(arg string) (api.Message, error) {
+	m := api.Message{}
+
+	if !strings.HasPrefix(arg, "{") {
+		m.Content = arg
+	} else if err := json.Unmarshal([]byte(arg), &m); err != nil {
+		return m, err
+	}
+
+	if strings.TrimSpace(m.Content) == "" {
+		return m, fmt.Errorf("draft content is empty")
+	}
+
+	return m, validateMessage(m)
+}
+
+// Checks what CreatePost would reject, so bad drafts fail on submission
+func validateMessage(m api.Message) error {
+	if err := api.ValidateLangs(m.Langs); err != nil {
+		return err
+	}
+
+	if err := api.ValidateLabels(m.Labels); err != nil {
+		return err
+	}
+
+	if m.Gates != nil {
+		return m.Gates.Validate()
+	}
+
+	return nil
+}
+
+// Stores m as a pending draft
+func saveDraft(r *db.DraftRepository, m api.Message, source string) (int, error) {
+	data, err := json.Marshal(m)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return r.Add(m.Account, string(data), source)
+}
+
+func decodeDraft(d *db.Draft) (api.Message, error) {
+	m := api.Message{}
+
+	if err := json.Unmarshal([]byte(d.Message), &m); err != nil {
+		return m, fmt.Errorf("draft %d is unreadable: %w", d.ID, err)
+	}
+
+	return m, nil
+}
+
+// Posts a pending draft exactly as a direct message would be
+//
+// The record key is fixed and saved first, so publishing again after a
+// failure can't post the draft twice.
+func (c *Commands) PublishDraft(ctx context.Context, id int) (*api.PostResult, error) {
+	d, err := c.drafts.Get(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if d.Status != db.DraftPending {
+		return nil, fmt.Errorf("draft %d was already published as %s", id, d.URI)
+	}
+
+	m, err := decodeDraft(d)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if m.Rkey == "" {
+		m.Rkey = api.NewTID()
+		data, err := json.Marshal(m)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err := c.drafts.Update(id, d.Account, string(data)); err != nil {
+			return nil, err
+		}
+	}
+
+	res, err := c.publish(ctx, d.Account, m, db.HistoryPost{DraftID: id})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return res, c.drafts.Published(id, res.URI)
+}
+
+// Message from the post flags, starting from m
+func flagMessage(ctx *cli.Context, m api.Message) (api.Message, error) {
+	if ctx.IsSet("content") {
+		m.Content = ctx.String("content")
+	}
+
+	if ctx.IsSet("hashtags") {
+		m.Hashtags = []string{}
+
+		for _, h := range ctx.StringSlice("hashtags") {
+			m.Hashtags = append(m.Hashtags, "#"+strings.TrimPrefix(h, "#"))
+		}
+	}
+
+	if ctx.IsSet("lang") {
+		m.Langs = ctx.StringSlice("lang")
+	}
+
+	if ctx.IsSet("label") {
+		m.Labels = ctx.StringSlice("label")
+	}
+
+	if ctx.IsSet("account") {
+		m.Account = ctx.String("account")
+	}
+
+	gates, err := flagGates(ctx)
+
+	if err != nil {
+		return m, err
+	}
+
+	if gates != nil {
+		m.Gates = gates
+	}
+
+	return m, validateMessage(m)
+}
+
+func draftFlags() []cli.Flag {
+	return append([]cli.Flag{
+		&cli.StringFlag{Name: "content", Aliases: []string{"c"}, Usage: "the body of the post"},
+		&cli.StringSliceFlag{Name: "hashtags", Aliases: []string{"tags", "t"}},
+		&cli.StringSliceFlag{Name: "lang", Usage: "language tag, detected when omitted"},
+		&cli.StringSliceFlag{Name: "label", Usage: "self-label (content warning)"},
+		&cli.StringFlag{
+			Name:    "account",
+			Aliases: []string{"a"},
+			Usage:   "handle of the account to post as, the default when omitted",
+		},
+	}, gateFlags()...)
+}
+
+// Draft id from the only argument
+//
+// Flags have to come before it, anything after is rejected rather than
+// silently ignored.
+func draftID(ctx *cli.Context) (int, error) {
+	id, err := strconv.Atoi(ctx.Args().First())
+
+	if err != nil || ctx.NArg() != 1 {
+		return 0, fmt.Errorf("usage: qsky draft %s [flags] <id>", ctx.Command.Name)
+	}
+
+	return id, nil
+}
+
+// Opens the draft's JSON in $EDITOR and returns the edited message
+func editMessage(m api.Message) (api.Message, error) {
+	editor := os.Getenv("EDITOR")
+
+	if editor == "" {
+		editor = "vi"
+	}
+
+	f, err := os.CreateTemp("", "qsky-draft-*.json")
+
+	if err != nil {
+		return m, err
+	}
+
+	defer os.Remove(f.Name())
+
+	data, err := json.MarshalIndent(m, "", "  ")
+
+	if err != nil {
+		return m, err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		return m, err
+	}
+
+	f.Close()
+
+	cmd := exec.Command(editor, f.Name())
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return m, err
+	}
+
+	if data, err = os.ReadFile(f.Name()); err != nil {
+		return m, err
+	}
+
+	edited := api.Message{}
+
+	if err := json.Unmarshal(data, &edited); err != nil {
+		return m, err
+	}
+
+	return edited, validateMessage(edited)
+}
+
+func newDraft(ctx *cli.Context) error {
+	m, err := flagMessage(ctx, api.Message{})
+
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(m.Content) == "" {
+		return fmt.Errorf("--content is required")
+	}
+
+	id, err := saveDraft(db.InitDraftRepo(false), m, "cli")
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("OK %d\n", id)
+
+	return nil
+}
+
+func listDrafts(ctx *cli.Context) error {
+	drafts, err := db.InitDraftRepo(false).List(ctx.Bool("all"))
+
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATUS\tSOURCE\tACCOUNT\tCREATED\tCONTENT")
+
+	for _, d := range drafts {
+		m, err := decodeDraft(&d)
+
+		if err != nil {
+			return err
+		}
+
+		text := strings.Join(strings.Fields(m.Content), " ")
+
+		if r := []rune(text); len(r) > 50 {
+			text = string(r[:49]) + "…"
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n",
+			d.ID, d.Status, d.Source, d.Account, d.CreatedAt, text)
+	}
+
+	return w.Flush()
+}
+
+func showDraft(ctx *cli.Context) error {
+	id, err := draftID(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	d, err := db.InitDraftRepo(false).Get(id)
+
+	if err != nil {
+		return err
+	}
+
+	m, err := decodeDraft(d)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("draft %d, %s from %s at %s\n", d.ID, d.Status, d.Source, d.CreatedAt)
+
+	if d.URI != "" {
+		fmt.Printf("posted as %s\n", d.URI)
+	}
+
+	for i, p := range api.BuildThread(m, api.MaxPostLength) {
+		if i > 0 {
+			fmt.Println("---")
+		}
+
+		fmt.Printf("\n%s", p.Text)
+	}
+
+	return nil
+}
+
+// Edits a draft with the post flags, or in $EDITOR when none are passed
+func editDraft(ctx *cli.Context) error {
+	id, err := draftID(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	repo := db.InitDraftRepo(false)
+	d, err := repo.Get(id)
+
+	if err != nil {
+		return err
+	}
+
+	m, err := decodeDraft(d)
+
+	if err != nil {
+		return err
+	}
+
+	if ctx.NumFlags() == 0 {
+		m, err = editMessage(m)
+	} else {
+		m, err = flagMessage(ctx, m)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(m)
+
+	if err != nil {
+		return err
+	}
+
+	if err := repo.Update(id, m.Account, string(data)); err != nil {
+		return err
+	}
+
+	log.Infof("updated draft %d", id)
+
+	return nil
+}
+
+func publishDraft(ctx *cli.Context) error {
+	id, err := draftID(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if err := utils.LoadEnv(env_path); err != nil {
+		log.Warnf("continuing without %s", env_path)
+	}
+
+	s, err := NewSessions(ctx.String("service"), false)
+
+	if err != nil {
+		return err
+	}
+
+	res, err := NewCommands(s, false).PublishDraft(ctx.Context, id)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("OK %s %s\n", res.URI, res.WebURL())
+
+	return nil
+}
+
+func discardDraft(ctx *cli.Context) error {
+	id, err := draftID(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if err := db.InitDraftRepo(false).Discard(id); err != nil {
+		return err
+	}
+
+	log.Infof("discarded draft %d", id)
+
+	return nil
+}
+
+// draft Command definition
+func Drafts() *cli.Command {
+	return &cli.Command{
+		Name:  "draft",
+		Usage: "review messages before they are posted",
+		Subcommands: []*cli.Command{
+			{Name: "new", Usage: "save a draft", Flags: draftFlags(), Action: newDraft},
+			{
+				Name:   "list",
+				Usage:  "list pending drafts",
+				Flags:  []cli.Flag{&cli.BoolFlag{Name: "all", Usage: "include published drafts"}},
+				Action: listDrafts,
+			},
+			{Name: "show", Usage: "print a draft as it will be posted", ArgsUsage: "<id>",
+				Action: showDraft},
+			{
+				Name:      "edit",
+				Usage:     "change a draft with flags, or in $EDITOR without any",
+				ArgsUsage: "<id>",
+				Flags:     draftFlags(),
+				Action:    editDraft,
+			},
+			{
+				Name:      "publish",
+				Usage:     "post a draft",
+				ArgsUsage: "<id>",
+				Flags:     []cli.Flag{serviceFlag()},
+				Action:    publishDraft,
+			},
+			{Name: "discard", Usage: "delete a draft", ArgsUsage: "<id>", Action: discardDraft},
+		},
+	}
+}
@@ -0,0 +1,260 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/desertthunder/quotesky/lib/api"
+	"github.com/desertthunder/quotesky/lib/utils"
+	"github.com/urfave/cli/v2"
+)
+
+const feedPageSize int = 50
+
+// Row printed by qsky feed
+type FeedItem struct {
+	URI       string    `json:"uri"`
+	CID       string    `json:"cid"`
+	Author    string    `json:"author"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"createdAt"`
+	Likes     int       `json:"likes"`
+	Reposts   int       `json:"reposts"`
+	Replies   int       `json:"replies"`
+	Quotes    int       `json:"quotes"`
+	Reply     bool      `json:"reply"`
+	Repost    bool      `json:"repost"`
+}
+
+// Posts qsky feed asks for
+//
+// Since and Until bound when posts were created and are ignored when zero.
+type FeedQuery struct {
+	// Handle or DID, the client's own account when empty
+	Actor     string
+	NoReplies bool
+	NoReposts bool
+	Since     time.Time
+	Until     time.Time
+	Limit     int
+}
+
+// Accepts a date (2006-01-02) or an RFC 3339 timestamp
+func parseDate(s string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+
+	return time.Parse(time.RFC3339, s)
+}
+
+// Reads the feed flags
+func feedQuery(ctx *cli.Context) (FeedQuery, error) {
+	q := FeedQuery{
+		Actor:     ctx.String("actor"),
+		NoReplies: ctx.Bool("no-replies"),
+		NoReposts: ctx.Bool("no-reposts"),
+		Limit:     ctx.Int("limit"),
+	}
+
+	if s := ctx.String("since"); s != "" {
+		t, err := parseDate(s)
+
+		if err != nil {
+			return q, fmt.Errorf("invalid --since: %w", err)
+		}
+
+		q.Since = t
+	}
+
+	if s := ctx.String("until"); s != "" {
+		t, err := parseDate(s)
+
+		if err != nil {
+			return q, fmt.Errorf("invalid --until: %w", err)
+		}
+
+		q.Until = t
+	}
+
+	return q, nil
+}
+
+// Pages through the author feed until q.Limit matching posts are found
+func CollectFeed(ctx context.Context, c *api.Client, q FeedQuery) ([]FeedItem, error) {
+	since, until := q.Since, q.Until
+	actor := q.Actor
+
+	if actor == "" {
+		actor = c.Credentials.DID
+	}
+
+	filter := api.FilterPostsWithReplies
+
+	if q.NoReplies {
+		filter = api.FilterPostsNoReplies
+	}
+
+	items := []FeedItem{}
+	cursor := ""
+
+	for len(items) < q.Limit {
+		page, err := c.GetAuthorFeed(ctx, actor, filter, feedPageSize, cursor)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range page.Feed {
+			if f.IsRepost() && q.NoReposts {
+				continue
+			}
+
+			p, err := f.Post.Post()
+
+			if err != nil {
+				log.Warnf("skipping %s: %s", f.Post.URI, err.Error())
+				continue
+			}
+
+			created, err := p.CreatedAtTime()
+
+			if err != nil {
+				log.Warnf("skipping %s: %s", f.Post.URI, err.Error())
+				continue
+			}
+
+			// Reposts are ordered by when they were reposted, not created
+			if !since.IsZero() && created.Before(since) && !f.IsRepost() {
+				return items, nil
+			}
+
+			if (!since.IsZero() && created.Before(since)) ||
+				(!until.IsZero() && !created.Before(until)) {
+				continue
+			}
+
+			items = append(items, FeedItem{
+				URI:       f.Post.URI,
+				CID:       f.Post.CID,
+				Author:    f.Post.Author.Handle,
+				Text:      p.Text,
+				CreatedAt: created,
+				Likes:     f.Post.LikeCount,
+				Reposts:   f.Post.RepostCount,
+				Replies:   f.Post.ReplyCount,
+				Quotes:    f.Post.QuoteCount,
+				Reply:     f.IsReply(),
+				Repost:    f.IsRepost(),
+			})
+
+			if len(items) == q.Limit {
+				return items, nil
+			}
+		}
+
+		if page.Cursor == "" {
+			break
+		}
+
+		cursor = page.Cursor
+	}
+
+	return items, nil
+}
+
+func printFeed(items []FeedItem) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CREATED\tLIKES\tREPOSTS\tREPLIES\tKIND\tTEXT\tURI")
+
+	for _, i := range items {
+		kind := "post"
+
+		if i.Repost {
+			kind = "repost"
+		} else if i.Reply {
+			kind = "reply"
+		}
+
+		text := strings.Join(strings.Fields(i.Text), " ")
+
+		if r := []rune(text); len(r) > 50 {
+			text = string(r[:49]) + "…"
+		}
+
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\t%s\t%s\n",
+			i.CreatedAt.Local().Format("2006-01-02 15:04"),
+			i.Likes, i.Reposts, i.Replies, kind, text, i.URI)
+	}
+
+	return w.Flush()
+}
+
+// feed Command definition
+func Feed() *cli.Command {
+	return &cli.Command{
+		Name:  "feed",
+		Usage: "list what an account has posted",
+		Flags: []cli.Flag{
+			accountFlag(),
+			serviceFlag(),
+			authFactorFlag(),
+			&cli.StringFlag{
+				Name:  "actor",
+				Usage: "handle or did to read, the account itself when omitted",
+			},
+			&cli.IntFlag{Name: "limit", Aliases: []string{"n"}, Value: 25},
+			&cli.BoolFlag{Name: "no-replies", Usage: "hide replies"},
+			&cli.BoolFlag{Name: "no-reposts", Usage: "hide reposts"},
+			&cli.StringFlag{Name: "since", Usage: "only posts created on or after this date"},
+			&cli.StringFlag{Name: "until", Usage: "only posts created before this date"},
+			&cli.StringFlag{
+				Name:    "format",
+				Aliases: []string{"f"},
+				Value:   "table",
+				Usage:   "table or json",
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			if err := utils.LoadEnv(env_path); err != nil {
+				log.Warnf("continuing without %s", env_path)
+			}
+
+			q, err := feedQuery(ctx)
+
+			if err != nil {
+				return err
+			}
+
+			c, err := sessionClient(ctx)
+
+			if err != nil {
+				return err
+			}
+
+			items, err := CollectFeed(ctx.Context, c, q)
+
+			if err != nil {
+				return err
+			}
+
+			switch ctx.String("format") {
+			case "json":
+				e := json.NewEncoder(os.Stdout)
+				e.SetIndent("", "  ")
+
+				return e.Encode(items)
+			case "table":
+				return printFeed(items)
+			}
+
+			return fmt.Errorf("unknown format %s", ctx.String("format"))
+		},
+	}
+}
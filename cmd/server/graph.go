@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/desertthunder/quotesky/lib/api"
+	"github.com/desertthunder/quotesky/lib/utils"
+	"github.com/urfave/cli/v2"
+)
+
+// Follow, like & repost writes by verb
+//
+// Each takes a handle, did or post uri and returns the record it touched.
+var engagements = map[string]func(api.Client, context.Context, string) (string, error){
+	"follow":   api.Client.Follow,
+	"unfollow": api.Client.Unfollow,
+	"like":     api.Client.Like,
+	"unlike":   api.Client.Unlike,
+	"repost":   api.Client.Repost,
+	"unrepost": api.Client.Unrepost,
+}
+
+// Engagement behind a protocol verb, e.g. LIKE:
+func engagementVerb(verb string) (func(api.Client, context.Context, string) (string, error), bool) {
+	name, ok := strings.CutSuffix(verb, ":")
+
+	if !ok || name != strings.ToUpper(name) {
+		return nil, false
+	}
+
+	engage, ok := engagements[strings.ToLower(name)]
+
+	return engage, ok
+}
+
+// Runs an engagement verb against each target
+func engage(ctx *cli.Context, verb string) error {
+	if ctx.NArg() == 0 {
+		return fmt.Errorf("%s needs at least one target", verb)
+	}
+
+	if err := utils.LoadEnv(env_path); err != nil {
+		log.Warnf("continuing without %s", env_path)
+	}
+
+	c, err := sessionClient(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	for _, target := range ctx.Args().Slice() {
+		uri, err := engagements[verb](*c, ctx.Context, target)
+
+		if err != nil {
+			return fmt.Errorf("unable to %s %s: %w", verb, target, err)
+		}
+
+		fmt.Printf("OK %s\n", uri)
+	}
+
+	return nil
+}
+
+// Engagement Command definition
+func engagementCommand(verb string, usage string, args string) *cli.Command {
+	return &cli.Command{
+		Name:      verb,
+		Usage:     usage,
+		ArgsUsage: args,
+		Flags:     []cli.Flag{accountFlag(), serviceFlag(), authFactorFlag()},
+		Action: func(ctx *cli.Context) error {
+			return engage(ctx, verb)
+		},
+	}
+}
+
+func Engagements() []*cli.Command {
+	actors := "<handle|did> ..."
+	posts := "<at-uri|bsky.app link> ..."
+
+	return []*cli.Command{
+		engagementCommand("follow", "follow accounts", actors),
+		engagementCommand("unfollow", "unfollow accounts", actors),
+		engagementCommand("like", "like posts", posts),
+		engagementCommand("unlike", "remove likes from posts", posts),
+		engagementCommand("repost", "repost posts", posts),
+		engagementCommand("unrepost", "remove reposts", posts),
+	}
+}
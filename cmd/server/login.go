@@ -0,0 +1,296 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/charmbracelet/log"
+	"github.com/desertthunder/quotesky/lib/api"
+	"github.com/desertthunder/quotesky/lib/db"
+	"github.com/desertthunder/quotesky/lib/utils"
+	"github.com/urfave/cli/v2"
+)
+
+func accountFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:    "account",
+		Aliases: []string{"a"},
+		Usage:   "handle of a stored account, the default when omitted",
+	}
+}
+
+// Looks up account h, or the default account when h is empty
+func storedAccount(a *db.AppRepository, h string) (*db.App, error) {
+	if h == "" {
+		app, err := a.GetDefault()
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("no default account, run qsky login: %w", err)
+		}
+
+		return app, err
+	}
+
+	return a.GetByHandle(h)
+}
+
+// Client resuming the session stored for app
+//
+// Requests go to the PDS stored at sign in, or the service for accounts
+// stored before it was. OAuth sessions sign requests with the stored DPoP key
+// and save the tokens they are refreshed to in a.
+func StoredClient(a *db.AppRepository, app *db.App) (*api.Client, error) {
+	c := accountClient(app, "", false)
+	c.Credentials.DID = app.DID
+	c.Credentials.AccessToken = app.Token
+	c.Credentials.RefreshToken = app.RefreshToken
+	c.Credentials.ServiceEndpoint = app.PDS
+
+	if app.PDS == "" {
+		c.Credentials.ServiceEndpoint = c.Service
+	}
+
+	if app.AuthServer == "" {
+		storeSession(a, app.Handle, c)
+		return c, nil
+	}
+
+	pds := c.Credentials.ServiceEndpoint
+	d, err := api.ParseDPoP(app.DPoPKey)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the dpop key for %s: %w", app.Handle, err)
+	}
+
+	c.OAuth = &api.OAuthSession{
+		Issuer:   app.AuthServer,
+		ClientID: app.ClientID,
+		DPoP:     d,
+		OnRefresh: func(t api.TokenResponse) error {
+			return a.SetSession(app.Handle, t.Sub, pds, t.AccessToken, t.RefreshToken)
+		},
+	}
+
+	return c, nil
+}
+
+// Stores the tokens of a renewed password session for handle h
+func storeSession(a *db.AppRepository, h string, c *api.Client) {
+	c.OnSession = func(s api.Session) {
+		err := a.SetSession(h, s.Did, s.GetServiceEndpoint(), s.AccessJwt, s.RefreshJwt)
+
+		if err != nil {
+			c.Log.Warnf("unable to store session for %s: %s", h, err.Error())
+		}
+	}
+}
+
+// Authenticated client for --account, the default account or the environment
+//
+// Stored sessions are reused, the client renews them when the access token
+// has expired. Without any stored account the .env credentials are used.
+func sessionClient(ctx *cli.Context) (*api.Client, error) {
+	a, err := db.InitAppRepo(false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	app, err := storedAccount(a, ctx.String("account"))
+
+	if ctx.String("account") == "" && errors.Is(err, sql.ErrNoRows) {
+		c := api.Init(ctx.String("service"), false)
+		_, err := authenticate(ctx, c)
+
+		return c, err
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := StoredClient(a, app)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if app.Token == "" && app.AuthServer != "" {
+		return nil, fmt.Errorf("%s is signed out, run qsky login --oauth", app.Handle)
+	}
+
+	if app.Token == "" {
+		s, err := c.CreateSession(ctx.Context)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return c, a.SetSession(
+			app.Handle, s.Did, s.GetServiceEndpoint(), s.AccessJwt, s.RefreshJwt,
+		)
+	}
+
+	s, err := c.GetSession(ctx.Context)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if pds := s.GetServiceEndpoint(); pds != "" && pds != app.PDS {
+		c.Credentials.ServiceEndpoint = pds
+		access, refresh := c.Credentials.Tokens()
+		err = a.SetSession(app.Handle, s.Did, pds, access, refresh)
+	}
+
+	return c, err
+}
+
+func logout(ctx *cli.Context) error {
+	a, err := db.InitAppRepo(false)
+
+	if err != nil {
+		return err
+	}
+
+	app, err := storedAccount(a, ctx.String("account"))
+
+	if err != nil {
+		return err
+	}
+
+	c, err := StoredClient(a, app)
+
+	if err != nil {
+		return err
+	}
+
+	if app.RefreshToken != "" {
+		revoke := c.DeleteSession
+
+		if c.OAuth != nil {
+			revoke = c.RevokeOAuth
+		}
+
+		if err := revoke(ctx.Context); err != nil {
+			log.Warnf("unable to revoke session, purging it anyway: %s", err.Error())
+		}
+	}
+
+	if err := a.ClearSession(app.Handle); err != nil {
+		return err
+	}
+
+	log.Infof("logged out of %s", app.Handle)
+
+	return nil
+}
+
+func whoami(ctx *cli.Context) error {
+	a, err := db.InitAppRepo(false)
+
+	if err != nil {
+		return err
+	}
+
+	app, err := storedAccount(a, ctx.String("account"))
+
+	if err != nil {
+		return err
+	}
+
+	c, err := StoredClient(a, app)
+
+	if err != nil {
+		return err
+	}
+
+	s, err := c.GetSession(ctx.Context)
+
+	if err != nil {
+		return err
+	}
+
+	pds := s.GetServiceEndpoint()
+
+	if pds == "" {
+		pds = c.Credentials.ServiceEndpoint
+	}
+
+	status := "active"
+
+	if !s.Active {
+		status = s.Status
+	}
+
+	fmt.Printf("handle:  %s\n", s.Handle)
+	fmt.Printf("did:     %s\n", s.Did)
+	fmt.Printf("pds:     %s\n", pds)
+	fmt.Printf("email:   %s (confirmed: %t)\n", s.Email, s.EmailConfirmed)
+	fmt.Printf("2fa:     %t\n", s.EmailAuthFactor)
+	fmt.Printf("status:  %s\n", status)
+
+	if !s.Active {
+		return cli.Exit(fmt.Sprintf("%s is %s", s.Handle, status), 1)
+	}
+
+	return nil
+}
+
+// login Command definition
+func Login() *cli.Command {
+	return &cli.Command{
+		Name:  "login",
+		Usage: "authenticate and store an account",
+		Flags: append(loginFlags(),
+			&cli.BoolFlag{
+				Name:  "oauth",
+				Usage: "sign in through the browser instead of an app password",
+			},
+			&cli.IntFlag{
+				Name:  "port",
+				Usage: "loopback port for the oauth redirect, random when 0",
+			},
+		),
+		Action: func(ctx *cli.Context) error {
+			if ctx.Bool("oauth") {
+				return oauthLogin(ctx)
+			}
+
+			return addAccount(ctx)
+		},
+	}
+}
+
+// logout Command definition
+func Logout() *cli.Command {
+	return &cli.Command{
+		Name:  "logout",
+		Usage: "revoke the session and purge its stored tokens",
+		Flags: []cli.Flag{accountFlag()},
+		Action: func(ctx *cli.Context) error {
+			if err := utils.LoadEnv(env_path); err != nil {
+				log.Warnf("continuing without %s", env_path)
+			}
+
+			return logout(ctx)
+		},
+	}
+}
+
+// whoami Command definition
+func Whoami() *cli.Command {
+	return &cli.Command{
+		Name:  "whoami",
+		Usage: "show the account behind the stored session",
+		Flags: []cli.Flag{accountFlag()},
+		Action: func(ctx *cli.Context) error {
+			if err := utils.LoadEnv(env_path); err != nil {
+				log.Warnf("continuing without %s", env_path)
+			}
+
+			return whoami(ctx)
+		},
+	}
+}
@@ -0,0 +1,389 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/desertthunder/quotesky/lib/api"
+	"github.com/desertthunder/quotesky/lib/db"
+	"github.com/desertthunder/quotesky/lib/utils"
+	"github.com/urfave/cli/v2"
+)
+
+const notificationPage int = 50
+
+// Matches "!quote stoicism" and "quote about courage"
+var mentionCommand = regexp.MustCompile(`(?i)(?:!quote|\bquote about)\b[ \t]*([^\n]*)`)
+
+// Extracts the requested topic from a mention, if it asks for a quote
+func ParseMention(text string) (string, bool) {
+	m := mentionCommand.FindStringSubmatch(text)
+
+	if m == nil {
+		return "", false
+	}
+
+	return strings.Trim(strings.TrimSpace(m[1]), ".,!?\"'"), true
+}
+
+// Per-author reply budget shared by the bots
+type authorLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	recent map[string][]time.Time
+}
+
+func newAuthorLimiter(n int, window time.Duration) *authorLimiter {
+	return &authorLimiter{limit: n, window: window, recent: map[string][]time.Time{}}
+}
+
+// Reports whether author can get another reply, recording it if so
+func (l *authorLimiter) allow(author string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cutoff := time.Now().Add(-l.window)
+	kept := []time.Time{}
+
+	for _, t := range l.recent[author] {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+
+	if len(kept) >= l.limit {
+		l.recent[author] = kept
+		return false
+	}
+
+	l.recent[author] = append(kept, time.Now())
+
+	return true
+}
+
+// Seen-at and last message cursors of the bots
+//
+// Dry runs only print their answers, so their cursors stay in memory rather
+// than using up mentions & messages that were never really answered.
+type cursors struct {
+	repo   *db.MentionRepository
+	dryRun map[string]string
+}
+
+func newCursors(r *db.MentionRepository) *cursors {
+	return &cursors{repo: r, dryRun: map[string]string{}}
+}
+
+func (c *cursors) seenAt(dry bool, account string) (string, error) {
+	if at, ok := c.dryRun["seen "+account]; ok && dry {
+		return at, nil
+	}
+
+	return c.repo.SeenAt(account)
+}
+
+func (c *cursors) setSeenAt(dry bool, account string, at string) error {
+	if dry {
+		c.dryRun["seen "+account] = at
+		return nil
+	}
+
+	return c.repo.SetSeenAt(account, at)
+}
+
+func (c *cursors) lastMessage(dry bool, account string, convo string) (string, error) {
+	if id, ok := c.dryRun["message "+account+" "+convo]; ok && dry {
+		return id, nil
+	}
+
+	return c.repo.LastMessage(account, convo)
+}
+
+func (c *cursors) setLastMessage(dry bool, account string, convo string, id string) error {
+	if dry {
+		c.dryRun["message "+account+" "+convo] = id
+		return nil
+	}
+
+	return c.repo.SetLastMessage(account, convo, id)
+}
+
+// Polls notifications and replies to mentions asking for a quote
+//
+// The newest handled notification is stored per account so restarts pick
+// up where the last run stopped. Each author gets at most limit replies
+// per window and blocked actors are ignored.
+type MentionPoller struct {
+	sessions *Sessions
+	commands *Commands
+	repo     *db.MentionRepository
+	cursors  *cursors
+	account  string
+	interval time.Duration
+	limiter  *authorLimiter
+	logger   *log.Logger
+}
+
+// MentionPoller constructor
+func NewMentionPoller(
+	s *Sessions, c *Commands, account string, every time.Duration,
+) *MentionPoller {
+	repo := db.InitMentionRepo(false)
+
+	return &MentionPoller{
+		sessions: s,
+		commands: c,
+		repo:     repo,
+		cursors:  newCursors(repo),
+		account:  account,
+		interval: every,
+		limiter:  newAuthorLimiter(3, time.Hour),
+		logger:   log.NewWithOptions(os.Stderr, utils.Options("Mentions 🔔", false)),
+	}
+}
+
+// Sets how many replies one author can get per window
+func (m *MentionPoller) SetRateLimit(n int, window time.Duration) {
+	m.limiter = newAuthorLimiter(n, window)
+}
+
+// Polls every interval until ctx is cancelled
+func (m *MentionPoller) Run(ctx context.Context) {
+	t := time.NewTicker(m.interval)
+	defer t.Stop()
+
+	m.logger.Infof("polling mentions every %s", m.interval)
+
+	for {
+		if err := m.Poll(ctx); err != nil && ctx.Err() == nil {
+			m.logger.Errorf("unable to poll notifications: %s", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Fetches notifications newer than the stored timestamp, oldest first
+func (m *MentionPoller) unseen(
+	ctx context.Context, c *api.Client, seen time.Time,
+) ([]api.Notification, error) {
+	out := []api.Notification{}
+	cursor := ""
+
+	for {
+		page, err := c.ListNotifications(ctx, notificationPage, cursor)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, n := range page.Notifications {
+			at, err := time.Parse(time.RFC3339, n.IndexedAt)
+
+			if err != nil || !at.After(seen) {
+				return out, nil
+			}
+
+			out = append([]api.Notification{n}, out...)
+		}
+
+		if page.Cursor == "" || seen.IsZero() {
+			return out, nil
+		}
+
+		cursor = page.Cursor
+	}
+}
+
+// Answers the mentions since the last poll once
+func (m *MentionPoller) Poll(ctx context.Context) error {
+	c, err := m.sessions.Client(ctx, m.account)
+
+	if err != nil {
+		return err
+	}
+
+	key := c.Credentials.DID
+	raw, err := m.cursors.seenAt(c.DryRun != nil, key)
+
+	if err != nil {
+		return err
+	}
+
+	seen, _ := time.Parse(time.RFC3339, raw)
+	notifications, err := m.unseen(ctx, c, seen)
+
+	if err != nil || len(notifications) == 0 {
+		return err
+	}
+
+	newest := notifications[len(notifications)-1].IndexedAt
+
+	// Don't answer a backlog of old mentions the first time an account runs
+	if raw == "" {
+		m.logger.Infof("starting mentions for %s after %s", key, newest)
+		return m.markSeen(ctx, c, key, newest)
+	}
+
+	// Only mentions that were answered are marked seen, so a failed one is
+	// retried on the next poll rather than dropped
+	handled := ""
+
+	for _, n := range notifications {
+		err := ctx.Err()
+
+		if err == nil {
+			err = m.handle(ctx, c, n)
+		}
+
+		if err != nil {
+			if handled != "" {
+				err = errors.Join(err, m.markSeen(ctx, c, key, handled))
+			}
+
+			return fmt.Errorf("unable to answer %s: %w", n.URI, err)
+		}
+
+		handled = n.IndexedAt
+	}
+
+	return m.markSeen(ctx, c, key, newest)
+}
+
+func (m *MentionPoller) markSeen(ctx context.Context, c *api.Client, key string, at string) error {
+	if err := m.cursors.setSeenAt(c.DryRun != nil, key, at); err != nil {
+		return err
+	}
+
+	return c.UpdateSeen(ctx, at)
+}
+
+// Replies to a single mention in its thread
+func (m *MentionPoller) handle(ctx context.Context, c *api.Client, n api.Notification) error {
+	if n.Reason != api.ReasonMention && n.Reason != api.ReasonReply {
+		return nil
+	}
+
+	if n.Author.DID == c.Credentials.DID {
+		return nil
+	}
+
+	p, err := n.Post()
+
+	if err != nil {
+		return err
+	}
+
+	term, ok := ParseMention(p.Text)
+
+	if !ok {
+		return nil
+	}
+
+	blocked, err := m.repo.IsBlocked(n.Author.DID, n.Author.Handle)
+
+	if err != nil || blocked {
+		return err
+	}
+
+	if !m.limiter.allow(n.Author.DID) {
+		m.logger.Warnf("rate limiting %s", n.Author.Handle)
+		return nil
+	}
+
+	text, err := m.commands.Handle(ctx, m.account, fmt.Sprintf("QUOTE:GET %s", term))
+
+	if err != nil {
+		text = fmt.Sprintf("Sorry, I couldn't find one: %s", err.Error())
+	}
+
+	reply, err := n.ReplyRef()
+
+	if err != nil {
+		return err
+	}
+
+	res, err := c.CreatePost(ctx, api.Message{Content: text, Reply: reply})
+
+	if err != nil {
+		return err
+	}
+
+	m.logger.Infof("answered %s with %s", n.Author.Handle, res.URI)
+
+	return nil
+}
+
+// blocklist Command definition
+func Blocklist() *cli.Command {
+	actor := func(ctx *cli.Context) (string, error) {
+		a := ctx.Args().First()
+
+		if a == "" {
+			return "", fmt.Errorf("usage: qsky blocklist %s <handle|did>", ctx.Command.Name)
+		}
+
+		return a, nil
+	}
+
+	return &cli.Command{
+		Name:  "blocklist",
+		Usage: "manage who the bot ignores when mentioned",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "add",
+				ArgsUsage: "<handle|did>",
+				Action: func(ctx *cli.Context) error {
+					a, err := actor(ctx)
+
+					if err != nil {
+						return err
+					}
+
+					return db.InitMentionRepo(false).Block(a)
+				},
+			},
+			{
+				Name:      "remove",
+				ArgsUsage: "<handle|did>",
+				Action: func(ctx *cli.Context) error {
+					a, err := actor(ctx)
+
+					if err != nil {
+						return err
+					}
+
+					return db.InitMentionRepo(false).Unblock(a)
+				},
+			},
+			{
+				Name: "list",
+				Action: func(ctx *cli.Context) error {
+					actors, err := db.InitMentionRepo(false).Blocked()
+
+					if err != nil {
+						return err
+					}
+
+					for _, a := range actors {
+						fmt.Println(a)
+					}
+
+					return nil
+				},
+			},
+		},
+	}
+}
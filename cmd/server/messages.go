@@ -0,0 +1,248 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/desertthunder/quotesky/lib/api"
+	"github.com/desertthunder/quotesky/lib/db"
+	"github.com/desertthunder/quotesky/lib/utils"
+)
+
+const convoPage int = 50
+
+// Most pages read back through a conversation looking for the last answer
+const maxMessagePages int = 5
+
+const dmHelp string = "Send QUOTE:GET <topic>, QUOTE:LIST or \"!quote <topic>\" for a quote."
+
+// Verbs anyone may send the bot privately; the rest change the quote store
+var dmVerbs = map[string]bool{"QUOTE:GET": true, "QUOTE:LIST": true}
+
+// Polls direct messages and answers them with the QUOTE:* command set
+//
+// The last handled message is stored per conversation so restarts don't
+// answer anything twice.
+type MessagePoller struct {
+	sessions *Sessions
+	commands *Commands
+	repo     *db.MentionRepository
+	cursors  *cursors
+	account  string
+	interval time.Duration
+	limiter  *authorLimiter
+	logger   *log.Logger
+}
+
+// MessagePoller constructor
+func NewMessagePoller(
+	s *Sessions, c *Commands, account string, every time.Duration,
+) *MessagePoller {
+	repo := db.InitMentionRepo(false)
+
+	return &MessagePoller{
+		sessions: s,
+		commands: c,
+		repo:     repo,
+		cursors:  newCursors(repo),
+		account:  account,
+		interval: every,
+		limiter:  newAuthorLimiter(10, time.Hour),
+		logger:   log.NewWithOptions(os.Stderr, utils.Options("Messages ✉️", false)),
+	}
+}
+
+// Sets how many answers one sender can get per window
+func (m *MessagePoller) SetRateLimit(n int, window time.Duration) {
+	m.limiter = newAuthorLimiter(n, window)
+}
+
+// Polls every interval until ctx is cancelled
+func (m *MessagePoller) Run(ctx context.Context) {
+	t := time.NewTicker(m.interval)
+	defer t.Stop()
+
+	m.logger.Infof("polling direct messages every %s", m.interval)
+
+	for {
+		if err := m.Poll(ctx); err != nil && ctx.Err() == nil {
+			m.logger.Errorf("unable to poll messages: %s", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Answers every conversation with unread messages once
+func (m *MessagePoller) Poll(ctx context.Context) error {
+	c, err := m.sessions.Client(ctx, m.account)
+
+	if err != nil {
+		return err
+	}
+
+	chat := c.Chat()
+	cursor := ""
+
+	for {
+		page, err := chat.ListConvos(ctx, convoPage, cursor)
+
+		if err != nil {
+			return err
+		}
+
+		for _, convo := range page.Convos {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			if err := m.handleConvo(ctx, c, chat, convo); err != nil {
+				m.logger.Errorf("unable to answer convo %s: %s", convo.ID, err.Error())
+			}
+		}
+
+		if page.Cursor == "" {
+			return nil
+		}
+
+		cursor = page.Cursor
+	}
+}
+
+// Messages after last, oldest first, and the newest message id
+//
+// Conversations seen for the first time only return their unread messages.
+func (m *MessagePoller) unread(
+	ctx context.Context, chat *api.ChatClient, convo api.ConvoView, last string,
+) ([]api.MessageView, string, error) {
+	out := []api.MessageView{}
+	newest := ""
+	cursor := ""
+
+	for i := 0; i < maxMessagePages; i++ {
+		page, err := chat.GetMessages(ctx, convo.ID, convoPage, cursor)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		for _, msg := range page.Messages {
+			if newest == "" {
+				newest = msg.ID
+			}
+
+			if msg.ID == last || (last == "" && len(out) >= convo.UnreadCount) {
+				return out, newest, nil
+			}
+
+			out = append([]api.MessageView{msg}, out...)
+		}
+
+		if page.Cursor == "" {
+			break
+		}
+
+		cursor = page.Cursor
+	}
+
+	return out, newest, nil
+}
+
+func (m *MessagePoller) handleConvo(
+	ctx context.Context, c *api.Client, chat *api.ChatClient, convo api.ConvoView,
+) error {
+	self, dry := c.Credentials.DID, c.DryRun != nil
+	last, err := m.cursors.lastMessage(dry, self, convo.ID)
+
+	if err != nil {
+		return err
+	}
+
+	if last != "" && convo.UnreadCount == 0 {
+		return nil
+	}
+
+	msgs, newest, err := m.unread(ctx, chat, convo, last)
+
+	if err != nil || newest == "" || newest == last {
+		return err
+	}
+
+	for _, msg := range msgs {
+		if msg.Deleted() || msg.Sender.DID == self {
+			continue
+		}
+
+		text := m.answer(ctx, msg.Sender.DID, msg.Text)
+
+		if text == "" {
+			continue
+		}
+
+		if _, err := chat.SendMessage(ctx, convo.ID, text); err != nil {
+			return err
+		}
+
+		m.logger.Infof("answered %s in %s", msg.Sender.DID, convo.ID)
+
+		// Stored per answer so a failure later on can't answer this one again
+		if err := m.cursors.setLastMessage(dry, self, convo.ID, msg.ID); err != nil {
+			return err
+		}
+	}
+
+	if err := m.cursors.setLastMessage(dry, self, convo.ID, newest); err != nil {
+		return err
+	}
+
+	return chat.UpdateRead(ctx, convo.ID, newest)
+}
+
+// Runs the command in a direct message, empty when it shouldn't be answered
+func (m *MessagePoller) answer(ctx context.Context, sender string, text string) string {
+	blocked, err := m.repo.IsBlocked(sender)
+
+	if err != nil || blocked {
+		return ""
+	}
+
+	if !m.limiter.allow(sender) {
+		m.logger.Warnf("rate limiting %s", sender)
+		return ""
+	}
+
+	line := text
+
+	if !isCommand(text) {
+		term, ok := ParseMention(text)
+
+		if !ok {
+			return dmHelp
+		}
+
+		line = fmt.Sprintf("QUOTE:GET %s", term)
+	}
+
+	if verb, _ := parseCommand(line); !dmVerbs[verb] {
+		return fmt.Sprintf("%s isn't available in direct messages. %s", verb, dmHelp)
+	}
+
+	out, err := m.commands.Handle(ctx, m.account, line)
+
+	if err != nil {
+		out = fmt.Sprintf("Sorry, I couldn't do that: %s", err.Error())
+	}
+
+	if r := []rune(out); len(r) > api.MaxMessageLength {
+		out = string(r[:api.MaxMessageLength-1]) + "…"
+	}
+
+	return out
+}
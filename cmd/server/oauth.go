@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/desertthunder/quotesky/lib/api"
+	"github.com/desertthunder/quotesky/lib/db"
+	"github.com/desertthunder/quotesky/lib/utils"
+	"github.com/urfave/cli/v2"
+)
+
+// How long the user has to approve the authorization in their browser
+const oauthTimeout time.Duration = 5 * time.Minute
+
+// Signs in through the account's authorization server and stores the grant
+//
+// The authorization server redirects back to a listener on 127.0.0.1, so
+// this has to run on a machine with a browser.
+func oauthLogin(ctx *cli.Context) error {
+	if err := utils.LoadEnv(env_path); err != nil {
+		log.Warnf("continuing without %s", env_path)
+	}
+
+	c := api.Init(ctx.String("service"), false)
+	l, err := api.ListenLoopback(ctx.Int("port"))
+
+	if err != nil {
+		return err
+	}
+
+	r, err := c.StartOAuth(ctx.Context, ctx.String("handle"), l.RedirectURI())
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Open this page to authorize qsky:\n\n  %s\n\n", r.URL)
+
+	wctx, cancel := context.WithTimeout(ctx.Context, oauthTimeout)
+	defer cancel()
+
+	q, err := l.Wait(wctx)
+
+	if err != nil {
+		return fmt.Errorf("no authorization received: %w", err)
+	}
+
+	t, err := c.FinishOAuth(ctx.Context, r, q)
+
+	if err != nil {
+		return err
+	}
+
+	c.OAuth = r.Session()
+	c.SetOAuthTokens(*t, r.PDS)
+
+	s, err := c.GetSession(ctx.Context)
+
+	if err != nil {
+		return err
+	}
+
+	key, err := r.DPoP.Encode()
+
+	if err != nil {
+		return err
+	}
+
+	a, err := db.InitAppRepo(false)
+
+	if err != nil {
+		return err
+	}
+
+	app := db.App{
+		Handle:       s.Handle,
+		DID:          t.Sub,
+		Service:      c.Service,
+		PDS:          r.PDS,
+		Token:        t.AccessToken,
+		RefreshToken: t.RefreshToken,
+		AuthServer:   r.Metadata.Issuer,
+		ClientID:     r.ClientID,
+		DPoPKey:      key,
+	}
+
+	if err := a.SaveOAuth(app); err != nil {
+		return err
+	}
+
+	_, err = a.GetDefault()
+
+	if ctx.Bool("default") || errors.Is(err, sql.ErrNoRows) {
+		if err := a.SetDefault(app.Handle); err != nil {
+			return err
+		}
+	}
+
+	log.Infof("added %s (%s) through %s", app.Handle, app.DID, app.AuthServer)
+
+	return nil
+}
@@ -2,22 +2,100 @@ package server
 
 import (
 	"bufio"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
+	"os"
 	"strings"
 
 	"github.com/charmbracelet/log"
 	"github.com/desertthunder/quotesky/lib/api"
+	"github.com/desertthunder/quotesky/lib/db"
+	"github.com/desertthunder/quotesky/lib/utils"
 	"github.com/urfave/cli/v2"
 )
 
+// Reply & quote restriction flags
+func gateFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name: "replies",
+			Usage: "who may reply: everyone, nobody or any of mentioned, followers, " +
+				"following and list at-uris, comma separated",
+		},
+		&cli.BoolFlag{Name: "no-quotes", Usage: "stop other accounts from quoting"},
+	}
+}
+
+// Gates from the flags, nil when neither was passed so account defaults apply
+func flagGates(ctx *cli.Context) (*api.Gates, error) {
+	if !ctx.IsSet("replies") && !ctx.IsSet("no-quotes") {
+		return nil, nil
+	}
+
+	g := api.Gates{
+		Replies:  api.ParseReplyRules(ctx.String("replies")),
+		NoQuotes: ctx.Bool("no-quotes"),
+	}
+
+	return &g, g.Validate()
+}
+
+func dryRunFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "print the createRecord/applyWrites requests as JSON lines instead of posting",
+	}
+}
+
+// Client that prints the requests account would send, without any network calls
+//
+// The repo is the stored account's DID, or BLUESKY_HANDLE without a stored
+// account, so the printed records match what a real post would write.
+func dryRunClient(account string) (*api.Client, error) {
+	if err := utils.LoadEnv(env_path); err != nil {
+		log.Warnf("continuing without %s", env_path)
+	}
+
+	a, err := db.InitAppRepo(false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	app, err := storedAccount(a, account)
+
+	if account == "" && errors.Is(err, sql.ErrNoRows) {
+		c := api.Init("", false)
+		c.Credentials.DID = c.Credentials.Handle
+		c.DryRun = os.Stdout
+
+		return c, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	c := accountClient(app, "", false)
+	c.Credentials.DID = app.DID
+	c.DryRun = os.Stdout
+
+	if app.DID == "" {
+		c.Credentials.DID = app.Handle
+	}
+
+	return c, nil
+}
+
 func Post() *cli.Command {
 	return &cli.Command{
 		Name:    "post",
 		Aliases: []string{"p"},
 		Usage:   "post to bluesky",
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			&cli.StringFlag{
 				Name:     "content",
 				Aliases:  []string{"c"},
@@ -30,7 +108,22 @@ func Post() *cli.Command {
 				Usage:    "any hashtags you want to add",
 				Required: false,
 			},
-		},
+			&cli.StringSliceFlag{
+				Name:  "lang",
+				Usage: "language tag, e.g. en or pt-BR, detected from the content when omitted",
+			},
+			&cli.StringSliceFlag{
+				Name: "label",
+				Usage: "self-label (content warning): " +
+					strings.Join(api.SelfLabelValues, ", "),
+			},
+			&cli.StringFlag{
+				Name:    "account",
+				Aliases: []string{"a"},
+				Usage:   "handle of the account to post as",
+			},
+			dryRunFlag(),
+		}, gateFlags()...),
 		Action: func(ctx *cli.Context) error {
 			log.Info("Making request to tcp client")
 
@@ -48,13 +141,50 @@ func Post() *cli.Command {
 				content, strings.Join(hashtags, ", "),
 			)
 
+			if err := api.ValidateLabels(ctx.StringSlice("label")); err != nil {
+				return err
+			}
+
+			gates, err := flagGates(ctx)
+
+			if err != nil {
+				return err
+			}
+
+			msg := api.Message{
+				Content:  content,
+				Hashtags: hashtags,
+				Account:  ctx.String("account"),
+				Langs:    ctx.StringSlice("lang"),
+				Labels:   ctx.StringSlice("label"),
+				Gates:    gates,
+			}
+
+			// Rendered locally, the TCP server isn't needed
+			if ctx.Bool("dry-run") {
+				c, err := dryRunClient(msg.Account)
+
+				if err != nil {
+					return err
+				}
+
+				res, err := c.CreatePost(ctx.Context, msg)
+
+				if err != nil {
+					return err
+				}
+
+				log.Infof("dry run of %s", res.URI)
+
+				return nil
+			}
+
 			conn, err := net.Dial("tcp", ":9000")
 
 			if err != nil {
 				return err
 			}
 
-			msg := api.Message{Content: content, Hashtags: hashtags}
 			data, err := json.Marshal(msg)
 
 			if err != nil {
@@ -76,7 +206,22 @@ func Post() *cli.Command {
 
 			log.Infof("response: %s", resp)
 
+			if uri, link, ok := parseResponse(resp); ok {
+				fmt.Printf("uri:  %s\nlink: %s\n", uri, link)
+			}
+
 			return nil
 		},
 	}
 }
+
+// Extracts the record URI and web link from an OK response line
+func parseResponse(r string) (string, string, bool) {
+	fields := strings.Fields(r)
+
+	if len(fields) != 3 || fields[0] != "OK" {
+		return "", "", false
+	}
+
+	return fields[1], fields[2], true
+}
@@ -0,0 +1,201 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/charmbracelet/log"
+	"github.com/desertthunder/quotesky/lib/api"
+	"github.com/desertthunder/quotesky/lib/utils"
+	"github.com/urfave/cli/v2"
+)
+
+// Uploads the avatar or banner image at path
+func uploadImage(ctx *cli.Context, c *api.Client, path string) (*api.Blob, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > api.MaxProfileImage {
+		return nil, fmt.Errorf(
+			"%s is %d bytes, at most %d allowed", path, len(data), api.MaxProfileImage,
+		)
+	}
+
+	return c.UploadBlob(ctx.Context, data, "")
+}
+
+func printProfile(p *api.Profile) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	blob := func(b *api.Blob) string {
+		if b == nil {
+			return ""
+		}
+
+		return fmt.Sprintf("%s (%s, %d bytes)", b.Ref.Link, b.MimeType, b.Size)
+	}
+
+	pinned := ""
+
+	if p.PinnedPost != nil {
+		pinned = p.PinnedPost.URI
+	}
+
+	fmt.Fprintf(w, "display name\t%s\n", p.DisplayName)
+	fmt.Fprintf(w, "description\t%s\n", p.Description)
+	fmt.Fprintf(w, "avatar\t%s\n", blob(p.Avatar))
+	fmt.Fprintf(w, "banner\t%s\n", blob(p.Banner))
+	fmt.Fprintf(w, "pinned post\t%s\n", pinned)
+
+	return w.Flush()
+}
+
+func showProfile(ctx *cli.Context) error {
+	c, err := sessionClient(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	p, _, err := c.GetProfileRecord(ctx.Context)
+
+	if err != nil {
+		return err
+	}
+
+	if ctx.String("format") == "json" {
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+
+		return e.Encode(p)
+	}
+
+	return printProfile(p)
+}
+
+// Applies the flags that were passed, leaving other fields as they are
+func setProfile(ctx *cli.Context) error {
+	c, err := sessionClient(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	edits := []func(*api.Profile){}
+
+	if ctx.IsSet("display-name") {
+		v := ctx.String("display-name")
+		edits = append(edits, func(p *api.Profile) { p.DisplayName = v })
+	}
+
+	if ctx.IsSet("description") {
+		v := ctx.String("description")
+		edits = append(edits, func(p *api.Profile) { p.Description = v })
+	}
+
+	// Images & the pinned post are resolved once, before the swap loop
+	if path := ctx.String("avatar"); path != "" {
+		b, err := uploadImage(ctx, c, path)
+
+		if err != nil {
+			return err
+		}
+
+		edits = append(edits, func(p *api.Profile) { p.Avatar = b })
+	}
+
+	if path := ctx.String("banner"); path != "" {
+		b, err := uploadImage(ctx, c, path)
+
+		if err != nil {
+			return err
+		}
+
+		edits = append(edits, func(p *api.Profile) { p.Banner = b })
+	}
+
+	if uri := ctx.String("pin"); uri != "" {
+		ref, err := c.PostRef(ctx.Context, uri)
+
+		if err != nil {
+			return err
+		}
+
+		edits = append(edits, func(p *api.Profile) { p.PinnedPost = ref })
+	}
+
+	if ctx.Bool("unpin") {
+		edits = append(edits, func(p *api.Profile) { p.PinnedPost = nil })
+	}
+
+	if len(edits) == 0 {
+		return fmt.Errorf("nothing to change, see qsky profile set --help")
+	}
+
+	p, err := c.UpdateProfile(ctx.Context, func(p *api.Profile) error {
+		for _, edit := range edits {
+			edit(p)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	log.Infof("updated profile for %s", c.Credentials.DID)
+
+	return printProfile(p)
+}
+
+// profile Command definition
+func Profile() *cli.Command {
+	flags := func(extra ...cli.Flag) []cli.Flag {
+		return append([]cli.Flag{accountFlag(), serviceFlag(), authFactorFlag()}, extra...)
+	}
+	before := func(*cli.Context) error {
+		if err := utils.LoadEnv(env_path); err != nil {
+			log.Warnf("continuing without %s", env_path)
+		}
+
+		return nil
+	}
+
+	return &cli.Command{
+		Name:  "profile",
+		Usage: "show or update an account's profile",
+		Subcommands: []*cli.Command{
+			{
+				Name:   "show",
+				Usage:  "print the profile record",
+				Before: before,
+				Flags: flags(&cli.StringFlag{
+					Name:    "format",
+					Aliases: []string{"f"},
+					Value:   "table",
+					Usage:   "table or json",
+				}),
+				Action: showProfile,
+			},
+			{
+				Name:   "set",
+				Usage:  "update the profile fields that are passed",
+				Before: before,
+				Flags: flags(
+					&cli.StringFlag{Name: "display-name", Usage: "empty to clear"},
+					&cli.StringFlag{Name: "description", Usage: "bio, empty to clear"},
+					&cli.StringFlag{Name: "avatar", Usage: "path to a png or jpeg"},
+					&cli.StringFlag{Name: "banner", Usage: "path to a png or jpeg"},
+					&cli.StringFlag{Name: "pin", Usage: "at-uri or bsky.app link of a post to pin"},
+					&cli.BoolFlag{Name: "unpin", Usage: "remove the pinned post"},
+				),
+				Action: setProfile,
+			},
+		},
+	}
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/desertthunder/quotesky/lib/api"
+	"github.com/desertthunder/quotesky/lib/db"
+	"github.com/desertthunder/quotesky/lib/publish"
+)
+
+const blueskyDestination string = "bluesky"
+
+// Bluesky publisher that records posts in the history
+type recorded struct {
+	*publish.Bluesky
+	commands *Commands
+}
+
+func (r recorded) Publish(ctx context.Context, m api.Message) (*publish.Result, error) {
+	res, err := r.commands.publish(ctx, m.Account, m, db.HistoryPost{})
+
+	if err != nil {
+		return nil, err
+	}
+
+	out := publish.Result{ID: res.URI, URL: res.WebURL(), Post: res}
+
+	// The post lives in the repo of the account it was made as
+	if u, err := api.ParseATURI(res.URI); err == nil {
+		out.Account = u.Authority
+	}
+
+	return &out, nil
+}
+
+// Parses --publish destinations
+//
+// Each is bluesky, stdout, jsonl:<path> or mastodon, configured by
+// MASTODON_SERVER & MASTODON_TOKEN. With dryRun set every destination but
+// Bluesky, whose sessions print instead of posting, writes its records there.
+func Destinations(specs []string, c *Commands, dryRun io.Writer) ([]publish.Destination, error) {
+	if len(specs) == 0 {
+		specs = []string{blueskyDestination}
+	}
+
+	dests := []publish.Destination{}
+
+	for _, s := range specs {
+		name, arg, _ := strings.Cut(s, ":")
+		d := publish.Destination{Name: name}
+
+		switch name {
+		case blueskyDestination:
+			d.Publisher = recorded{publish.NewBluesky(c.sessions), c}
+		case "stdout":
+			d.Publisher = publish.NewStdout(os.Stdout)
+		case "jsonl":
+			if arg == "" {
+				return nil, fmt.Errorf("jsonl needs a path, e.g. jsonl:posts.jsonl")
+			}
+
+			d.Publisher = publish.NewJSONL(arg)
+		case "mastodon":
+			m, err := publish.MastodonFromEnv()
+
+			if err != nil {
+				return nil, err
+			}
+
+			d.Publisher = m
+		default:
+			return nil, fmt.Errorf("unknown destination %s", s)
+		}
+
+		if dryRun != nil && name != blueskyDestination {
+			d.Publisher = publish.NewStdout(dryRun)
+		}
+
+		dests = append(dests, d)
+	}
+
+	return dests, nil
+}
+
+// Formats per-destination results, one line each
+func formatResults(results []publish.Result) string {
+	lines := []string{}
+
+	for _, r := range results {
+		if r.Err != nil && r.ID != "" {
+			lines = append(lines, fmt.Sprintf("ERR %s %s, partly posted as %s",
+				r.Destination, r.Err.Error(), r.ID))
+			continue
+		}
+
+		if r.Err != nil {
+			lines = append(lines, fmt.Sprintf("ERR %s %s", r.Destination, r.Err.Error()))
+			continue
+		}
+
+		line := strings.TrimSpace(fmt.Sprintf("OK %s %s %s", r.Destination, r.ID, r.URL))
+
+		if r.Account != "" {
+			line = fmt.Sprintf("%s as %s", line, r.Account)
+		}
+
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/charmbracelet/log"
+	"github.com/desertthunder/quotesky/lib/db"
+	"github.com/desertthunder/quotesky/lib/utils"
+	"github.com/urfave/cli/v2"
+)
+
+// Builds the cipher secrets are rotated to
+func nextCipher(ctx *cli.Context) (db.Cipher, error) {
+	if path := ctx.String("new-key-file"); path != "" {
+		return db.KeyFileCipher(path)
+	}
+
+	p := ctx.String("new-passphrase")
+
+	if p == "" && interactive() {
+		var err error
+		p, err = prompt("New passphrase: ")
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if p == "" {
+		return nil, fmt.Errorf("pass --new-passphrase or --new-key-file")
+	}
+
+	return db.PassphraseCipher(p)
+}
+
+func rotate(ctx *cli.Context) error {
+	if err := utils.LoadEnv(env_path); err != nil {
+		log.Warnf("continuing without %s", env_path)
+	}
+
+	next, err := nextCipher(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	a, err := db.InitAppRepo(false)
+
+	if err != nil {
+		return err
+	}
+
+	n, err := a.Rotate(next)
+
+	if err != nil {
+		return err
+	}
+
+	log.Infof("re-encrypted secrets for %d accounts", n)
+	log.Info("update QSKY_PASSPHRASE or QSKY_KEY_FILE to use the new key")
+
+	return nil
+}
+
+// secrets Command definition
+func Secrets() *cli.Command {
+	return &cli.Command{
+		Name:  "secrets",
+		Usage: "manage encryption of stored passwords and tokens",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "rotate",
+				Usage: "re-encrypt stored secrets under a new key",
+				Description: "Secrets are read with the current QSKY_PASSPHRASE or " +
+					"QSKY_KEY_FILE. Run it without either to encrypt plaintext secrets " +
+					"for the first time.",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "new-passphrase",
+						Usage:   "passphrase to derive the new key from, prompted when omitted",
+						EnvVars: []string{"QSKY_NEW_PASSPHRASE"},
+					},
+					&cli.StringFlag{Name: "new-key-file", Usage: "key file holding the new key"},
+				},
+				Action: rotate,
+			},
+			{
+				Name:  "keygen",
+				Usage: "write a new random key file",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "out", Aliases: []string{"o"}, Required: true},
+				},
+				Action: func(ctx *cli.Context) error {
+					if err := db.GenerateKeyFile(ctx.String("out")); err != nil {
+						return err
+					}
+
+					log.Infof("wrote key to %s", ctx.String("out"))
+
+					return nil
+				},
+			},
+		},
+	}
+}
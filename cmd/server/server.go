@@ -2,23 +2,29 @@ package server
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/charmbracelet/log"
 	"github.com/desertthunder/quotesky/lib/api"
+	"github.com/desertthunder/quotesky/lib/publish"
 	"github.com/desertthunder/quotesky/lib/utils"
 	"github.com/urfave/cli/v2"
 )
 
 type Protocol struct {
-	client   *api.Client
+	sessions *Sessions
+	commands *Commands
+	dests    []publish.Destination
 	port     int
 	addr     string
 	beat     time.Duration
@@ -33,53 +39,64 @@ func (p Protocol) handleConnError(e error) {
 
 	p.logger.Error(out)
 
-	_, err := p.conn.Write([]byte(out))
+	_, err := p.conn.Write([]byte(out + "\n\n"))
 
 	if err != nil {
 		p.logger.Errorf("unable to write to connection %s", err.Error())
 	}
 }
 
-func (p Protocol) handleMessage() {
-	defer p.conn.Close()
+// Reads newline delimited messages until the connection closes
+//
+// Cancels the connection context on read errors so in-flight posts stop. A
+// client closing its end finishes the lines already sent instead.
+func (p Protocol) read(ctx context.Context, cancel context.CancelFunc, lines chan<- string) {
+	defer close(lines)
 
-	log.Infof("Handling connection from %s\n", p.conn.RemoteAddr().String())
 	reader := bufio.NewReader(p.conn)
 
 	for {
 		data, err := reader.ReadString('\n')
 
-		if err != nil && err == io.EOF {
-			continue
+		if err == io.EOF {
+			log.Infof("%s disconnected", p.conn.RemoteAddr().String())
+			return
 		}
 
 		if err != nil {
-			p.handleConnError(err)
-			continue
+			p.logger.Errorf("unable to read from connection: %s", err.Error())
+			cancel()
+			return
 		}
 
-		msg := api.Message{}
-		err = json.Unmarshal([]byte(data), &msg)
-
-		if err != nil {
-			p.handleConnError(err)
-			continue
+		select {
+		case lines <- data:
+		case <-ctx.Done():
+			return
 		}
+	}
+}
 
-		s := fmt.Sprintf("content: %s", msg.Content)
-		if len(msg.Hashtags) > 0 {
-			s = fmt.Sprintf("%s | hashtags: %s", s, strings.Join(msg.Hashtags, ", "))
-		}
+func (p Protocol) handleMessage(ctx context.Context) {
+	defer p.conn.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	log.Infof("Handling connection from %s\n", p.conn.RemoteAddr().String())
 
-		log.Info(s)
+	lines := make(chan string)
+	go p.read(ctx, cancel, lines)
 
-		err = p.client.CreatePost(msg)
+	for data := range lines {
+		out, err := p.handleLine(ctx, data)
 
 		if err != nil {
 			p.handleConnError(err)
+			continue
 		}
 
-		_, err = p.conn.Write([]byte("OK\n\n"))
+		_, err = p.conn.Write([]byte(out + "\n\n"))
 
 		if err != nil {
 			p.handleConnError(err)
@@ -87,15 +104,62 @@ func (p Protocol) handleMessage() {
 	}
 }
 
-func (p Protocol) heartbeat() {
+// Runs a protocol verb or posts a JSON message
+//
+// Responses are terminated by a blank line when written.
+func (p Protocol) handleLine(ctx context.Context, data string) (string, error) {
+	if isCommand(data) {
+		log.Infof("command: %s", strings.TrimSpace(data))
+		return p.commands.Handle(ctx, "", data)
+	}
+
+	msg := api.Message{}
+
+	if err := json.Unmarshal([]byte(data), &msg); err != nil {
+		return "", err
+	}
+
+	s := fmt.Sprintf("content: %s", msg.Content)
+	if len(msg.Hashtags) > 0 {
+		s = fmt.Sprintf("%s | hashtags: %s", s, strings.Join(msg.Hashtags, ", "))
+	}
+
+	log.Info(s)
+
+	dests, err := publish.Select(p.dests, msg.Destinations)
+
+	if err != nil {
+		return "", err
+	}
+
+	results := publish.FanOut(ctx, dests, msg)
+
+	// A lone Bluesky destination keeps the original response
+	if len(results) == 1 && results[0].Destination == blueskyDestination {
+		if results[0].Err != nil {
+			return "", results[0].Err
+		}
+
+		return fmt.Sprintf("OK %s %s", results[0].ID, results[0].URL), nil
+	}
+
+	return formatResults(results), nil
+}
+
+func (p Protocol) heartbeat(ctx context.Context) {
 	t := time.NewTicker(p.beat)
 
 	defer t.Stop()
 
 	for {
-		tick := <-t.C
-
-		log.Infof("heartbeat at %s on %s", tick.Format("03:04:05 PM"), tick.Format("01/02/2006"))
+		select {
+		case <-ctx.Done():
+			return
+		case tick := <-t.C:
+			log.Infof(
+				"heartbeat at %s on %s", tick.Format("03:04:05 PM"), tick.Format("01/02/2006"),
+			)
+		}
 	}
 }
 
@@ -103,25 +167,34 @@ func (p *Protocol) updateConn(c net.Conn) {
 	p.conn = c
 }
 
-func (p Protocol) listen() error {
-
+// Accepts connections until ctx is cancelled
+func (p Protocol) listen(ctx context.Context) error {
 	defer p.listener.Close()
 
 	log.Infof("listening at %s", p.addr)
 
-	go p.heartbeat()
+	go p.heartbeat(ctx)
+	go func() {
+		<-ctx.Done()
+		p.listener.Close()
+	}()
 
 	for {
 		conn, err := p.listener.Accept()
 
-		p.updateConn(conn)
+		if err != nil && ctx.Err() != nil {
+			log.Info("shutting down")
+			return nil
+		}
 
 		if err != nil {
 			log.Errorf("unable to accept messages: %s", err.Error())
 			return err
 		}
 
-		go p.handleMessage()
+		p.updateConn(conn)
+
+		go p.handleMessage(ctx)
 	}
 }
 
@@ -166,25 +239,41 @@ func (p *Protocol) SetLogger(opts *log.Options) {
 	p.logger = log.NewWithOptions(os.Stderr, *opts)
 }
 
-func (p *Protocol) SetClient() {
-	p.client = api.Init(service, true)
-	_, err := p.client.CreateSession()
+// Sets up per-account sessions and authenticates the default account
+//
+// Accounts without a stored service use the entryway or PDS at s.
+func (p *Protocol) SetSessions(ctx context.Context, s string) error {
+	sessions, err := NewSessions(s, true)
 
 	if err != nil {
+		return err
+	}
+
+	p.sessions = sessions
+	p.commands = NewCommands(p.sessions, true)
+
+	if _, err := p.sessions.Client(ctx, ""); err != nil {
 		log.Errorf("unable to set session: %s", err.Error())
 	}
+
+	return nil
 }
 
 // Protocol constructor
-func protocol(p int, b int) *Protocol {
+func protocol(ctx context.Context, p int, b int, s string) (*Protocol, error) {
 	pr := Protocol{}
 	pr.SetAddress(p)
 	pr.SetHeartRate(b)
 	pr.SetListener()
 	pr.SetLogger(nil)
-	pr.SetClient()
 
-	return &pr
+	if err := pr.SetSessions(ctx, s); err != nil {
+		return nil, err
+	}
+
+	pr.dests, _ = Destinations(nil, pr.commands, nil)
+
+	return &pr, nil
 }
 
 // Run tcp listener
@@ -202,9 +291,48 @@ func run(ctx *cli.Context) error {
 	port := ctx.Int("port")
 	beat := ctx.Int("beat")
 
-	p := protocol(port, beat)
+	sctx, stop := signal.NotifyContext(ctx.Context, os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	if err := p.listen(); err != nil {
+	p, err := protocol(sctx, port, beat, ctx.String("service"))
+
+	if err != nil {
+		return err
+	}
+
+	var dryRun io.Writer
+
+	if ctx.Bool("dry-run") {
+		dryRun = os.Stdout
+		p.sessions.SetDryRun(dryRun)
+	}
+
+	if specs := ctx.StringSlice("publish"); len(specs) > 0 {
+		if p.dests, err = Destinations(specs, p.commands, dryRun); err != nil {
+			return err
+		}
+	}
+
+	if every := ctx.Duration("mentions"); every > 0 {
+		m := NewMentionPoller(p.sessions, p.commands, ctx.String("account"), every)
+		m.SetRateLimit(ctx.Int("mention-limit"), time.Hour)
+
+		go m.Run(sctx)
+	}
+
+	if every := ctx.Duration("messages"); every > 0 {
+		m := NewMessagePoller(p.sessions, p.commands, ctx.String("account"), every)
+		m.SetRateLimit(ctx.Int("message-limit"), time.Hour)
+
+		go m.Run(sctx)
+	}
+
+	if every := ctx.Duration("metrics"); every > 0 {
+		window := ctx.Duration("metrics-window")
+		go metricsCollector(p.sessions, ctx.String("account"), every, window).Run(sctx)
+	}
+
+	if err := p.listen(sctx); err != nil {
 		log.Errorf("protocol issue: %s", err.Error())
 		return err
 	}
@@ -231,6 +359,44 @@ func RunServer(p int) *cli.Command {
 				Name:  "debug",
 				Value: false,
 			},
+			serviceFlag(),
+			&cli.DurationFlag{
+				Name:  "mentions",
+				Usage: "poll for mentions asking for quotes this often, e.g. 1m (off when 0)",
+			},
+			&cli.IntFlag{
+				Name:  "mention-limit",
+				Value: 3,
+				Usage: "replies per author per hour",
+			},
+			&cli.DurationFlag{
+				Name:  "messages",
+				Usage: "poll direct messages this often, e.g. 30s (off when 0)",
+			},
+			&cli.IntFlag{
+				Name:  "message-limit",
+				Value: 10,
+				Usage: "direct message answers per sender per hour",
+			},
+			&cli.DurationFlag{
+				Name:  "metrics",
+				Usage: "snapshot engagement of recent posts this often, e.g. 1h (off when 0)",
+			},
+			&cli.DurationFlag{
+				Name:  "metrics-window",
+				Value: metricsWindow,
+				Usage: "only snapshot posts published this recently",
+			},
+			dryRunFlag(),
+			&cli.StringSliceFlag{
+				Name: "publish",
+				Usage: "publish messages to bluesky, stdout, jsonl:<path> or mastodon " +
+					"(repeatable, bluesky when omitted)",
+			},
+			&cli.StringFlag{
+				Name:  "account",
+				Usage: "account whose mentions & messages are answered, the default when omitted",
+			},
 		},
 		Action: run,
 	}
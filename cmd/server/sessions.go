@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/desertthunder/quotesky/lib/api"
+	"github.com/desertthunder/quotesky/lib/db"
+)
+
+// Authenticated clients keyed by handle
+//
+// Each account keeps a single session, created the first time a message is
+// routed to it. The empty handle is the default account, which falls back
+// to BLUESKY_HANDLE & BLUESKY_PASSWORD when none is stored.
+type Sessions struct {
+	mu      sync.Mutex
+	clients map[string]*api.Client
+	apps    *db.AppRepository
+	service string
+	dbg     bool
+	// Set on every client so posts are printed rather than sent
+	dryRun io.Writer
+}
+
+// Sessions constructor
+func NewSessions(s string, dbg bool) (*Sessions, error) {
+	apps, err := db.InitAppRepo(dbg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Sessions{
+		clients: map[string]*api.Client{},
+		apps:    apps,
+		service: s,
+		dbg:     dbg,
+	}, nil
+}
+
+// Client for handle h, or the default account when h is empty
+//
+// h may also be a DID. One that isn't stored is taken to be the environment
+// account's, whose writes fail if it isn't.
+func (s *Sessions) Client(ctx context.Context, h string) (*api.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if strings.HasPrefix(h, "did:") {
+		app, err := s.apps.GetByDID(h)
+
+		switch {
+		case err == nil:
+			h = app.Handle
+		case errors.Is(err, sql.ErrNoRows):
+			h = ""
+		default:
+			return nil, err
+		}
+	}
+
+	if h == "" {
+		if app, err := s.apps.GetDefault(); err == nil {
+			h = app.Handle
+		}
+	}
+
+	if c, ok := s.clients[h]; ok {
+		return c, nil
+	}
+
+	c, err := s.login(ctx, h)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c.DryRun = s.dryRun
+	s.clients[h] = c
+
+	return c, nil
+}
+
+// Uses c for handle h instead of signing in
+func (s *Sessions) Use(h string, c *api.Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c.DryRun = s.dryRun
+	s.clients[h] = c
+}
+
+// Prints procedure calls to w instead of sending them, on every session
+func (s *Sessions) SetDryRun(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.dryRun = w
+
+	for _, c := range s.clients {
+		c.DryRun = w
+	}
+}
+
+// Creates a session for a stored account or the environment credentials
+func (s *Sessions) login(ctx context.Context, h string) (*api.Client, error) {
+	if h == "" {
+		c := api.Init(s.service, s.dbg)
+		_, err := c.CreateSession(ctx)
+
+		return c, err
+	}
+
+	app, err := s.apps.GetByHandle(h)
+
+	if err != nil {
+		return nil, fmt.Errorf("unknown account %s: %w", h, err)
+	}
+
+	// OAuth accounts have no password, their stored tokens are refreshed instead
+	if app.AuthServer != "" {
+		return s.resume(ctx, app)
+	}
+
+	c := accountClient(app, s.service, s.dbg)
+	sess, err := c.CreateSession(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.apps.SetSession(h, sess.Did, sess.GetServiceEndpoint(), sess.AccessJwt, sess.RefreshJwt)
+
+	if err != nil {
+		c.Log.Warnf("unable to store session for %s: %s", h, err.Error())
+	}
+
+	storeSession(s.apps, h, c)
+
+	return c, nil
+}
+
+// Resumes the OAuth session stored for app
+func (s *Sessions) resume(ctx context.Context, app *db.App) (*api.Client, error) {
+	if app.Token == "" {
+		return nil, fmt.Errorf("%s is signed out, run qsky login --oauth", app.Handle)
+	}
+
+	c, err := StoredClient(s.apps, app)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := c.GetSession(ctx); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Unauthenticated client for a stored account
+//
+// The account's own service wins over s.
+func accountClient(app *db.App, s string, dbg bool) *api.Client {
+	if app.Service != "" {
+		s = app.Service
+	}
+
+	c := api.Init(s, dbg)
+	c.Credentials.Handle = app.Handle
+	c.Credentials.Password = app.Password
+	c.Gates = api.Gates{Replies: api.ParseReplyRules(app.ReplyRules), NoQuotes: app.NoQuotes}
+
+	return c
+}
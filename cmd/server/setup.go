@@ -1,6 +1,8 @@
 package server
 
 import (
+	"strings"
+
 	"github.com/charmbracelet/log"
 	"github.com/desertthunder/quotesky/lib/api"
 	"github.com/desertthunder/quotesky/lib/db"
@@ -9,15 +11,45 @@ import (
 )
 
 const dir string = "lib/db/migrations"
-const service string = "https://bsky.social"
 const env_path string = ".env"
 
+// Entryway or PDS url shared by commands that talk to a server
+//
+// Read in each action so BLUESKY_SERVICE can come from the .env file.
+func serviceFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "service",
+		Usage: "entryway or PDS url (defaults to BLUESKY_SERVICE or " + api.DefaultService + ")",
+	}
+}
+
+// Logs what the server reports about itself
+func describe(ctx *cli.Context, c *api.Client) error {
+	d, err := c.DescribeServer(ctx.Context)
+
+	if err != nil {
+		log.Errorf("%s is not a usable atproto server: %s", c.Service, err.Error())
+		return err
+	}
+
+	log.Infof("server %s (%s)", c.Service, d.DID)
+	log.Infof("available user domains: %s", strings.Join(d.AvailableUserDomains, ", "))
+	log.Infof("invite code required: %t", d.InviteCodeRequired)
+
+	if d.PhoneVerificationRequired {
+		log.Info("phone verification required")
+	}
+
+	return nil
+}
+
 func Setup() *cli.Command {
 	return &cli.Command{
 		Name:      "setup",
 		Usage:     "create the local store & authenticate",
 		UsageText: `Create the database.`,
 		Aliases:   []string{"s"},
+		Flags:     []cli.Flag{serviceFlag(), authFactorFlag()},
 		Action: func(ctx *cli.Context) error {
 			err := utils.LoadEnv(env_path)
 
@@ -34,21 +66,25 @@ func Setup() *cli.Command {
 				return err
 			}
 
-			c := api.Init(service, true)
-			a := db.InitAppRepo(true)
-			s, err := c.CreateSession()
+			c := api.Init(ctx.String("service"), true)
+
+			if err := describe(ctx, c); err != nil {
+				return err
+			}
+
+			a, err := db.InitAppRepo(true)
 
 			if err != nil {
 				return err
 			}
 
-			err = a.CreateOrUpdate(s.Handle, s.AccessJwt)
+			s, err := authenticate(ctx, c)
 
 			if err != nil {
 				return err
 			}
 
-			return nil
+			return saveAccount(a, s.Handle, c.Credentials.Password, c.Service, s, true)
 		},
 	}
 }
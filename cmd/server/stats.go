@@ -0,0 +1,244 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/desertthunder/quotesky/lib/api"
+	"github.com/desertthunder/quotesky/lib/db"
+	"github.com/desertthunder/quotesky/lib/utils"
+	"github.com/urfave/cli/v2"
+)
+
+// Posts older than this stop being collected by default
+const metricsWindow time.Duration = 30 * 24 * time.Hour
+
+// Snapshots engagement counts for every post published since t
+//
+// Returns the number of posts collected; deleted posts are skipped.
+func collectMetrics(
+	ctx context.Context, c *api.Client, h *db.HistoryRepository, since time.Time,
+) (int, error) {
+	posts, err := h.Since(since)
+
+	if err != nil {
+		return 0, err
+	}
+
+	ids := map[string]int{}
+
+	for _, p := range posts {
+		ids[p.URI] = p.ID
+	}
+
+	metrics := map[int]db.Metrics{}
+
+	for len(posts) > 0 {
+		n := min(len(posts), api.MaxGetPosts)
+		uris := []string{}
+
+		for _, p := range posts[:n] {
+			uris = append(uris, p.URI)
+		}
+
+		views, err := c.GetPosts(ctx, uris)
+
+		if err != nil {
+			return 0, err
+		}
+
+		for _, v := range views {
+			metrics[ids[v.URI]] = db.Metrics{
+				Likes:   v.LikeCount,
+				Reposts: v.RepostCount,
+				Replies: v.ReplyCount,
+				Quotes:  v.QuoteCount,
+			}
+		}
+
+		posts = posts[n:]
+	}
+
+	return len(metrics), h.AddSnapshots(metrics, time.Now())
+}
+
+// Snapshots engagement of recent posts on an interval
+type MetricsCollector struct {
+	sessions *Sessions
+	history  *db.HistoryRepository
+	account  string
+	interval time.Duration
+	window   time.Duration
+	logger   *log.Logger
+}
+
+// MetricsCollector constructor
+//
+// Only posts published within window are snapshotted.
+func metricsCollector(
+	s *Sessions, account string, every time.Duration, window time.Duration,
+) *MetricsCollector {
+	return &MetricsCollector{
+		sessions: s,
+		history:  db.InitHistoryRepo(false),
+		account:  account,
+		interval: every,
+		window:   window,
+		logger:   log.NewWithOptions(os.Stderr, utils.Options("Metrics 📈", false)),
+	}
+}
+
+// Collects every interval until ctx is cancelled
+func (m *MetricsCollector) Run(ctx context.Context) {
+	t := time.NewTicker(m.interval)
+	defer t.Stop()
+
+	m.logger.Infof("collecting engagement every %s", m.interval)
+
+	for {
+		if err := m.collect(ctx); err != nil && ctx.Err() == nil {
+			m.logger.Errorf("unable to collect engagement: %s", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (m *MetricsCollector) collect(ctx context.Context) error {
+	c, err := m.sessions.Client(ctx, m.account)
+
+	if err != nil {
+		return err
+	}
+
+	n, err := collectMetrics(ctx, c, m.history, time.Now().Add(-m.window))
+
+	if err != nil {
+		return err
+	}
+
+	m.logger.Debugf("collected engagement for %d posts", n)
+
+	return nil
+}
+
+func printRanked(w *tabwriter.Writer, title string, rows []db.Ranked) {
+	fmt.Fprintf(w, "\n%s\tPOSTS\tAVG ENGAGEMENT\n", title)
+
+	for _, r := range rows {
+		key := strings.Join(strings.Fields(r.Key), " ")
+
+		if k := []rune(key); len(k) > 60 {
+			key = string(k[:59]) + "…"
+		}
+
+		fmt.Fprintf(w, "%s\t%d\t%.1f\n", key, r.Posts, r.Engagement)
+	}
+}
+
+func printReport(r db.Report) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "%d posts with engagement data\n", r.Posts)
+
+	printRanked(w, "TOP QUOTES", r.TopQuotes)
+	printRanked(w, "HOUR", r.Hours)
+	printRanked(w, "WEEKDAY", r.Weekdays)
+	printRanked(w, "TAG", r.Tags)
+
+	fmt.Fprintln(w, "\nAGE\tPOSTS\tSHARE OF ENGAGEMENT")
+
+	for _, d := range r.Decay {
+		fmt.Fprintf(w, "%dh\t%d\t%.0f%%\n", d.Hours, d.Posts, d.Share*100)
+	}
+
+	return w.Flush()
+}
+
+// stats Command definition
+func Stats() *cli.Command {
+	return &cli.Command{
+		Name:  "stats",
+		Usage: "report which quotes, hours, weekdays & tags get engagement",
+		Flags: []cli.Flag{
+			accountFlag(),
+			serviceFlag(),
+			authFactorFlag(),
+			&cli.BoolFlag{
+				Name:  "collect",
+				Usage: "snapshot engagement counts before reporting",
+			},
+			&cli.DurationFlag{
+				Name:  "window",
+				Value: metricsWindow,
+				Usage: "only posts published this recently",
+			},
+			&cli.IntFlag{Name: "top", Aliases: []string{"n"}, Value: 10},
+			&cli.StringFlag{
+				Name:    "format",
+				Aliases: []string{"f"},
+				Value:   "table",
+				Usage:   "table or json",
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			h := db.InitHistoryRepo(false)
+			since := time.Now().Add(-ctx.Duration("window"))
+
+			if ctx.Bool("collect") {
+				if err := utils.LoadEnv(env_path); err != nil {
+					log.Warnf("continuing without %s", env_path)
+				}
+
+				c, err := sessionClient(ctx)
+
+				if err != nil {
+					return err
+				}
+
+				n, err := collectMetrics(ctx.Context, c, h, since)
+
+				if err != nil {
+					return err
+				}
+
+				log.Infof("collected engagement for %d posts", n)
+			}
+
+			posts, err := h.Since(since)
+
+			if err != nil {
+				return err
+			}
+
+			snaps, err := h.Snapshots(since)
+
+			if err != nil {
+				return err
+			}
+
+			r := db.BuildReport(posts, snaps, ctx.Int("top"))
+
+			switch ctx.String("format") {
+			case "json":
+				e := json.NewEncoder(os.Stdout)
+				e.SetIndent("", "  ")
+
+				return e.Encode(r)
+			case "table":
+				return printReport(r)
+			}
+
+			return fmt.Errorf("unknown format %s", ctx.String("format"))
+		},
+	}
+}
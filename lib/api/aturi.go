@@ -0,0 +1,79 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Parsed at:// URI
+//
+// https://atproto.com/specs/at-uri-scheme
+type ATURI struct {
+	Authority  string
+	Collection string
+	Rkey       string
+}
+
+func (u ATURI) String() string {
+	s := fmt.Sprintf("at://%s", u.Authority)
+
+	if u.Collection != "" {
+		s = fmt.Sprintf("%s/%s", s, u.Collection)
+	}
+
+	if u.Rkey != "" {
+		s = fmt.Sprintf("%s/%s", s, u.Rkey)
+	}
+
+	return s
+}
+
+// Splits an at:// URI into authority, collection and record key
+func ParseATURI(s string) (*ATURI, error) {
+	if !strings.HasPrefix(s, "at://") {
+		return nil, fmt.Errorf("invalid at-uri: %s", s)
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(s, "at://"), "/", 3)
+
+	if parts[0] == "" {
+		return nil, fmt.Errorf("at-uri missing authority: %s", s)
+	}
+
+	u := ATURI{Authority: parts[0]}
+
+	if len(parts) > 1 {
+		u.Collection = parts[1]
+	}
+
+	if len(parts) > 2 {
+		u.Rkey = parts[2]
+	}
+
+	return &u, nil
+}
+
+// Parses a post at-uri or its https://bsky.app/profile/<actor>/post/<rkey> link
+func ParsePostURI(s string) (*ATURI, error) {
+	if rest, ok := strings.CutPrefix(s, "https://bsky.app/profile/"); ok {
+		actor, rkey, _ := strings.Cut(rest, "/post/")
+
+		if actor == "" || rkey == "" || strings.Contains(rkey, "/") {
+			return nil, fmt.Errorf("invalid post link: %s", s)
+		}
+
+		return &ATURI{Authority: actor, Collection: PostType, Rkey: rkey}, nil
+	}
+
+	u, err := ParseATURI(s)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Collection != PostType || u.Rkey == "" {
+		return nil, fmt.Errorf("%s is not a post", s)
+	}
+
+	return u, nil
+}
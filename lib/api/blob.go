@@ -0,0 +1,48 @@
+// Blob uploads
+package api
+
+import (
+	"context"
+	"net/http"
+)
+
+const uploadBlob string = "com.atproto.repo.uploadBlob"
+
+type Link struct {
+	Link string `json:"$link"`
+}
+
+// Reference to an uploaded blob, embedded in records that use it
+type Blob struct {
+	Type     string `json:"$type"`
+	Ref      Link   `json:"ref"`
+	MimeType string `json:"mimeType"`
+	Size     int    `json:"size"`
+}
+
+// Uploads data to the account's PDS
+//
+// The blob is only kept once a record references it.
+func (c Client) UploadBlob(ctx context.Context, data []byte, mime string) (*Blob, error) {
+	if mime == "" {
+		mime = http.DetectContentType(data)
+	}
+
+	in := &rawBody{Data: data, MimeType: mime, Size: len(data)}
+	r := struct {
+		Blob Blob `json:"blob"`
+	}{}
+
+	if err := c.xrpc(ctx, http.MethodPost, uploadBlob, nil, in, &r); err != nil {
+		return nil, err
+	}
+
+	// Nothing was sent, so the reference is computed locally
+	if c.DryRun != nil {
+		r.Blob = Blob{"blob", Link{NewCID(codecRaw, data).String()}, mime, len(data)}
+	}
+
+	c.Log.Infof("uploaded %d byte %s blob %s", r.Blob.Size, r.Blob.MimeType, r.Blob.Ref.Link)
+
+	return &r.Blob, nil
+}
@@ -0,0 +1,316 @@
+// CAR archives & repository trees
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Largest block accepted in a CAR file
+const maxBlockSize uint64 = 2 << 20
+
+// Content-addressed archive (CARv1) of DAG-CBOR and raw blocks
+//
+// https://ipld.io/specs/transport/car/carv1/
+type CAR struct {
+	Roots  []CID
+	blocks map[string][]byte
+}
+
+// Reads a CAR file, checking every block against its CID
+func ReadCAR(r io.Reader) (*CAR, error) {
+	br := bufio.NewReader(r)
+	header, err := readSection(br)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to read car header: %w", err)
+	}
+
+	v, err := UnmarshalDAGCBOR(header)
+
+	if err != nil {
+		return nil, err
+	}
+
+	h, _ := v.(map[string]any)
+
+	if h["version"] != int64(1) {
+		return nil, fmt.Errorf("unsupported car version %v", h["version"])
+	}
+
+	car := CAR{blocks: map[string][]byte{}}
+	roots, _ := h["roots"].([]any)
+
+	for _, root := range roots {
+		c, ok := root.(CID)
+
+		if !ok {
+			return nil, fmt.Errorf("car root %v isn't a cid", root)
+		}
+
+		car.Roots = append(car.Roots, c)
+	}
+
+	for {
+		section, err := readSection(br)
+
+		if errors.Is(err, io.EOF) {
+			return &car, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		c, data, err := splitBlock(section)
+
+		if err != nil {
+			return nil, err
+		}
+
+		car.blocks[string(c)] = data
+	}
+}
+
+// Reads a varint length prefixed section
+func readSection(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if n > maxBlockSize {
+		return nil, fmt.Errorf("car section of %d bytes is too large", n)
+	}
+
+	b := make([]byte, n)
+
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Separates a section into its CIDv1 and block, verifying sha-256 digests
+func splitBlock(section []byte) (CID, []byte, error) {
+	r := bytes.NewReader(section)
+	fields := make([]uint64, 4)
+
+	// version, codec, hash function & digest length
+	for i := range fields {
+		v, err := binary.ReadUvarint(r)
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("malformed block cid: %w", err)
+		}
+
+		fields[i] = v
+	}
+
+	if fields[0] != uint64(cidVersion) {
+		return nil, nil, fmt.Errorf("unsupported cid version %d", fields[0])
+	}
+
+	end := len(section) - r.Len() + int(fields[3])
+
+	if fields[3] > uint64(r.Len()) {
+		return nil, nil, fmt.Errorf("block cid is truncated")
+	}
+
+	c, data := CID(section[:end]), section[end:]
+
+	if fields[2] == uint64(hashSHA256) {
+		sum := sha256.Sum256(data)
+
+		if !bytes.Equal(sum[:], section[end-int(fields[3]):end]) {
+			return nil, nil, fmt.Errorf("block %s doesn't match its cid", c)
+		}
+	}
+
+	return c, data, nil
+}
+
+// Raw block for c
+func (car *CAR) Block(c CID) ([]byte, bool) {
+	b, ok := car.blocks[string(c)]
+
+	return b, ok
+}
+
+// Decodes the DAG-CBOR block for c
+func (car *CAR) Decode(c CID) (any, error) {
+	b, ok := car.Block(c)
+
+	if !ok {
+		return nil, fmt.Errorf("block %s is missing", c)
+	}
+
+	return UnmarshalDAGCBOR(b)
+}
+
+// Signed repository commit
+type Commit struct {
+	DID     string
+	Version int64
+	Rev     string
+	// Root of the record tree
+	Data CID
+}
+
+// Record in a repository, keyed by collection and rkey
+type RepoRecord struct {
+	Collection string
+	Rkey       string
+	CID        CID
+	Value      any
+}
+
+// Commit the archive's first root points to
+func (car *CAR) Commit() (*Commit, error) {
+	if len(car.Roots) == 0 {
+		return nil, fmt.Errorf("car has no root")
+	}
+
+	v, err := car.Decode(car.Roots[0])
+
+	if err != nil {
+		return nil, err
+	}
+
+	m, _ := v.(map[string]any)
+	c := Commit{}
+	c.DID, _ = m["did"].(string)
+	c.Version, _ = m["version"].(int64)
+	c.Rev, _ = m["rev"].(string)
+	c.Data, _ = m["data"].(CID)
+
+	if c.DID == "" || c.Data == nil {
+		return nil, fmt.Errorf("root %s isn't a repo commit", car.Roots[0])
+	}
+
+	return &c, nil
+}
+
+// Every record in the repository, in key order
+//
+// Walks the commit's Merkle search tree, whose entries store their keys
+// as suffixes of the previous key in the node.
+//
+// https://atproto.com/specs/repository
+func (car *CAR) Records() ([]RepoRecord, error) {
+	c, err := car.Commit()
+
+	if err != nil {
+		return nil, err
+	}
+
+	records := []RepoRecord{}
+
+	err = car.walk(c.Data, func(key string, v CID) error {
+		collection, rkey, ok := strings.Cut(key, "/")
+
+		if !ok {
+			return fmt.Errorf("malformed record key %s", key)
+		}
+
+		value, err := car.Decode(v)
+
+		if err != nil {
+			return err
+		}
+
+		records = append(records, RepoRecord{collection, rkey, v, value})
+
+		return nil
+	}, 0)
+
+	return records, err
+}
+
+func (car *CAR) walk(node CID, visit func(key string, v CID) error, depth int) error {
+	if depth > maxCBORDepth {
+		return fmt.Errorf("repo tree is too deep")
+	}
+
+	v, err := car.Decode(node)
+
+	if err != nil {
+		return err
+	}
+
+	m, ok := v.(map[string]any)
+
+	if !ok {
+		return fmt.Errorf("tree node %s isn't a map", node)
+	}
+
+	if l, ok := m["l"].(CID); ok {
+		if err := car.walk(l, visit, depth+1); err != nil {
+			return err
+		}
+	}
+
+	entries, _ := m["e"].([]any)
+	key := []byte{}
+
+	for _, item := range entries {
+		e, _ := item.(map[string]any)
+		p, _ := e["p"].(int64)
+		suffix, _ := e["k"].([]byte)
+		value, ok := e["v"].(CID)
+
+		if p < 0 || int(p) > len(key) || !ok {
+			return fmt.Errorf("malformed entry in tree node %s", node)
+		}
+
+		key = append(key[:p:p], suffix...)
+
+		if err := visit(string(key), value); err != nil {
+			return err
+		}
+
+		if t, ok := e["t"].(CID); ok {
+			if err := car.walk(t, visit, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Blob CIDs a record references, including legacy {cid, mimeType} blobs
+func BlobRefs(v any) []string {
+	refs := []string{}
+
+	switch t := v.(type) {
+	case map[string]any:
+		if t["$type"] == "blob" {
+			if ref, ok := t["ref"].(CID); ok {
+				return append(refs, ref.String())
+			}
+		}
+
+		if c, ok := t["cid"].(string); ok && t["mimeType"] != nil {
+			return append(refs, c)
+		}
+
+		for _, item := range t {
+			refs = append(refs, BlobRefs(item)...)
+		}
+	case []any:
+		for _, item := range t {
+			refs = append(refs, BlobRefs(item)...)
+		}
+	}
+
+	return refs
+}
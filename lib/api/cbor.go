@@ -0,0 +1,372 @@
+// DAG-CBOR encoding of atproto data
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+const cborTagCID uint64 = 42
+
+// Encodes a JSON-serializable record as DAG-CBOR
+//
+// Values go through their JSON form first so the bytes match the record
+// the PDS stores. Objects of the form {"$link": cid} become CID links and
+// {"$bytes": b64} become byte strings, per the atproto data model.
+//
+// https://atproto.com/specs/data-model
+func MarshalDAGCBOR(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+
+	var generic any
+
+	if err := d.Decode(&generic); err != nil {
+		return nil, err
+	}
+
+	buf := bytes.Buffer{}
+
+	if err := encodeCBOR(&buf, generic); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func encodeCBOR(b *bytes.Buffer, v any) error {
+	switch t := v.(type) {
+	case nil:
+		b.WriteByte(0xf6)
+	case bool:
+		if t {
+			b.WriteByte(0xf5)
+		} else {
+			b.WriteByte(0xf4)
+		}
+	case json.Number:
+		i, err := t.Int64()
+
+		if err != nil {
+			return fmt.Errorf("dag-cbor only supports integers, got %s", t.String())
+		}
+
+		if i < 0 {
+			writeCBORHead(b, 1, uint64(-1-i))
+		} else {
+			writeCBORHead(b, 0, uint64(i))
+		}
+	case string:
+		writeCBORHead(b, 3, uint64(len(t)))
+		b.WriteString(t)
+	case []any:
+		writeCBORHead(b, 4, uint64(len(t)))
+
+		for _, item := range t {
+			if err := encodeCBOR(b, item); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		return encodeCBORMap(b, t)
+	default:
+		return fmt.Errorf("unsupported dag-cbor value %T", v)
+	}
+
+	return nil
+}
+
+func encodeCBORMap(b *bytes.Buffer, m map[string]any) error {
+	if link, ok := m["$link"].(string); ok && len(m) == 1 {
+		c, err := ParseCID(link)
+
+		if err != nil {
+			return err
+		}
+
+		writeCBORHead(b, 6, cborTagCID)
+		writeCBORHead(b, 2, uint64(len(c)+1))
+		b.WriteByte(0x00)
+		b.Write(c)
+
+		return nil
+	}
+
+	if raw, ok := m["$bytes"].(string); ok && len(m) == 1 {
+		data, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(raw, "="))
+
+		if err != nil {
+			return err
+		}
+
+		writeCBORHead(b, 2, uint64(len(data)))
+		b.Write(data)
+
+		return nil
+	}
+
+	keys := make([]string, 0, len(m))
+
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	// DAG-CBOR canonical order: shorter keys first, then bytewise
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) < len(keys[j])
+		}
+
+		return keys[i] < keys[j]
+	})
+
+	writeCBORHead(b, 5, uint64(len(keys)))
+
+	for _, k := range keys {
+		writeCBORHead(b, 3, uint64(len(k)))
+		b.WriteString(k)
+
+		if err := encodeCBOR(b, m[k]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Writes a major type and argument using the shortest encoding
+func writeCBORHead(b *bytes.Buffer, major byte, n uint64) {
+	m := major << 5
+
+	switch {
+	case n < 24:
+		b.WriteByte(m | byte(n))
+	case n <= math.MaxUint8:
+		b.WriteByte(m | 24)
+		b.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		b.WriteByte(m | 25)
+		b.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+	case n <= math.MaxUint32:
+		b.WriteByte(m | 26)
+		b.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+	default:
+		b.WriteByte(m | 27)
+		b.Write(binary.BigEndian.AppendUint64(nil, n))
+	}
+}
+
+// Deepest nesting a decoded value may have
+const maxCBORDepth int = 128
+
+// Decodes a single DAG-CBOR value
+//
+// Maps decode to map[string]any, integers to int64, byte strings to []byte
+// and CID links to CID.
+func UnmarshalDAGCBOR(data []byte) (any, error) {
+	d := cborDecoder{data: data}
+	v, err := d.value(0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if d.pos != len(data) {
+		return nil, fmt.Errorf("%d trailing bytes after dag-cbor value", len(data)-d.pos)
+	}
+
+	return v, nil
+}
+
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *cborDecoder) take(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, fmt.Errorf("dag-cbor value is truncated")
+	}
+
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+
+	return b, nil
+}
+
+// Reads a major type and its argument
+func (d *cborDecoder) head() (byte, uint64, byte, error) {
+	b, err := d.take(1)
+
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	major, info := b[0]>>5, b[0]&0x1f
+
+	if info < 24 {
+		return major, uint64(info), info, nil
+	}
+
+	if info > 27 {
+		return 0, 0, 0, fmt.Errorf("unsupported dag-cbor argument %d", info)
+	}
+
+	arg, err := d.take(1 << (info - 24))
+
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	n := uint64(0)
+
+	for _, c := range arg {
+		n = n<<8 | uint64(c)
+	}
+
+	return major, n, info, nil
+}
+
+func (d *cborDecoder) value(depth int) (any, error) {
+	if depth > maxCBORDepth {
+		return nil, fmt.Errorf("dag-cbor value nested too deeply")
+	}
+
+	major, n, info, err := d.head()
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case 0:
+		if n > math.MaxInt64 {
+			return nil, fmt.Errorf("dag-cbor integer %d overflows", n)
+		}
+
+		return int64(n), nil
+	case 1:
+		if n > math.MaxInt64 {
+			return nil, fmt.Errorf("dag-cbor integer -%d overflows", n)
+		}
+
+		return -1 - int64(n), nil
+	case 2:
+		b, err := d.take(n)
+
+		return bytes.Clone(b), err
+	case 3:
+		b, err := d.take(n)
+
+		return string(b), err
+	case 4:
+		items := []any{}
+
+		for range n {
+			v, err := d.value(depth + 1)
+
+			if err != nil {
+				return nil, err
+			}
+
+			items = append(items, v)
+		}
+
+		return items, nil
+	case 5:
+		m := map[string]any{}
+
+		for range n {
+			k, err := d.value(depth + 1)
+
+			if err != nil {
+				return nil, err
+			}
+
+			key, ok := k.(string)
+
+			if !ok {
+				return nil, fmt.Errorf("dag-cbor map keys must be strings, got %T", k)
+			}
+
+			if m[key], err = d.value(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+
+		return m, nil
+	case 6:
+		if n != cborTagCID {
+			return nil, fmt.Errorf("unsupported dag-cbor tag %d", n)
+		}
+
+		v, err := d.value(depth + 1)
+
+		if err != nil {
+			return nil, err
+		}
+
+		b, ok := v.([]byte)
+
+		if !ok || len(b) < 2 || b[0] != 0x00 {
+			return nil, fmt.Errorf("malformed cid link")
+		}
+
+		return CID(b[1:]), nil
+	}
+
+	switch {
+	case info == 20:
+		return false, nil
+	case info == 21:
+		return true, nil
+	case info == 22:
+		return nil, nil
+	case info == 27:
+		return math.Float64frombits(n), nil
+	}
+
+	return nil, fmt.Errorf("unsupported dag-cbor simple value %d", info)
+}
+
+// Converts a decoded value to its JSON form
+//
+// CID links become {"$link": cid} and byte strings {"$bytes": b64}.
+func JSONValue(v any) any {
+	switch t := v.(type) {
+	case CID:
+		return map[string]any{"$link": t.String()}
+	case []byte:
+		return map[string]any{"$bytes": base64.RawStdEncoding.EncodeToString(t)}
+	case []any:
+		out := make([]any, len(t))
+
+		for i := range t {
+			out[i] = JSONValue(t[i])
+		}
+
+		return out
+	case map[string]any:
+		out := make(map[string]any, len(t))
+
+		for k, item := range t {
+			out[k] = JSONValue(item)
+		}
+
+		return out
+	}
+
+	return v
+}
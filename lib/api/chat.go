@@ -0,0 +1,141 @@
+// Direct messages
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Bluesky chat service the PDS proxies chat.bsky.* requests to
+const ChatProxy string = "did:web:api.bsky.chat#bsky_chat"
+
+const listConvos string = "chat.bsky.convo.listConvos"
+const getMessages string = "chat.bsky.convo.getMessages"
+const sendMessage string = "chat.bsky.convo.sendMessage"
+const updateRead string = "chat.bsky.convo.updateRead"
+const messageViewType string = "chat.bsky.convo.defs#messageView"
+
+// Longest direct message the chat service accepts, in graphemes
+const MaxMessageLength int = 1000
+
+// Client for chat.bsky.convo, proxied through the account's PDS
+type ChatClient struct {
+	client Client
+}
+
+// Chat client using the same session, proxying to the Bluesky chat service
+func (c Client) Chat() *ChatClient {
+	c.proxy = ChatProxy
+
+	return &ChatClient{client: c}
+}
+
+type ConvoView struct {
+	ID          string             `json:"id"`
+	Rev         string             `json:"rev"`
+	Members     []ProfileViewBasic `json:"members"`
+	UnreadCount int                `json:"unreadCount"`
+	Muted       bool               `json:"muted"`
+}
+
+type Convos struct {
+	Cursor string      `json:"cursor,omitempty"`
+	Convos []ConvoView `json:"convos"`
+}
+
+type MessageSender struct {
+	DID string `json:"did"`
+}
+
+// A message, or a deleted message when Type says so
+type MessageView struct {
+	Type   string        `json:"$type"`
+	ID     string        `json:"id"`
+	Rev    string        `json:"rev"`
+	Text   string        `json:"text"`
+	Sender MessageSender `json:"sender"`
+	SentAt string        `json:"sentAt"`
+}
+
+func (m MessageView) Deleted() bool {
+	return m.Type != "" && m.Type != messageViewType
+}
+
+// Page of chat.bsky.convo.getMessages, newest first
+type Messages struct {
+	Cursor   string        `json:"cursor,omitempty"`
+	Messages []MessageView `json:"messages"`
+}
+
+func (cc ChatClient) ListConvos(ctx context.Context, limit int, cursor string) (*Convos, error) {
+	params := url.Values{}
+
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+
+	if cursor != "" {
+		params.Set("cursor", cursor)
+	}
+
+	c := Convos{}
+
+	if err := cc.client.xrpc(ctx, http.MethodGet, listConvos, params, nil, &c); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+func (cc ChatClient) GetMessages(
+	ctx context.Context, convoID string, limit int, cursor string,
+) (*Messages, error) {
+	params := url.Values{}
+	params.Set("convoId", convoID)
+
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+
+	if cursor != "" {
+		params.Set("cursor", cursor)
+	}
+
+	m := Messages{}
+
+	if err := cc.client.xrpc(ctx, http.MethodGet, getMessages, params, nil, &m); err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+func (cc ChatClient) SendMessage(
+	ctx context.Context, convoID string, text string,
+) (*MessageView, error) {
+	body := map[string]any{
+		"convoId": convoID,
+		"message": map[string]string{"text": text},
+	}
+
+	m := MessageView{}
+
+	if err := cc.client.xrpc(ctx, http.MethodPost, sendMessage, nil, body, &m); err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+// Marks the conversation read up to messageID, or entirely when empty
+func (cc ChatClient) UpdateRead(ctx context.Context, convoID string, messageID string) error {
+	body := map[string]string{"convoId": convoID}
+
+	if messageID != "" {
+		body["messageId"] = messageID
+	}
+
+	return cc.client.xrpc(ctx, http.MethodPost, updateRead, nil, body, nil)
+}
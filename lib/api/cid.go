@@ -0,0 +1,57 @@
+// Content identifiers
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"strings"
+)
+
+const cidVersion byte = 0x01
+const codecDAGCBOR byte = 0x71
+const codecRaw byte = 0x55
+const hashSHA256 byte = 0x12
+
+var cidEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Binary CID (version, codec & multihash)
+type CID []byte
+
+// Multibase base32 form used in JSON, e.g. bafyrei...
+func (c CID) String() string {
+	return "b" + strings.ToLower(cidEncoding.EncodeToString(c))
+}
+
+// Computes the CIDv1 of data with the given codec and a sha-256 multihash
+func NewCID(codec byte, data []byte) CID {
+	sum := sha256.Sum256(data)
+
+	return append(CID{cidVersion, codec, hashSHA256, byte(len(sum))}, sum[:]...)
+}
+
+// CID of a record as the PDS will store it
+func RecordCID(v any) (string, error) {
+	data, err := MarshalDAGCBOR(v)
+
+	if err != nil {
+		return "", err
+	}
+
+	return NewCID(codecDAGCBOR, data).String(), nil
+}
+
+// Decodes the base32 string form of a CIDv1
+func ParseCID(s string) (CID, error) {
+	if !strings.HasPrefix(s, "b") {
+		return nil, fmt.Errorf("unsupported cid multibase: %s", s)
+	}
+
+	data, err := cidEncoding.DecodeString(strings.ToUpper(s[1:]))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return CID(data), nil
+}
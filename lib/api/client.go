@@ -2,32 +2,49 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/charmbracelet/log"
 	"github.com/desertthunder/quotesky/lib/utils"
 )
 
+const DefaultService string = "https://bsky.social"
 const createSession string = "com.atproto.server.createSession"
 const createPost string = "com.atproto.repo.createRecord"
+const defaultTimeout time.Duration = 30 * time.Second
+
+// Returned by CreateSession when the account has email 2FA enabled and
+// no token, or an expired one, was sent
+var ErrAuthFactorTokenRequired = errors.New("email auth factor token required")
 
 type SessionRequest struct {
-	Identifier string `json:"identifier"`
-	Password   string `json:"password"`
+	Identifier      string `json:"identifier"`
+	Password        string `json:"password"`
+	AuthFactorToken string `json:"authFactorToken,omitempty"`
 }
 
 type Credentials struct {
 	Handle          string
 	Password        string
+	AuthFactorToken string
 	AccessToken     string
 	RefreshToken    string
 	DID             string
 	ServiceEndpoint string
+	// Held while an expired session is renewed
+	mu sync.Mutex
+	// Guards the tokens and endpoint, which renewals replace mid-request
+	lock sync.RWMutex
 }
 
 type Service struct {
@@ -64,14 +81,85 @@ type Session struct {
 	Status          string `json:"status"`
 }
 
+// Commit metadata returned from repo writes
+type CommitMeta struct {
+	CID string `json:"cid"`
+	Rev string `json:"rev"`
+}
+
+// Result of a createRecord call
+type PostResult struct {
+	URI    string     `json:"uri"`
+	CID    string     `json:"cid"`
+	Rkey   string     `json:"rkey"`
+	Commit CommitMeta `json:"commit"`
+	// Every part, root first, when the message was split into a thread
+	Thread []PostResult `json:"thread,omitempty"`
+}
+
+// Build the bsky.app link for the created post
+func (r PostResult) WebURL() string {
+	u, err := ParseATURI(r.URI)
+
+	if err != nil {
+		return ""
+	}
+
+	return fmt.Sprintf("https://bsky.app/profile/%s/post/%s", u.Authority, u.Rkey)
+}
+
+// Error body returned by xrpc endpoints
+type XRPCError struct {
+	StatusCode int    `json:"-"`
+	Name       string `json:"error"`
+	Message    string `json:"message"`
+}
+
+func (e XRPCError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("xrpc %d: %s", e.StatusCode, e.Name)
+	}
+
+	return fmt.Sprintf("xrpc %d: %s: %s", e.StatusCode, e.Name, e.Message)
+}
+
+// Builds an XRPCError from a non-2xx response body
+func parseXRPCError(status int, body []byte) error {
+	e := XRPCError{StatusCode: status}
+
+	if err := json.Unmarshal(body, &e); err != nil || e.Name == "" {
+		e.Name = http.StatusText(status)
+	}
+
+	return e
+}
+
+// PDS endpoint from the session's DID document, empty when absent
 func (s Session) GetServiceEndpoint() string {
-	return s.DidDoc.Service[0].ServiceEndpoint
+	endpoint, _ := s.DidDoc.PDSEndpoint()
+
+	return endpoint
 }
 
 type Client struct {
 	Service     string
 	Credentials *Credentials
 	Log         *log.Logger
+	Limiter     *Limiter
+	MaxRetries  int
+	HTTP        *http.Client
+	UserAgent   string
+	Resolver    *Resolver
+	// Interaction settings for messages that don't set their own
+	Gates Gates
+	// Procedures are written here instead of sent when set, reads still go out
+	DryRun io.Writer
+	// Signs requests with DPoP-bound OAuth tokens instead of Bearer tokens
+	OAuth *OAuthSession
+	// Called with the new tokens after an expired password session is renewed
+	OnSession func(Session)
+	// Service the PDS should proxy requests to, sent as atproto-proxy
+	proxy string
 }
 
 func credentials() *Credentials {
@@ -79,46 +167,192 @@ func credentials() *Credentials {
 	password := os.Getenv("BLUESKY_PASSWORD")
 
 	return &Credentials{
-		Handle:   handle,
-		Password: password,
+		Handle:          handle,
+		Password:        password,
+		AuthFactorToken: os.Getenv("BLUESKY_AUTH_FACTOR_TOKEN"),
 	}
 }
 
 func (c *Credentials) SetSession(s Session) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
 	c.AccessToken = s.AccessJwt
 	c.RefreshToken = s.RefreshJwt
-	c.DID = s.Did
 	c.ServiceEndpoint = s.GetServiceEndpoint()
+
+	// Renewals keep the DID, so requests reading it don't race them
+	if c.DID != s.Did {
+		c.DID = s.Did
+	}
+}
+
+// Current access and refresh tokens
+func (c *Credentials) Tokens() (string, string) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.AccessToken, c.RefreshToken
+}
+
+func (c *Credentials) setTokens(access string, refresh string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.AccessToken, c.RefreshToken = access, refresh
+}
+
+// PDS requests are sent to
+func (c *Credentials) endpoint() string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.ServiceEndpoint
+}
+
+func (c *Credentials) setEndpoint(e string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.ServiceEndpoint = e
 }
 
 func (c Client) buildURL(service string, path string) string {
 	return fmt.Sprintf("%s/xrpc/%s", service, path)
 }
 
-func (c Client) CreateSession() (*Session, error) {
+// Sets the Authorization header for token, DPoP-bound for OAuth sessions
+func (c Client) authorize(req *http.Request, token string) {
+	if token == "" {
+		return
+	}
+
+	if c.OAuth != nil {
+		req.Header.Set("Authorization", fmt.Sprintf("DPoP %s", token))
+		return
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+}
+
+// Signs a DPoP-authorized request with a fresh proof
+//
+// Reports whether req was signed.
+func (c Client) signDPoP(req *http.Request) (bool, error) {
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "DPoP ")
+
+	if c.OAuth == nil || !ok {
+		return false, nil
+	}
+
+	return true, c.OAuth.DPoP.Sign(req, token)
+}
+
+// Sends req through the shared limiter
+//
+// Retries 429 and 5xx responses with exponential backoff until MaxRetries
+// is reached or the request context's deadline would be exceeded. DPoP
+// requests get a new proof per attempt and are resent once when the server
+// asks for a nonce.
+func (c Client) do(req *http.Request) (*http.Response, []byte, error) {
+	ctx := req.Context()
+
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+
+	nonced := false
+
+	for attempt := 0; ; attempt++ {
+		if c.Limiter != nil {
+			if err := c.Limiter.Wait(ctx); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		if attempt > 0 && req.GetBody != nil {
+			b, err := req.GetBody()
+
+			if err != nil {
+				return nil, nil, err
+			}
+
+			req.Body = b
+		}
+
+		signed, err := c.signDPoP(req)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		res, err := c.HTTP.Do(req)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if rl, ok := ParseRateLimit(res.Header); ok && c.Limiter != nil {
+			c.Limiter.Update(rl)
+		}
+
+		if signed && c.OAuth.DPoP.Observe(res, body) && !nonced {
+			nonced = true
+			continue
+		}
+
+		if !retryable(res.StatusCode) || attempt >= c.MaxRetries {
+			return res, body, nil
+		}
+
+		d := retryDelay(res, attempt)
+		c.Log.Warnf("%s returned %s, retrying in %s", req.URL.Path, res.Status, d)
+
+		if err := sleep(ctx, d); err != nil {
+			return res, body, err
+		}
+	}
+}
+
+func (c Client) CreateSession(ctx context.Context) (*Session, error) {
 	uri := c.buildURL(c.Service, createSession)
-	r := SessionRequest{c.Credentials.Handle, c.Credentials.Password}
-	req, err := json.Marshal(r)
+	r := SessionRequest{c.Credentials.Handle, c.Credentials.Password, c.Credentials.AuthFactorToken}
+	data, err := json.Marshal(r)
 
 	if err != nil {
 		c.Log.Errorf("unable to build body: %s", err.Error())
 		return nil, err
 	}
 
-	req_body := bytes.NewBuffer(req)
-	rsp, err := http.Post(uri, "application/json", req_body)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, bytes.NewBuffer(data))
 
 	if err != nil {
-		c.Log.Errorf("unable to authenticate: %s", err.Error())
 		return nil, err
 	}
 
-	defer rsp.Body.Close()
+	req.Header.Set("Content-Type", "application/json")
 
-	rspBody, err := io.ReadAll(rsp.Body)
+	rsp, rspBody, err := c.do(req)
 
 	if err != nil {
-		c.Log.Errorf("unable to read response %s", err.Error())
+		c.Log.Errorf("unable to authenticate: %s", err.Error())
+		return nil, err
+	}
+
+	if rsp.StatusCode != http.StatusOK {
+		err := parseXRPCError(rsp.StatusCode, rspBody)
+
+		if e, ok := err.(XRPCError); ok && e.Name == "AuthFactorTokenRequired" {
+			return nil, fmt.Errorf("%w: %s", ErrAuthFactorTokenRequired, e.Message)
+		}
+
 		return nil, err
 	}
 
@@ -133,59 +367,276 @@ func (c Client) CreateSession() (*Session, error) {
 	c.Log.Infof("session created at %s", time.Now().Format("03:04 PM on 01/02/2006"))
 	c.Credentials.SetSession(s)
 
+	if c.Credentials.endpoint() == "" {
+		c.Credentials.setEndpoint(c.discoverPDS(ctx, s.Did))
+	}
+
 	return &s, nil
 }
 
+// Resolves the PDS for did, falling back to the entryway
+func (c Client) discoverPDS(ctx context.Context, did string) string {
+	if c.Resolver != nil {
+		endpoint, err := c.Resolver.PDSEndpoint(ctx, did)
+
+		if err == nil {
+			return endpoint
+		}
+
+		c.Log.Warnf("unable to resolve pds for %s: %s", did, err.Error())
+	}
+
+	return c.Service
+}
+
+// Client constructor
+//
+// An empty service falls back to BLUESKY_SERVICE, then DefaultService.
 func Init(s string, dbg bool) *Client {
+	h := &http.Client{Timeout: defaultTimeout}
+
+	if s == "" {
+		s = os.Getenv("BLUESKY_SERVICE")
+	}
+
+	if s == "" {
+		s = DefaultService
+	}
+
 	return &Client{
-		Service:     s,
+		Service:     strings.TrimSuffix(s, "/"),
 		Credentials: credentials(),
 		Log:         log.NewWithOptions(os.Stderr, utils.Options("Client 🌎", dbg)),
+		Limiter:     NewLimiter(defaultInterval),
+		MaxRetries:  defaultRetries,
+		HTTP:        h,
+		Resolver:    NewResolver(os.Getenv("PLC_DIRECTORY"), h),
+		UserAgent:   fmt.Sprintf("quotesky/%s", utils.Get()),
 	}
 }
 
 func (c Client) SerializePost(p *PostRecord) []byte {
-	d := BuildPostRequest(c.Credentials.DID, "app.bsky.feed.post", *p)
+	d := BuildPostRequest(c.Credentials.DID, PostType, *p)
 	j, _ := json.Marshal(d)
 
 	return j
 }
 
-func (c Client) CreatePost(m Message) error {
-	p := BuildPost(m)
-	data := c.SerializePost(p)
-	uri := c.buildURL(c.Credentials.ServiceEndpoint, createPost)
+// Body sent or received as is rather than as JSON
+//
+// A dry run prints its type and size only.
+type rawBody struct {
+	Data     []byte `json:"-"`
+	MimeType string `json:"mimeType"`
+	Size     int    `json:"size"`
+}
+
+// Makes an authenticated xrpc call against the session's PDS
+//
+// in is sent as the JSON body when non-nil and the response is decoded
+// into out when non-nil, either may be a *rawBody to skip the encoding.
+// Procedures are only printed in a dry run.
+func (c Client) xrpc(
+	ctx context.Context, method string, nsid string, params url.Values, in any, out any,
+) error {
+	if c.DryRun != nil && method == http.MethodPost {
+		return c.dryRun(nsid, in)
+	}
 
-	c.Log.Debugf("creating post: %s to %s", string(data), uri)
+	token, refresh := c.Credentials.Tokens()
+	err := c.call(ctx, c.Credentials.endpoint(), token, method, nsid, params, in, out)
 
-	req, err := http.NewRequest(http.MethodPost, uri, bytes.NewBuffer(data))
+	// OAuth access tokens are short lived, so they're refreshed on demand
+	if c.OAuth != nil && isOAuthExpired(err) {
+		if _, err := c.refreshOAuth(ctx, token); err != nil {
+			return err
+		}
+
+		return c.retry(ctx, method, nsid, params, in, out)
+	}
+
+	if c.OAuth == nil && IsExpiredToken(err) && refresh != "" {
+		if err := c.renewSession(ctx, token); err != nil {
+			return err
+		}
+
+		return c.retry(ctx, method, nsid, params, in, out)
+	}
+
+	return err
+}
+
+// Repeats an xrpc call with the renewed session
+func (c Client) retry(
+	ctx context.Context, method string, nsid string, params url.Values, in any, out any,
+) error {
+	token, _ := c.Credentials.Tokens()
+
+	return c.call(ctx, c.Credentials.endpoint(), token, method, nsid, params, in, out)
+}
+
+// Makes an xrpc call against host, authenticated when token is set
+func (c Client) call(
+	ctx context.Context, host string, token string,
+	method string, nsid string, params url.Values, in any, out any,
+) error {
+	uri := c.buildURL(host, nsid)
+
+	if len(params) > 0 {
+		uri = fmt.Sprintf("%s?%s", uri, params.Encode())
+	}
+
+	var body io.Reader
+
+	contentType := "application/json"
+
+	if raw, ok := in.(*rawBody); ok {
+		body = bytes.NewReader(raw.Data)
+		contentType = raw.MimeType
+	} else if in != nil {
+		data, err := json.Marshal(in)
+
+		if err != nil {
+			return err
+		}
+
+		c.Log.Debugf("%s %s: %s", method, nsid, string(data))
+		body = bytes.NewBuffer(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, uri, body)
 
 	if err != nil {
 		return err
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.Credentials.AccessToken))
-	req.Header.Set("Content-Type", "application/json")
+	c.authorize(req, token)
 
-	res, err := http.DefaultClient.Do(req)
+	if c.proxy != "" {
+		req.Header.Set("atproto-proxy", c.proxy)
+	}
 
-	c.Log.Debug(res.Status)
+	if in != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	res, rspBody, err := c.do(req)
 
 	if err != nil {
 		c.Log.Error(err.Error())
 		return err
 	}
 
-	defer res.Body.Close()
+	c.Log.Debugf("%s %s", nsid, res.Status)
+
+	if res.StatusCode != http.StatusOK {
+		return parseXRPCError(res.StatusCode, rspBody)
+	}
+
+	if raw, ok := out.(*rawBody); ok {
+		raw.Data = rspBody
+		raw.MimeType = res.Header.Get("Content-Type")
+		raw.Size = len(rspBody)
+
+		return nil
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.Unmarshal(rspBody, out)
+}
+
+// Creates the post with a client-generated TID record key
+//
+// The record key is fixed before the first attempt so retries of the same
+// message conflict with the original write, which is treated as success.
+//
+// Messages too long for a single post, or with a threadgate or postgate, are
+// published through applyWrites so that either every record lands or none do.
+//
+// With DryRun set the request is printed and the post's reference computed.
+func (c Client) CreatePost(ctx context.Context, m Message) (*PostResult, error) {
+	if err := ValidateLangs(m.Langs); err != nil {
+		return nil, err
+	}
+
+	if err := ValidateLabels(m.Labels); err != nil {
+		return nil, err
+	}
+
+	g := c.Gates
+
+	if m.Gates != nil {
+		g = *m.Gates
+	}
+
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+
+	posts := BuildThread(m, MaxPostLength)
+
+	// Gates have to land in the same commit as the post
+	if len(posts) > 1 || !g.IsZero() {
+		return c.createThread(ctx, posts, m.Rkey, g)
+	}
+
+	p := &posts[0]
+	rkey := m.Rkey
+
+	if rkey == "" {
+		rkey = NewTID()
+	}
 
-	rspBody, err := io.ReadAll(res.Body)
+	d := BuildPostRequest(c.Credentials.DID, PostType, *p)
+	d.Rkey = rkey
+
+	r := PostResult{}
+	err := c.xrpc(ctx, http.MethodPost, createPost, nil, d, &r)
+
+	if isConflict(err) {
+		c.Log.Warnf("post %s already exists, treating as created", rkey)
+		return c.existingPost(ctx, rkey)
+	}
 
 	if err != nil {
-		c.Log.Error(err.Error())
-		return err
+		return nil, err
+	}
+
+	// Nothing was sent, so the reference is computed locally
+	if c.DryRun != nil {
+		r.URI = ATURI{c.Credentials.DID, PostType, rkey}.String()
+
+		if r.CID, err = RecordCID(*p); err != nil {
+			return nil, err
+		}
+	}
+
+	r.Rkey = rkey
+
+	c.Log.Infof("created post %s", r.URI)
+
+	return &r, nil
+}
+
+// Looks up a post that a previous attempt already wrote
+func (c Client) existingPost(ctx context.Context, rkey string) (*PostResult, error) {
+	rec, err := c.GetRecord(ctx, c.Credentials.DID, PostType, rkey)
+
+	if err != nil {
+		return nil, err
 	}
 
-	c.Log.Debug(string(rspBody))
+	return &PostResult{URI: rec.URI, CID: rec.CID, Rkey: rkey}, nil
+}
+
+// Reports whether err means the record key is already taken
+//
+// Goes by the status and error name only, messages aren't part of the lexicon.
+func isConflict(err error) bool {
+	e, ok := err.(XRPCError)
 
-	return nil
+	return ok && (e.StatusCode == http.StatusConflict || e.Name == "RecordAlreadyExists")
 }
@@ -0,0 +1,187 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const dpopNonceHeader string = "DPoP-Nonce"
+const useDPoPNonce string = "use_dpop_nonce"
+
+// DPoP proof signer (RFC 9449) with an ES256 key
+//
+// Servers may demand a nonce in their proofs; the latest one each origin
+// sent is kept and included in later proofs.
+type DPoP struct {
+	Key    *ecdsa.PrivateKey
+	mu     sync.Mutex
+	nonces map[string]string
+}
+
+// DPoP constructor with a new P-256 key
+func NewDPoP() (*DPoP, error) {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &DPoP{Key: k, nonces: map[string]string{}}, nil
+}
+
+// DPoP signer for a key from Encode
+func ParseDPoP(s string) (*DPoP, error) {
+	der, err := base64.StdEncoding.DecodeString(s)
+
+	if err != nil {
+		return nil, err
+	}
+
+	k, err := x509.ParseECPrivateKey(der)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &DPoP{Key: k, nonces: map[string]string{}}, nil
+}
+
+// Private key as base64 DER, for storage
+func (d *DPoP) Encode() (string, error) {
+	der, err := x509.MarshalECPrivateKey(d.Key)
+
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(der), nil
+}
+
+// Public key as a JWK
+func (d *DPoP) JWK() map[string]string {
+	return map[string]string{
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   b64(d.Key.X.FillBytes(make([]byte, 32))),
+		"y":   b64(d.Key.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func origin(u *url.URL) string {
+	return u.Scheme + "://" + u.Host
+}
+
+// Proof for a request to uri, bound to token when it is set
+func (d *DPoP) Proof(method string, uri *url.URL, token string) (string, error) {
+	jti := make([]byte, 16)
+
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+
+	claims := map[string]any{
+		"jti": b64(jti),
+		"htm": method,
+		"htu": origin(uri) + uri.EscapedPath(),
+		"iat": time.Now().Unix(),
+	}
+
+	d.mu.Lock()
+	nonce := d.nonces[origin(uri)]
+	d.mu.Unlock()
+
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+
+	if token != "" {
+		h := sha256.Sum256([]byte(token))
+		claims["ath"] = b64(h[:])
+	}
+
+	header := map[string]any{"typ": "dpop+jwt", "alg": "ES256", "jwk": d.JWK()}
+
+	return d.sign(header, claims)
+}
+
+// Compact ES256 JWS over header and claims
+func (d *DPoP) sign(header any, claims any) (string, error) {
+	h, err := json.Marshal(header)
+
+	if err != nil {
+		return "", err
+	}
+
+	c, err := json.Marshal(claims)
+
+	if err != nil {
+		return "", err
+	}
+
+	input := b64(h) + "." + b64(c)
+	sum := sha256.Sum256([]byte(input))
+	r, s, err := ecdsa.Sign(rand.Reader, d.Key, sum[:])
+
+	if err != nil {
+		return "", err
+	}
+
+	sig := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+
+	return input + "." + b64(sig), nil
+}
+
+// Sets the DPoP header on req, bound to token when it is set
+func (d *DPoP) Sign(req *http.Request, token string) error {
+	p, err := d.Proof(req.Method, req.URL, token)
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("DPoP", p)
+
+	return nil
+}
+
+// Keeps the nonce res carries
+//
+// Reports whether the server rejected the request for a missing or stale
+// nonce, in which case it should be sent again with a fresh proof.
+func (d *DPoP) Observe(res *http.Response, body []byte) bool {
+	nonce := res.Header.Get(dpopNonceHeader)
+
+	if nonce == "" || res.Request == nil {
+		return false
+	}
+
+	d.mu.Lock()
+	d.nonces[origin(res.Request.URL)] = nonce
+	d.mu.Unlock()
+
+	switch res.StatusCode {
+	case http.StatusUnauthorized:
+		return strings.Contains(res.Header.Get("WWW-Authenticate"), useDPoPNonce)
+	case http.StatusBadRequest:
+		e := OAuthError{}
+		json.Unmarshal(body, &e)
+
+		return e.Name == useDPoPNonce
+	}
+
+	return false
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Procedure call a dry run printed instead of sending
+type DryRunRequest struct {
+	Method string          `json:"method"`
+	NSID   string          `json:"nsid"`
+	Input  json.RawMessage `json:"input,omitempty"`
+}
+
+// Writes the call to c.DryRun as a single JSON line
+func (c Client) dryRun(nsid string, in any) error {
+	r := DryRunRequest{Method: http.MethodPost, NSID: nsid}
+
+	if in != nil {
+		data, err := json.Marshal(in)
+
+		if err != nil {
+			return err
+		}
+
+		r.Input = data
+	}
+
+	data, err := json.Marshal(r)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = c.DryRun.Write(append(data, '\n'))
+
+	return err
+}
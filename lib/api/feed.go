@@ -0,0 +1,115 @@
+// Feed reads
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const getAuthorFeed string = "app.bsky.feed.getAuthorFeed"
+const reasonRepost string = "app.bsky.feed.defs#reasonRepost"
+
+// Author feed filters accepted by app.bsky.feed.getAuthorFeed
+const (
+	FilterPostsWithReplies string = "posts_with_replies"
+	FilterPostsNoReplies   string = "posts_no_replies"
+	FilterPostsWithMedia   string = "posts_with_media"
+	FilterPostsAndThreads  string = "posts_and_author_threads"
+)
+
+type ProfileViewBasic struct {
+	DID         string `json:"did"`
+	Handle      string `json:"handle"`
+	DisplayName string `json:"displayName,omitempty"`
+}
+
+// Requesting account's relationship to a post
+type PostViewerState struct {
+	Like   string `json:"like,omitempty"`
+	Repost string `json:"repost,omitempty"`
+}
+
+// Hydrated post from the app view
+type PostView struct {
+	URI         string           `json:"uri"`
+	CID         string           `json:"cid"`
+	Author      ProfileViewBasic `json:"author"`
+	Record      json.RawMessage  `json:"record"`
+	ReplyCount  int              `json:"replyCount"`
+	RepostCount int              `json:"repostCount"`
+	LikeCount   int              `json:"likeCount"`
+	QuoteCount  int              `json:"quoteCount"`
+	IndexedAt   string           `json:"indexedAt"`
+	Viewer      *PostViewerState `json:"viewer,omitempty"`
+}
+
+// Decodes the post record
+func (p PostView) Post() (*PostRecord, error) {
+	r := PostRecord{}
+
+	if err := json.Unmarshal(p.Record, &r); err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+type FeedReason struct {
+	Type      string           `json:"$type"`
+	By        ProfileViewBasic `json:"by"`
+	IndexedAt string           `json:"indexedAt"`
+}
+
+type FeedViewPost struct {
+	Post   PostView        `json:"post"`
+	Reply  json.RawMessage `json:"reply,omitempty"`
+	Reason *FeedReason     `json:"reason,omitempty"`
+}
+
+func (f FeedViewPost) IsRepost() bool {
+	return f.Reason != nil && f.Reason.Type == reasonRepost
+}
+
+func (f FeedViewPost) IsReply() bool {
+	return len(f.Reply) > 0
+}
+
+// Page of app.bsky.feed.getAuthorFeed
+type AuthorFeed struct {
+	Cursor string         `json:"cursor,omitempty"`
+	Feed   []FeedViewPost `json:"feed"`
+}
+
+// Fetches a page of actor's posts and reposts, newest first
+//
+// Pass the previous page's Cursor to continue; an empty cursor in the
+// response means there are no more pages.
+func (c Client) GetAuthorFeed(
+	ctx context.Context, actor string, filter string, limit int, cursor string,
+) (*AuthorFeed, error) {
+	params := url.Values{}
+	params.Set("actor", actor)
+
+	if filter != "" {
+		params.Set("filter", filter)
+	}
+
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+
+	if cursor != "" {
+		params.Set("cursor", cursor)
+	}
+
+	f := AuthorFeed{}
+
+	if err := c.xrpc(ctx, http.MethodGet, getAuthorFeed, params, nil, &f); err != nil {
+		return nil, err
+	}
+
+	return &f, nil
+}
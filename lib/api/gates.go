@@ -0,0 +1,143 @@
+// Threadgates & postgates
+package api
+
+import (
+	"fmt"
+	"strings"
+)
+
+const ThreadgateType string = "app.bsky.feed.threadgate"
+const PostgateType string = "app.bsky.feed.postgate"
+
+// Reply rules, besides the at-uris of lists whose members may reply
+const (
+	ReplyEveryone  string = "everyone"
+	ReplyNobody    string = "nobody"
+	ReplyMentioned string = "mentioned"
+	ReplyFollowers string = "followers"
+	ReplyFollowing string = "following"
+)
+
+var replyRuleTypes = map[string]string{
+	ReplyMentioned: ThreadgateType + "#mentionRule",
+	ReplyFollowers: ThreadgateType + "#followerRule",
+	ReplyFollowing: ThreadgateType + "#followingRule",
+}
+
+// Who may interact with a post
+type Gates struct {
+	// Reply rules or list at-uris; empty or "everyone" leaves replies open
+	Replies []string
+	// Stops other accounts from quoting the post
+	NoQuotes bool
+}
+
+// Splits comma separated reply rules
+func ParseReplyRules(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' })
+}
+
+// Reports whether replies are restricted
+func (g Gates) Threadgated() bool {
+	for _, r := range g.Replies {
+		if r == ReplyEveryone {
+			return false
+		}
+	}
+
+	return len(g.Replies) > 0
+}
+
+// Reports whether the post needs a threadgate or postgate at all
+func (g Gates) IsZero() bool {
+	return !g.Threadgated() && !g.NoQuotes
+}
+
+func (g Gates) Validate() error {
+	for _, r := range g.Replies {
+		_, known := replyRuleTypes[r]
+
+		switch {
+		case known:
+		case r == ReplyEveryone || r == ReplyNobody:
+			if len(g.Replies) > 1 {
+				return fmt.Errorf("%s can't be combined with other reply rules", r)
+			}
+		case strings.HasPrefix(r, "at://"):
+			u, err := ParseATURI(r)
+
+			if err != nil {
+				return err
+			}
+
+			if u.Collection != "app.bsky.graph.list" || u.Rkey == "" {
+				return fmt.Errorf("%s is not a list", r)
+			}
+		default:
+			return fmt.Errorf(
+				"unknown reply rule %q, expected everyone, nobody, mentioned, followers, "+
+					"following or a list at-uri", r,
+			)
+		}
+	}
+
+	return nil
+}
+
+type gateRule struct {
+	Type string `json:"$type"`
+	List string `json:"list,omitempty"`
+}
+
+type ThreadgateRecord struct {
+	Type string `json:"$type"`
+	Post string `json:"post"`
+	// Empty allows nobody to reply
+	Allow     []gateRule `json:"allow"`
+	CreatedAt string     `json:"createdAt"`
+}
+
+type PostgateRecord struct {
+	Type           string     `json:"$type"`
+	Post           string     `json:"post"`
+	EmbeddingRules []gateRule `json:"embeddingRules"`
+	CreatedAt      string     `json:"createdAt"`
+}
+
+// Threadgate for the post at uri
+func (g Gates) threadgate(uri string) ThreadgateRecord {
+	t := ThreadgateRecord{Type: ThreadgateType, Post: uri, Allow: []gateRule{}, CreatedAt: now()}
+
+	for _, r := range g.Replies {
+		if typ, ok := replyRuleTypes[r]; ok {
+			t.Allow = append(t.Allow, gateRule{Type: typ})
+		} else if r != ReplyNobody {
+			t.Allow = append(t.Allow, gateRule{Type: ThreadgateType + "#listRule", List: r})
+		}
+	}
+
+	return t
+}
+
+// Gate writes for a post, stored under the post's own record key
+//
+// Threadgates only apply to the root of a thread, so replies only get a
+// postgate.
+func (g Gates) writes(uri ATURI, reply bool) []WriteOp {
+	writes := []WriteOp{}
+
+	if g.Threadgated() && !reply {
+		writes = append(writes, CreateOp(ThreadgateType, uri.Rkey, g.threadgate(uri.String())))
+	}
+
+	if g.NoQuotes {
+		writes = append(writes, CreateOp(PostgateType, uri.Rkey, PostgateRecord{
+			Type:           PostgateType,
+			Post:           uri.String(),
+			EmbeddingRules: []gateRule{{Type: PostgateType + "#disableRule"}},
+			CreatedAt:      now(),
+		}))
+	}
+
+	return writes
+}
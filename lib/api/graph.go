@@ -0,0 +1,308 @@
+// Follows, likes & reposts
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const FollowType string = "app.bsky.graph.follow"
+const LikeType string = "app.bsky.feed.like"
+const RepostType string = "app.bsky.feed.repost"
+
+const resolveHandle string = "com.atproto.identity.resolveHandle"
+const getProfile string = "app.bsky.actor.getProfile"
+const getPosts string = "app.bsky.feed.getPosts"
+const deleteRecord string = "com.atproto.repo.deleteRecord"
+
+// Most uris app.bsky.feed.getPosts accepts per call
+const MaxGetPosts int = 25
+
+type FollowRecord struct {
+	Type      string `json:"$type"`
+	Subject   string `json:"subject"`
+	CreatedAt string `json:"createdAt"`
+}
+
+// Like or repost of Subject
+type SubjectRecord struct {
+	Type      string    `json:"$type"`
+	Subject   StrongRef `json:"subject"`
+	CreatedAt string    `json:"createdAt"`
+}
+
+// Requesting account's relationship to a profile
+type ProfileViewerState struct {
+	Following  string `json:"following,omitempty"`
+	FollowedBy string `json:"followedBy,omitempty"`
+}
+
+type ProfileView struct {
+	ProfileViewBasic
+	Description    string              `json:"description,omitempty"`
+	FollowersCount int                 `json:"followersCount"`
+	FollowsCount   int                 `json:"followsCount"`
+	PostsCount     int                 `json:"postsCount"`
+	Viewer         *ProfileViewerState `json:"viewer,omitempty"`
+}
+
+// Request Body for com.atproto.repo.createRecord
+type CreateRecordRequest struct {
+	Repo       string `json:"repo"`
+	Collection string `json:"collection"`
+	Rkey       string `json:"rkey,omitempty"`
+	Record     any    `json:"record"`
+}
+
+// Request Body for com.atproto.repo.deleteRecord
+type DeleteRecordRequest struct {
+	Repo       string `json:"repo"`
+	Collection string `json:"collection"`
+	Rkey       string `json:"rkey"`
+}
+
+func now() string {
+	return time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+// Resolves a handle to its did, passing dids through
+func (c Client) ResolveHandle(ctx context.Context, handle string) (string, error) {
+	handle = strings.TrimPrefix(handle, "@")
+
+	if strings.HasPrefix(handle, "did:") {
+		return handle, nil
+	}
+
+	params := url.Values{}
+	params.Set("handle", handle)
+
+	r := struct {
+		DID string `json:"did"`
+	}{}
+
+	if err := c.xrpc(ctx, http.MethodGet, resolveHandle, params, nil, &r); err != nil {
+		return "", err
+	}
+
+	return r.DID, nil
+}
+
+// Fetches a profile by handle or did
+func (c Client) GetProfile(ctx context.Context, actor string) (*ProfileView, error) {
+	params := url.Values{}
+	params.Set("actor", strings.TrimPrefix(actor, "@"))
+
+	p := ProfileView{}
+
+	if err := c.xrpc(ctx, http.MethodGet, getProfile, params, nil, &p); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// Hydrates up to MaxGetPosts posts by at-uri
+//
+// Posts that were deleted or can't be seen are left out.
+func (c Client) GetPosts(ctx context.Context, uris []string) ([]PostView, error) {
+	if len(uris) > MaxGetPosts {
+		return nil, fmt.Errorf("at most %d posts per request, got %d", MaxGetPosts, len(uris))
+	}
+
+	params := url.Values{}
+
+	for _, u := range uris {
+		params.Add("uris", u)
+	}
+
+	r := struct {
+		Posts []PostView `json:"posts"`
+	}{}
+
+	if err := c.xrpc(ctx, http.MethodGet, getPosts, params, nil, &r); err != nil {
+		return nil, err
+	}
+
+	return r.Posts, nil
+}
+
+// Fetches a single post by at-uri or bsky.app link, resolving handles
+func (c Client) getPost(ctx context.Context, uri string) (*PostView, error) {
+	u, err := ParsePostURI(uri)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Authority, err = c.ResolveHandle(ctx, u.Authority); err != nil {
+		return nil, err
+	}
+
+	posts, err := c.GetPosts(ctx, []string{u.String()})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(posts) == 0 {
+		return nil, fmt.Errorf("post %s not found", uri)
+	}
+
+	return &posts[0], nil
+}
+
+// Writes record v to the account's collection under a new TID
+func (c Client) createRecord(ctx context.Context, collection string, v any) (*PostResult, error) {
+	d := CreateRecordRequest{
+		Repo: c.Credentials.DID, Collection: collection, Rkey: NewTID(), Record: v,
+	}
+
+	r := PostResult{}
+
+	if err := c.xrpc(ctx, http.MethodPost, CreateRecord, nil, d, &r); err != nil {
+		return nil, err
+	}
+
+	r.Rkey = d.Rkey
+
+	c.Log.Infof("created %s", r.URI)
+
+	return &r, nil
+}
+
+// Deletes one of the account's records by at-uri
+func (c Client) DeleteRecord(ctx context.Context, uri string) error {
+	u, err := ParseATURI(uri)
+
+	if err != nil {
+		return err
+	}
+
+	if u.Authority != c.Credentials.DID {
+		return fmt.Errorf("%s does not belong to %s", uri, c.Credentials.DID)
+	}
+
+	d := DeleteRecordRequest{Repo: u.Authority, Collection: u.Collection, Rkey: u.Rkey}
+
+	if err := c.xrpc(ctx, http.MethodPost, deleteRecord, nil, d, nil); err != nil {
+		return err
+	}
+
+	c.Log.Infof("deleted %s", uri)
+
+	return nil
+}
+
+// Follows actor, returning the existing follow record when there is one
+func (c Client) Follow(ctx context.Context, actor string) (string, error) {
+	p, err := c.GetProfile(ctx, actor)
+
+	if err != nil {
+		return "", err
+	}
+
+	if p.Viewer != nil && p.Viewer.Following != "" {
+		return p.Viewer.Following, nil
+	}
+
+	r, err := c.createRecord(ctx, FollowType, FollowRecord{
+		Type: FollowType, Subject: p.DID, CreatedAt: now(),
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return r.URI, nil
+}
+
+// Deletes the account's follow record for actor
+func (c Client) Unfollow(ctx context.Context, actor string) (string, error) {
+	p, err := c.GetProfile(ctx, actor)
+
+	if err != nil {
+		return "", err
+	}
+
+	if p.Viewer == nil || p.Viewer.Following == "" {
+		return "", fmt.Errorf("not following %s", actor)
+	}
+
+	return p.Viewer.Following, c.DeleteRecord(ctx, p.Viewer.Following)
+}
+
+// Likes or reposts the post at uri, returning the existing record when there is one
+func (c Client) engage(ctx context.Context, collection string, uri string) (string, error) {
+	p, err := c.getPost(ctx, uri)
+
+	if err != nil {
+		return "", err
+	}
+
+	if existing := viewerRecord(p, collection); existing != "" {
+		return existing, nil
+	}
+
+	r, err := c.createRecord(ctx, collection, SubjectRecord{
+		Type: collection, Subject: StrongRef{URI: p.URI, CID: p.CID}, CreatedAt: now(),
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return r.URI, nil
+}
+
+// Deletes the account's like or repost of the post at uri
+func (c Client) disengage(ctx context.Context, collection string, uri string) (string, error) {
+	p, err := c.getPost(ctx, uri)
+
+	if err != nil {
+		return "", err
+	}
+
+	existing := viewerRecord(p, collection)
+
+	if existing == "" {
+		return "", fmt.Errorf("no %s of %s", collection, uri)
+	}
+
+	return existing, c.DeleteRecord(ctx, existing)
+}
+
+func viewerRecord(p *PostView, collection string) string {
+	if p.Viewer == nil {
+		return ""
+	}
+
+	if collection == RepostType {
+		return p.Viewer.Repost
+	}
+
+	return p.Viewer.Like
+}
+
+// Likes the post at uri
+func (c Client) Like(ctx context.Context, uri string) (string, error) {
+	return c.engage(ctx, LikeType, uri)
+}
+
+// Removes the like of the post at uri
+func (c Client) Unlike(ctx context.Context, uri string) (string, error) {
+	return c.disengage(ctx, LikeType, uri)
+}
+
+// Reposts the post at uri
+func (c Client) Repost(ctx context.Context, uri string) (string, error) {
+	return c.engage(ctx, RepostType, uri)
+}
+
+// Removes the repost of the post at uri
+func (c Client) Unrepost(ctx context.Context, uri string) (string, error) {
+	return c.disengage(ctx, RepostType, uri)
+}
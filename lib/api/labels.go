@@ -0,0 +1,59 @@
+// Self-labels for content warnings
+package api
+
+import (
+	"fmt"
+	"strings"
+)
+
+const selfLabelsType string = "com.atproto.label.defs#selfLabels"
+
+// Label values an account may put on its own posts
+var SelfLabelValues = []string{"!no-unauthenticated", "porn", "sexual", "nudity", "graphic-media"}
+
+type SelfLabel struct {
+	Val string `json:"val"`
+}
+
+type SelfLabels struct {
+	Type   string      `json:"$type"`
+	Values []SelfLabel `json:"values"`
+}
+
+// Checks labels against SelfLabelValues
+func ValidateLabels(labels []string) error {
+	for _, l := range labels {
+		ok := false
+
+		for _, v := range SelfLabelValues {
+			ok = ok || l == v
+		}
+
+		if !ok {
+			return fmt.Errorf(
+				"unknown label %q, expected one of %s", l, strings.Join(SelfLabelValues, ", "),
+			)
+		}
+	}
+
+	return nil
+}
+
+// Self-labels record for labels, nil when there are none
+func BuildLabels(labels []string) *SelfLabels {
+	if len(labels) == 0 {
+		return nil
+	}
+
+	l := SelfLabels{Type: selfLabelsType, Values: []SelfLabel{}}
+	seen := map[string]bool{}
+
+	for _, v := range labels {
+		if !seen[v] {
+			seen[v] = true
+			l.Values = append(l.Values, SelfLabel{Val: v})
+		}
+	}
+
+	return &l
+}
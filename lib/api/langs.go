@@ -0,0 +1,234 @@
+// Offline language detection for post langs
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Most languages a post record may carry
+const MaxLangs int = 3
+
+var langTag = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{1,8})*$`)
+
+// Segments are detected separately so mixed-language quotes get every tag
+var segmentBreak = regexp.MustCompile(`[.!?;:\n—–"“”«»()]+`)
+
+// Common words that tell Latin script languages apart
+var stopwords = map[string][]string{
+	"en": strings.Fields("the and is are of to in that it you not with be for was what " +
+		"have this but who your all we they when i am my me"),
+	"es": strings.Fields("el la los las de que y es en no un una por con para lo se del " +
+		"como más pero su sin muy"),
+	"fr": strings.Fields("le la les de des et est un une que qui pas ne je vous dans pour " +
+		"sur ce il elle au du"),
+	"de": strings.Fields("der die das und ist nicht ein eine zu ich du mit sich auf den dem " +
+		"wer was auch es sie"),
+	"it": strings.Fields("il lo la gli le di che e è non un una per con sono del della chi " +
+		"come più ma nel"),
+	"pt": strings.Fields("o a os as de que e é não um uma para com do da em se mais por " +
+		"como mas você"),
+	"nl": strings.Fields("de het een en is van niet dat die ik je op te zijn met voor wat " +
+		"wie maar ook"),
+}
+
+// Letters that only (or mostly) occur in one Latin script language
+var distinctive = map[rune]string{
+	'ñ': "es", '¿': "es", '¡': "es",
+	'ã': "pt", 'õ': "pt",
+	'ß': "de", 'ä': "de", 'ö': "de", 'ü': "de",
+	'ç': "fr", 'œ': "fr", 'ê': "fr", 'û': "fr",
+}
+
+// Order ties between Latin script languages are broken in
+var latinLangs = []string{"en", "es", "fr", "de", "it", "pt", "nl"}
+
+var stopwordIndex = func() map[string][]string {
+	idx := map[string][]string{}
+
+	for _, l := range latinLangs {
+		for _, w := range stopwords[l] {
+			idx[w] = append(idx[w], l)
+		}
+	}
+
+	return idx
+}()
+
+// Checks explicit langs against the lexicon's limits
+func ValidateLangs(langs []string) error {
+	if len(langs) > MaxLangs {
+		return fmt.Errorf("at most %d langs allowed, got %d", MaxLangs, len(langs))
+	}
+
+	for _, l := range langs {
+		if !langTag.MatchString(l) {
+			return fmt.Errorf("%q is not a BCP-47 language tag", l)
+		}
+	}
+
+	return nil
+}
+
+// Guesses up to MaxLangs languages of text, most prominent first
+//
+// Scripts like Cyrillic or Hangul identify the language directly, Latin text
+// is scored against stopwords. Returns nil when nothing is recognised.
+func DetectLangs(text string) []string {
+	weights := map[string]int{}
+
+	for _, seg := range segmentBreak.Split(strings.ToLower(text), -1) {
+		if l, n := detectSegment(seg); l != "" {
+			weights[l] += n
+		}
+	}
+
+	langs := []string{}
+	total := 0
+
+	for l, n := range weights {
+		langs = append(langs, l)
+		total += n
+	}
+
+	sort.Slice(langs, func(i, j int) bool {
+		if weights[langs[i]] != weights[langs[j]] {
+			return weights[langs[i]] > weights[langs[j]]
+		}
+
+		return langs[i] < langs[j]
+	})
+
+	out := []string{}
+
+	// Stray words in another language don't earn it a tag
+	for _, l := range langs {
+		if len(out) < MaxLangs && weights[l]*10 >= total {
+			out = append(out, l)
+		}
+	}
+
+	if len(out) == 0 {
+		return nil
+	}
+
+	return out
+}
+
+// Language of a single lower case segment and its letter count
+func detectSegment(seg string) (string, int) {
+	scripts := map[string]int{}
+	letters := 0
+	kana := false
+
+	for _, r := range seg {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+
+		letters++
+
+		switch {
+		case unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r):
+			kana = true
+			scripts["ja"]++
+		case unicode.Is(unicode.Han, r):
+			scripts["zh"]++
+		case unicode.Is(unicode.Hangul, r):
+			scripts["ko"]++
+		case unicode.Is(unicode.Cyrillic, r):
+			scripts[cyrillic(r)]++
+		case unicode.Is(unicode.Greek, r):
+			scripts["el"]++
+		case unicode.Is(unicode.Arabic, r):
+			scripts[arabic(r)]++
+		case unicode.Is(unicode.Hebrew, r):
+			scripts["he"]++
+		case unicode.Is(unicode.Devanagari, r):
+			scripts["hi"]++
+		case unicode.Is(unicode.Thai, r):
+			scripts["th"]++
+		case unicode.Is(unicode.Latin, r):
+			scripts["latin"]++
+		}
+	}
+
+	// Japanese mixes kanji with kana
+	if kana {
+		scripts["ja"] += scripts["zh"]
+		delete(scripts, "zh")
+	}
+
+	// A single Ukrainian letter marks the whole segment
+	if scripts["uk"] > 0 {
+		scripts["uk"] += scripts["ru"]
+		delete(scripts, "ru")
+	}
+
+	if scripts["fa"] > 0 {
+		scripts["fa"] += scripts["ar"]
+		delete(scripts, "ar")
+	}
+
+	best, most := "", 0
+
+	for s, n := range scripts {
+		if n > most || (n == most && s < best) {
+			best, most = s, n
+		}
+	}
+
+	if best == "latin" {
+		return latin(seg), letters
+	}
+
+	return best, letters
+}
+
+func cyrillic(r rune) string {
+	if strings.ContainsRune("іїєґ", r) {
+		return "uk"
+	}
+
+	return "ru"
+}
+
+func arabic(r rune) string {
+	if strings.ContainsRune("پچژگ", r) {
+		return "fa"
+	}
+
+	return "ar"
+}
+
+// Scores Latin script text against each language's stopwords
+func latin(seg string) string {
+	scores := map[string]int{}
+
+	for _, w := range strings.FieldsFunc(seg, func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	}) {
+		for _, l := range stopwordIndex[w] {
+			scores[l] += 2
+		}
+	}
+
+	for _, r := range seg {
+		if l, ok := distinctive[r]; ok {
+			scores[l]++
+		}
+	}
+
+	best, most := "", 1
+
+	for _, l := range latinLangs {
+		if scores[l] > most {
+			best, most = l, scores[l]
+		}
+	}
+
+	return best
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+const callbackPath string = "/callback"
+
+// Listener on 127.0.0.1 receiving the authorization server's redirect
+type Loopback struct {
+	listener net.Listener
+	queries  chan url.Values
+}
+
+// Loopback constructor, on a random port when port is 0
+func ListenLoopback(port int) (*Loopback, error) {
+	l, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Loopback{listener: l, queries: make(chan url.Values, 1)}, nil
+}
+
+// URI the authorization server redirects back to
+func (l *Loopback) RedirectURI() string {
+	return fmt.Sprintf("http://%s%s", l.listener.Addr().String(), callbackPath)
+}
+
+func (l *Loopback) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != callbackPath {
+		http.NotFound(w, r)
+		return
+	}
+
+	select {
+	case l.queries <- r.URL.Query():
+	default:
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "qsky received the authorization, you can close this window.")
+}
+
+// Waits for the redirect and returns its query parameters
+//
+// The listener is closed once the redirect arrives or ctx is done.
+func (l *Loopback) Wait(ctx context.Context) (url.Values, error) {
+	srv := &http.Server{Handler: l}
+
+	go srv.Serve(l.listener)
+	defer srv.Close()
+
+	select {
+	case q := <-l.queries:
+		return q, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,95 @@
+// Notifications
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const listNotifications string = "app.bsky.notification.listNotifications"
+const updateSeen string = "app.bsky.notification.updateSeen"
+
+// Notification reasons
+const (
+	ReasonMention string = "mention"
+	ReasonReply   string = "reply"
+	ReasonQuote   string = "quote"
+)
+
+type Notification struct {
+	URI       string           `json:"uri"`
+	CID       string           `json:"cid"`
+	Author    ProfileViewBasic `json:"author"`
+	Reason    string           `json:"reason"`
+	Record    json.RawMessage  `json:"record"`
+	IsRead    bool             `json:"isRead"`
+	IndexedAt string           `json:"indexedAt"`
+}
+
+// Decodes the post behind a mention, reply or quote notification
+func (n Notification) Post() (*PostRecord, error) {
+	r := PostRecord{}
+
+	if err := json.Unmarshal(n.Record, &r); err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// Reply reference answering the notification's post in its thread
+func (n Notification) ReplyRef() (*ReplyRef, error) {
+	p, err := n.Post()
+
+	if err != nil {
+		return nil, err
+	}
+
+	parent := StrongRef{URI: n.URI, CID: n.CID}
+	root := parent
+
+	if p.Reply != nil {
+		root = p.Reply.Root
+	}
+
+	return &ReplyRef{Root: root, Parent: parent}, nil
+}
+
+// Page of app.bsky.notification.listNotifications, newest first
+type Notifications struct {
+	Cursor        string         `json:"cursor,omitempty"`
+	Notifications []Notification `json:"notifications"`
+	SeenAt        string         `json:"seenAt,omitempty"`
+}
+
+func (c Client) ListNotifications(
+	ctx context.Context, limit int, cursor string,
+) (*Notifications, error) {
+	params := url.Values{}
+
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+
+	if cursor != "" {
+		params.Set("cursor", cursor)
+	}
+
+	n := Notifications{}
+
+	if err := c.xrpc(ctx, http.MethodGet, listNotifications, params, nil, &n); err != nil {
+		return nil, err
+	}
+
+	return &n, nil
+}
+
+// Marks notifications up to seenAt as read
+func (c Client) UpdateSeen(ctx context.Context, seenAt string) error {
+	body := map[string]string{"seenAt": seenAt}
+
+	return c.xrpc(ctx, http.MethodPost, updateSeen, nil, body, nil)
+}
@@ -0,0 +1,471 @@
+// atproto OAuth client flow
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Scope granting the same access as an app password
+const OAuthScope string = "atproto transition:generic"
+
+const protectedResourcePath string = "/.well-known/oauth-protected-resource"
+const authServerPath string = "/.well-known/oauth-authorization-server"
+
+// Error response from an authorization server
+type OAuthError struct {
+	StatusCode  int    `json:"-"`
+	Name        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e OAuthError) Error() string {
+	if e.Description == "" {
+		return fmt.Sprintf("oauth %d: %s", e.StatusCode, e.Name)
+	}
+
+	return fmt.Sprintf("oauth %d: %s: %s", e.StatusCode, e.Name, e.Description)
+}
+
+type ProtectedResource struct {
+	Resource             string   `json:"resource"`
+	AuthorizationServers []string `json:"authorization_servers"`
+}
+
+// Authorization server metadata (RFC 8414)
+type AuthServerMetadata struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	PAREndpoint           string   `json:"pushed_authorization_request_endpoint"`
+	RevocationEndpoint    string   `json:"revocation_endpoint"`
+	DPoPAlgs              []string `json:"dpop_signing_alg_values_supported"`
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+	ExpiresIn    int    `json:"expires_in"`
+	// DID of the account that authorized the client
+	Sub string `json:"sub"`
+}
+
+// DPoP-bound OAuth grant a client signs its requests with
+type OAuthSession struct {
+	Issuer   string
+	ClientID string
+	DPoP     *DPoP
+	// Called with new tokens after a refresh so they can be stored
+	OnRefresh func(TokenResponse) error
+	mu        sync.Mutex
+}
+
+// Authorization waiting for the user to approve it
+type AuthRequest struct {
+	// Page the user approves the request on
+	URL         string
+	State       string
+	Verifier    string
+	RedirectURI string
+	ClientID    string
+	// Account the user was asked to sign in as, when known
+	DID      string
+	PDS      string
+	Metadata AuthServerMetadata
+	DPoP     *DPoP
+}
+
+// Client id for a loopback client, which needs no client metadata document
+func LoopbackClientID(redirect string, scope string) string {
+	q := url.Values{"redirect_uri": {redirect}, "scope": {scope}}
+
+	return "http://localhost?" + q.Encode()
+}
+
+func random(n int) (string, error) {
+	b := make([]byte, n)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return b64(b), nil
+}
+
+// S256 PKCE challenge for verifier
+func PKCEChallenge(verifier string) string {
+	h := sha256.Sum256([]byte(verifier))
+
+	return b64(h[:])
+}
+
+func (c Client) getJSON(ctx context.Context, uri string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+
+	if err != nil {
+		return err
+	}
+
+	res, body, err := c.do(req)
+
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", uri, res.Status)
+	}
+
+	return json.Unmarshal(body, out)
+}
+
+// Metadata of the authorization server at issuer
+func (c Client) AuthServerMetadata(
+	ctx context.Context, issuer string,
+) (*AuthServerMetadata, error) {
+	m := AuthServerMetadata{}
+
+	if err := c.getJSON(ctx, strings.TrimSuffix(issuer, "/")+authServerPath, &m); err != nil {
+		return nil, err
+	}
+
+	if m.Issuer != issuer {
+		return nil, fmt.Errorf("authorization server %s claims to be %s", issuer, m.Issuer)
+	}
+
+	if m.PAREndpoint == "" || m.TokenEndpoint == "" {
+		return nil, fmt.Errorf("%s doesn't support pushed authorization requests", issuer)
+	}
+
+	return &m, nil
+}
+
+// Metadata of the authorization server protecting the PDS at pds
+func (c Client) AuthServer(ctx context.Context, pds string) (*AuthServerMetadata, error) {
+	r := ProtectedResource{}
+
+	if err := c.getJSON(ctx, strings.TrimSuffix(pds, "/")+protectedResourcePath, &r); err != nil {
+		return nil, err
+	}
+
+	if len(r.AuthorizationServers) == 0 {
+		return nil, fmt.Errorf("%s has no authorization server", pds)
+	}
+
+	return c.AuthServerMetadata(ctx, r.AuthorizationServers[0])
+}
+
+// Posts form to an authorization server endpoint with a DPoP proof
+//
+// Sent a second time when the server asks for a nonce.
+func (c Client) oauthPost(
+	ctx context.Context, d *DPoP, endpoint string, form url.Values, out any,
+) error {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(
+			ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()),
+		)
+
+		if err != nil {
+			return err
+		}
+
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		if err := d.Sign(req, ""); err != nil {
+			return err
+		}
+
+		res, body, err := c.do(req)
+
+		if err != nil {
+			return err
+		}
+
+		if d.Observe(res, body) && attempt == 0 {
+			continue
+		}
+
+		if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusCreated {
+			e := OAuthError{StatusCode: res.StatusCode}
+
+			if err := json.Unmarshal(body, &e); err != nil || e.Name == "" {
+				e.Name = http.StatusText(res.StatusCode)
+			}
+
+			return e
+		}
+
+		if out == nil {
+			return nil
+		}
+
+		return json.Unmarshal(body, out)
+	}
+}
+
+// DID for a handle, resolved by the client's service before there is a session
+func (c Client) resolveAccount(ctx context.Context, account string) (string, error) {
+	account = strings.TrimPrefix(account, "@")
+
+	if strings.HasPrefix(account, "did:") {
+		return account, nil
+	}
+
+	r := struct {
+		DID string `json:"did"`
+	}{}
+	params := url.Values{"handle": {account}}
+	err := c.call(ctx, c.Service, "", http.MethodGet, resolveHandle, params, nil, &r)
+
+	return r.DID, err
+}
+
+// Pushes an authorization request for account, a handle, DID or empty
+//
+// Without an account the user picks one on the client's service.
+// redirect is where the authorization server sends the user back to.
+func (c Client) StartOAuth(
+	ctx context.Context, account string, redirect string,
+) (*AuthRequest, error) {
+	r := AuthRequest{RedirectURI: redirect, PDS: c.Service}
+
+	if account != "" {
+		did, err := c.resolveAccount(ctx, account)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if r.PDS, err = c.Resolver.PDSEndpoint(ctx, did); err != nil {
+			return nil, err
+		}
+
+		r.DID = did
+	}
+
+	m, err := c.AuthServer(ctx, r.PDS)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if r.DPoP, err = NewDPoP(); err != nil {
+		return nil, err
+	}
+
+	if r.State, err = random(16); err != nil {
+		return nil, err
+	}
+
+	if r.Verifier, err = random(32); err != nil {
+		return nil, err
+	}
+
+	r.Metadata = *m
+	r.ClientID = LoopbackClientID(redirect, OAuthScope)
+
+	form := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {r.ClientID},
+		"redirect_uri":          {redirect},
+		"scope":                 {OAuthScope},
+		"state":                 {r.State},
+		"code_challenge":        {PKCEChallenge(r.Verifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	if account != "" {
+		form.Set("login_hint", strings.TrimPrefix(account, "@"))
+	}
+
+	par := struct {
+		RequestURI string `json:"request_uri"`
+	}{}
+
+	if err := c.oauthPost(ctx, r.DPoP, m.PAREndpoint, form, &par); err != nil {
+		return nil, err
+	}
+
+	q := url.Values{"client_id": {r.ClientID}, "request_uri": {par.RequestURI}}
+	r.URL = m.AuthorizationEndpoint + "?" + q.Encode()
+
+	return &r, nil
+}
+
+// Trades the code the authorization server redirected back with for tokens
+//
+// The account that signed in must be hosted on a PDS this authorization
+// server protects, so a server can't issue tokens for someone else's DID.
+func (c Client) FinishOAuth(
+	ctx context.Context, r *AuthRequest, q url.Values,
+) (*TokenResponse, error) {
+	if e := q.Get("error"); e != "" {
+		return nil, OAuthError{Name: e, Description: q.Get("error_description")}
+	}
+
+	if q.Get("state") != r.State {
+		return nil, fmt.Errorf("authorization state doesn't match")
+	}
+
+	if q.Get("iss") != r.Metadata.Issuer {
+		return nil, fmt.Errorf("authorization came from %s, not %s",
+			q.Get("iss"), r.Metadata.Issuer)
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {q.Get("code")},
+		"redirect_uri":  {r.RedirectURI},
+		"code_verifier": {r.Verifier},
+		"client_id":     {r.ClientID},
+	}
+
+	t := TokenResponse{}
+
+	if err := c.oauthPost(ctx, r.DPoP, r.Metadata.TokenEndpoint, form, &t); err != nil {
+		return nil, err
+	}
+
+	if !strings.EqualFold(t.TokenType, "DPoP") {
+		return nil, fmt.Errorf("expected a DPoP token, got %s", t.TokenType)
+	}
+
+	if r.DID != "" && t.Sub != r.DID {
+		return nil, fmt.Errorf("signed in as %s instead of %s", t.Sub, r.DID)
+	}
+
+	pds, err := c.Resolver.PDSEndpoint(ctx, t.Sub)
+
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := c.AuthServer(ctx, pds)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if m.Issuer != r.Metadata.Issuer {
+		return nil, fmt.Errorf("%s isn't authorized by %s", t.Sub, r.Metadata.Issuer)
+	}
+
+	r.DID, r.PDS = t.Sub, pds
+
+	return &t, nil
+}
+
+// Session for the tokens an authorization request was granted
+func (r AuthRequest) Session() *OAuthSession {
+	return &OAuthSession{Issuer: r.Metadata.Issuer, ClientID: r.ClientID, DPoP: r.DPoP}
+}
+
+// Uses t for requests to the account's PDS
+func (c Client) SetOAuthTokens(t TokenResponse, pds string) {
+	c.Credentials.DID = t.Sub
+	c.Credentials.setTokens(t.AccessToken, t.RefreshToken)
+	c.Credentials.setEndpoint(pds)
+}
+
+// Trades the refresh token for new tokens
+func (c Client) RefreshOAuth(ctx context.Context) (*TokenResponse, error) {
+	return c.refreshOAuth(ctx, "")
+}
+
+// Refreshes unless another request already replaced the stale access token
+func (c Client) refreshOAuth(ctx context.Context, stale string) (*TokenResponse, error) {
+	o := c.OAuth
+
+	if o == nil {
+		return nil, fmt.Errorf("not an oauth session")
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	token, refresh := c.Credentials.Tokens()
+
+	if stale != "" && stale != token {
+		return nil, nil
+	}
+
+	m, err := c.AuthServerMetadata(ctx, o.Issuer)
+
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refresh},
+		"client_id":     {o.ClientID},
+	}
+
+	t := TokenResponse{}
+
+	if err := c.oauthPost(ctx, o.DPoP, m.TokenEndpoint, form, &t); err != nil {
+		return nil, err
+	}
+
+	if t.Sub != c.Credentials.DID {
+		return nil, fmt.Errorf("refreshed tokens are for %s, not %s", t.Sub, c.Credentials.DID)
+	}
+
+	c.Credentials.setTokens(t.AccessToken, t.RefreshToken)
+
+	if o.OnRefresh != nil {
+		if err := o.OnRefresh(t); err != nil {
+			c.Log.Warnf("unable to store refreshed tokens: %s", err.Error())
+		}
+	}
+
+	return &t, nil
+}
+
+// Revokes the refresh token, which also ends the access token's session
+func (c Client) RevokeOAuth(ctx context.Context) error {
+	if c.OAuth == nil {
+		return fmt.Errorf("not an oauth session")
+	}
+
+	m, err := c.AuthServerMetadata(ctx, c.OAuth.Issuer)
+
+	if err != nil {
+		return err
+	}
+
+	if m.RevocationEndpoint == "" {
+		return nil
+	}
+
+	_, refresh := c.Credentials.Tokens()
+	form := url.Values{"token": {refresh}, "client_id": {c.OAuth.ClientID}}
+
+	return c.oauthPost(ctx, c.OAuth.DPoP, m.RevocationEndpoint, form, nil)
+}
+
+// Reports whether err means an oauth access token has expired
+func isOAuthExpired(err error) bool {
+	e, ok := err.(XRPCError)
+
+	if !ok || e.StatusCode != http.StatusUnauthorized {
+		return false
+	}
+
+	switch e.Name {
+	case "ExpiredToken", "InvalidToken", "invalid_token":
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,209 @@
+// Profile record reads & writes
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/rivo/uniseg"
+)
+
+const ProfileType string = "app.bsky.actor.profile"
+const putRecord string = "com.atproto.repo.putRecord"
+
+// Longest display name and description Bluesky accepts, in graphemes
+const (
+	MaxDisplayName int = 64
+	MaxDescription int = 256
+)
+
+// Largest avatar or banner image Bluesky accepts
+const MaxProfileImage int = 1_000_000
+
+// Times UpdateProfile re-reads the profile when another write got in first
+const profileAttempts int = 3
+
+// app.bsky.actor.profile record
+type Profile struct {
+	DisplayName string     `json:"displayName,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Avatar      *Blob      `json:"avatar,omitempty"`
+	Banner      *Blob      `json:"banner,omitempty"`
+	PinnedPost  *StrongRef `json:"pinnedPost,omitempty"`
+	// Fields this client doesn't manage, written back untouched
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+type profileFields Profile
+
+func (p *Profile) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*profileFields)(p)); err != nil {
+		return err
+	}
+
+	p.Extra = map[string]json.RawMessage{}
+
+	if err := json.Unmarshal(data, &p.Extra); err != nil {
+		return err
+	}
+
+	for _, k := range []string{
+		"$type", "displayName", "description", "avatar", "banner", "pinnedPost",
+	} {
+		delete(p.Extra, k)
+	}
+
+	return nil
+}
+
+func (p Profile) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(profileFields(p))
+
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]json.RawMessage{}
+
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	for k, v := range p.Extra {
+		fields[k] = v
+	}
+
+	fields["$type"] = json.RawMessage(fmt.Sprintf("%q", ProfileType))
+
+	return json.Marshal(fields)
+}
+
+// Checks lengths and image sizes against the lexicon
+func (p Profile) Validate() error {
+	if n := uniseg.GraphemeClusterCount(p.DisplayName); n > MaxDisplayName {
+		return fmt.Errorf("display name is %d characters, at most %d allowed", n, MaxDisplayName)
+	}
+
+	if n := uniseg.GraphemeClusterCount(p.Description); n > MaxDescription {
+		return fmt.Errorf("description is %d characters, at most %d allowed", n, MaxDescription)
+	}
+
+	for name, b := range map[string]*Blob{"avatar": p.Avatar, "banner": p.Banner} {
+		if b == nil {
+			continue
+		}
+
+		if b.MimeType != "image/png" && b.MimeType != "image/jpeg" {
+			return fmt.Errorf("%s must be a png or jpeg, got %s", name, b.MimeType)
+		}
+
+		if b.Size > MaxProfileImage {
+			return fmt.Errorf("%s is %d bytes, at most %d allowed", name, b.Size, MaxProfileImage)
+		}
+	}
+
+	return nil
+}
+
+// Request Body for com.atproto.repo.putRecord
+type PutRecordRequest struct {
+	Repo       string `json:"repo"`
+	Collection string `json:"collection"`
+	Rkey       string `json:"rkey"`
+	Record     any    `json:"record"`
+	// Record CID the write expects to replace, nil to create
+	SwapRecord *string `json:"swapRecord"`
+}
+
+// Reads the account's profile record and its CID
+//
+// Returns an empty profile and CID when the account has never set one.
+func (c Client) GetProfileRecord(ctx context.Context) (*Profile, string, error) {
+	rec, err := c.GetRecord(ctx, c.Credentials.DID, ProfileType, "self")
+
+	if e := (XRPCError{}); errors.As(err, &e) && e.Name == "RecordNotFound" {
+		return &Profile{}, "", nil
+	}
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	p := Profile{}
+
+	if err := json.Unmarshal(rec.Value, &p); err != nil {
+		return nil, "", err
+	}
+
+	return &p, rec.CID, nil
+}
+
+// Writes the profile record, failing with InvalidSwap unless the stored
+// record still has CID swap
+func (c Client) PutProfile(ctx context.Context, p Profile, swap string) (*PostResult, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	d := PutRecordRequest{
+		Repo: c.Credentials.DID, Collection: ProfileType, Rkey: "self", Record: p,
+	}
+
+	if swap != "" {
+		d.SwapRecord = &swap
+	}
+
+	r := PostResult{}
+
+	if err := c.xrpc(ctx, http.MethodPost, putRecord, nil, d, &r); err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// Applies edit to the current profile and writes it back
+//
+// The write swaps against the CID that was read, so concurrent edits are
+// never overwritten; edit runs again on a fresh copy when one got in first.
+func (c Client) UpdateProfile(ctx context.Context, edit func(*Profile) error) (*Profile, error) {
+	for attempt := 1; ; attempt++ {
+		p, cid, err := c.GetProfileRecord(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err := edit(p); err != nil {
+			return nil, err
+		}
+
+		_, err = c.PutProfile(ctx, *p, cid)
+
+		if e := (XRPCError{}); errors.As(err, &e) && e.Name == "InvalidSwap" &&
+			attempt < profileAttempts {
+			c.Log.Warnf("profile changed while updating, retrying")
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return p, nil
+	}
+}
+
+// Strong reference to a post by at-uri or bsky.app link
+func (c Client) PostRef(ctx context.Context, uri string) (*StrongRef, error) {
+	p, err := c.getPost(ctx, uri)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &StrongRef{URI: p.URI, CID: p.CID}, nil
+}
@@ -0,0 +1,159 @@
+// Request pacing and retries
+package api
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const defaultInterval time.Duration = 250 * time.Millisecond
+const defaultRetries int = 4
+const baseBackoff time.Duration = 500 * time.Millisecond
+const maxBackoff time.Duration = 30 * time.Second
+
+// Parsed RateLimit-* response headers
+type RateLimit struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// Reads the RateLimit-Limit, RateLimit-Remaining & RateLimit-Reset headers
+//
+// Reset is sent as a unix timestamp in seconds.
+func ParseRateLimit(h http.Header) (*RateLimit, bool) {
+	limit, err := strconv.Atoi(h.Get("RateLimit-Limit"))
+
+	if err != nil {
+		return nil, false
+	}
+
+	remaining, err := strconv.Atoi(h.Get("RateLimit-Remaining"))
+
+	if err != nil {
+		return nil, false
+	}
+
+	rl := RateLimit{Limit: limit, Remaining: remaining}
+
+	if reset, err := strconv.ParseInt(h.Get("RateLimit-Reset"), 10, 64); err == nil {
+		rl.Reset = time.Unix(reset, 0)
+	}
+
+	return &rl, true
+}
+
+// Shared request pacer
+//
+// Spaces requests at least interval apart and, once the server reports
+// its remaining budget, spreads what is left evenly until the window resets.
+type Limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+	limit    *RateLimit
+}
+
+// Limiter constructor
+func NewLimiter(interval time.Duration) *Limiter {
+	return &Limiter{interval: interval}
+}
+
+// Blocks until the next request slot or the context is done
+func (l *Limiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+
+	if at.Before(now) {
+		at = now
+	}
+
+	l.next = at.Add(l.gap(at))
+	l.mu.Unlock()
+
+	return sleep(ctx, time.Until(at))
+}
+
+// Gap to leave after a request sent at t
+func (l *Limiter) gap(t time.Time) time.Duration {
+	if l.limit == nil || !l.limit.Reset.After(t) {
+		return l.interval
+	}
+
+	if l.limit.Remaining <= 0 {
+		return l.limit.Reset.Sub(t)
+	}
+
+	g := l.limit.Reset.Sub(t) / time.Duration(l.limit.Remaining)
+
+	return max(g, l.interval)
+}
+
+// Records the latest rate limit reported by the server
+func (l *Limiter) Update(rl *RateLimit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limit = rl
+
+	if rl.Remaining <= 0 && rl.Reset.After(l.next) {
+		l.next = rl.Reset
+	}
+}
+
+// Exponential backoff with jitter for the given attempt
+func backoff(attempt int) time.Duration {
+	d := baseBackoff << attempt
+
+	if d > maxBackoff || d <= 0 {
+		d = maxBackoff
+	}
+
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// Delay before retrying a response, preferring the server's own hints
+func retryDelay(res *http.Response, attempt int) time.Duration {
+	d := backoff(attempt)
+
+	if s, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil {
+		return max(d, time.Duration(s)*time.Second)
+	}
+
+	if rl, ok := ParseRateLimit(res.Header); ok && res.StatusCode == http.StatusTooManyRequests {
+		return max(d, time.Until(rl.Reset))
+	}
+
+	return d
+}
+
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// Sleeps for d unless the context is cancelled or its deadline comes first
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	if dl, ok := ctx.Deadline(); ok && time.Until(dl) < d {
+		return fmt.Errorf("waiting %s would exceed deadline: %w", d, context.DeadlineExceeded)
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
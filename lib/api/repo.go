@@ -0,0 +1,36 @@
+// Repository record reads
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+)
+
+const getRecord string = "com.atproto.repo.getRecord"
+
+// Response from com.atproto.repo.getRecord
+type Record struct {
+	URI   string          `json:"uri"`
+	CID   string          `json:"cid"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Fetches a single record from a repository
+func (c Client) GetRecord(
+	ctx context.Context, repo string, collection string, rkey string,
+) (*Record, error) {
+	params := url.Values{}
+	params.Set("repo", repo)
+	params.Set("collection", collection)
+	params.Set("rkey", rkey)
+
+	r := Record{}
+
+	if err := c.xrpc(ctx, http.MethodGet, getRecord, params, nil, &r); err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
@@ -3,15 +3,35 @@ package api
 
 import (
 	"fmt"
+	"strings"
 	"time"
+
+	"github.com/rivo/uniseg"
 )
 
 const CreateRecord string = "com.atproto.repo.createRecord"
 const PostType string = "app.bsky.feed.post"
 
+// Longest post text Bluesky accepts, in graphemes
+const MaxPostLength int = 300
+
 type Message struct {
 	Content  string
 	Hashtags []string
+	// Optional record key, generated when empty
+	Rkey string
+	// Handle of the stored account to post as, the default when empty
+	Account string
+	// Post this is replying to, if any
+	Reply *ReplyRef
+	// BCP-47 language tags, detected from the content when empty
+	Langs []string
+	// Self-labels (content warnings) from SelfLabelValues
+	Labels []string
+	// Reply & quote restrictions, the account's defaults when nil
+	Gates *Gates
+	// Names of the TCP server's destinations to publish to, all when empty
+	Destinations []string
 }
 
 func (m Message) Format() string {
@@ -22,10 +42,24 @@ func (m Message) Format() string {
 	)
 }
 
+// Record reference by URI and content hash
+type StrongRef struct {
+	URI string `json:"uri"`
+	CID string `json:"cid"`
+}
+
+type ReplyRef struct {
+	Root   StrongRef `json:"root"`
+	Parent StrongRef `json:"parent"`
+}
+
 type PostRecord struct {
-	Type      string `json:"$type"`
-	Text      string `json:"text"`
-	CreatedAt string `json:"createdAt"`
+	Type      string      `json:"$type"`
+	Text      string      `json:"text"`
+	Reply     *ReplyRef   `json:"reply,omitempty"`
+	Langs     []string    `json:"langs,omitempty"`
+	Labels    *SelfLabels `json:"labels,omitempty"`
+	CreatedAt string      `json:"createdAt"`
 }
 
 func (p PostRecord) CreatedAtTime() (time.Time, error) {
@@ -39,17 +73,124 @@ type PostRequest struct {
 	// Session did
 	Repo       string     `json:"repo"`
 	Collection string     `json:"collection"`
+	Rkey       string     `json:"rkey,omitempty"`
 	Record     PostRecord `json:"record"`
 }
 
 func BuildPost(m Message) *PostRecord {
+	langs := m.Langs
+
+	if len(langs) == 0 {
+		langs = DetectLangs(m.Content)
+	}
+
 	return &PostRecord{
 		Type:      PostType,
 		Text:      m.Format(),
+		Reply:     m.Reply,
+		Langs:     langs,
+		Labels:    BuildLabels(m.Labels),
 		CreatedAt: time.Now().Format("2006-01-02T15:04:05.000000Z"),
 	}
 }
 
+// Splits a message too long for one post into numbered thread parts
+//
+// max is the longest post in graphemes, including the timestamp every part
+// ends with. Returns a single record when the formatted message fits.
+func BuildThread(m Message, max int) []PostRecord {
+	// Every part carries the languages of the whole message
+	if len(m.Langs) == 0 {
+		m.Langs = DetectLangs(m.Content)
+	}
+
+	chunks := SplitText(m.Content, max-uniseg.GraphemeClusterCount(Message{}.Format()))
+
+	if len(chunks) == 1 {
+		return []PostRecord{*BuildPost(m)}
+	}
+
+	posts := make([]PostRecord, len(chunks))
+
+	for i, chunk := range chunks {
+		part := m
+		part.Content = chunk
+		posts[i] = *BuildPost(part)
+	}
+
+	return posts
+}
+
+// Splits text longer than max graphemes into parts numbered " (n/total)"
+//
+// Text that fits is returned as the only part.
+func SplitText(text string, max int) []string {
+	if uniseg.GraphemeClusterCount(text) <= max {
+		return []string{text}
+	}
+
+	chunks := splitText(text, max-len(" (99/99)"))
+
+	for i, chunk := range chunks {
+		chunks[i] = fmt.Sprintf("%s (%d/%d)", chunk, i+1, len(chunks))
+	}
+
+	return chunks
+}
+
+// Breaks text into chunks of at most n graphemes on word boundaries
+//
+// Bluesky counts graphemes rather than runes, so emoji & combining
+// sequences are never cut in half.
+func splitText(text string, n int) []string {
+	chunks := []string{}
+	current := ""
+
+	for _, word := range strings.Fields(text) {
+		for uniseg.GraphemeClusterCount(word) > n {
+			if current != "" {
+				chunks = append(chunks, current)
+				current = ""
+			}
+
+			head, rest := cutGraphemes(word, n)
+			chunks = append(chunks, head)
+			word = rest
+		}
+
+		if current == "" {
+			current = word
+			continue
+		}
+
+		if uniseg.GraphemeClusterCount(current)+1+uniseg.GraphemeClusterCount(word) > n {
+			chunks = append(chunks, current)
+			current = word
+			continue
+		}
+
+		current = fmt.Sprintf("%s %s", current, word)
+	}
+
+	if current != "" {
+		chunks = append(chunks, current)
+	}
+
+	return chunks
+}
+
+// Splits s after its first n graphemes
+func cutGraphemes(s string, n int) (string, string) {
+	g := uniseg.NewGraphemes(s)
+	end := 0
+
+	for i := 0; i < n && g.Next(); i++ {
+		_, end = g.Positions()
+	}
+
+	return s[:end], s[end:]
+}
+
 func BuildPostRequest(r string, c string, p PostRecord) *PostRequest {
-	return &PostRequest{r, c, p}
+	return &PostRequest{Repo: r, Collection: c, Record: p}
 }
@@ -0,0 +1,191 @@
+// DID document resolution
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultPLCDirectory string = "https://plc.directory"
+const pdsServiceID string = "#atproto_pds"
+const didCacheTTL time.Duration = 15 * time.Minute
+
+// Finds the #atproto_pds service endpoint in a DID document
+//
+// Service ids may be relative ("#atproto_pds") or qualified with the DID.
+func (d DidDoc) PDSEndpoint() (string, bool) {
+	for _, s := range d.Service {
+		if s.ID == pdsServiceID || s.ID == d.ID+pdsServiceID {
+			return s.ServiceEndpoint, s.ServiceEndpoint != ""
+		}
+	}
+
+	return "", false
+}
+
+type cachedDoc struct {
+	doc     DidDoc
+	expires time.Time
+}
+
+// Resolves did:plc and did:web identifiers to DID documents
+//
+// Results are cached for TTL.
+type Resolver struct {
+	PLCDirectory string
+	HTTP         *http.Client
+	TTL          time.Duration
+	mu           sync.Mutex
+	cache        map[string]cachedDoc
+}
+
+// Resolver constructor
+//
+// Falls back to the public PLC directory when plc is empty.
+func NewResolver(plc string, h *http.Client) *Resolver {
+	if plc == "" {
+		plc = DefaultPLCDirectory
+	}
+
+	if h == nil {
+		h = http.DefaultClient
+	}
+
+	return &Resolver{
+		PLCDirectory: strings.TrimSuffix(plc, "/"),
+		HTTP:         h,
+		TTL:          didCacheTTL,
+		cache:        map[string]cachedDoc{},
+	}
+}
+
+// Fetches the DID document for did, using the cache when fresh
+func (r *Resolver) Resolve(ctx context.Context, did string) (*DidDoc, error) {
+	r.mu.Lock()
+	c, ok := r.cache[did]
+	r.mu.Unlock()
+
+	if ok && time.Now().Before(c.expires) {
+		return &c.doc, nil
+	}
+
+	uri, err := r.documentURL(did)
+
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := r.fetch(ctx, uri)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if doc.ID != did {
+		return nil, fmt.Errorf("document for %s has id %s", did, doc.ID)
+	}
+
+	r.mu.Lock()
+	r.cache[did] = cachedDoc{*doc, time.Now().Add(r.TTL)}
+	r.mu.Unlock()
+
+	return doc, nil
+}
+
+// Resolves the PDS endpoint for did
+func (r *Resolver) PDSEndpoint(ctx context.Context, did string) (string, error) {
+	doc, err := r.Resolve(ctx, did)
+
+	if err != nil {
+		return "", err
+	}
+
+	endpoint, ok := doc.PDSEndpoint()
+
+	if !ok {
+		return "", fmt.Errorf("%s has no %s service", did, pdsServiceID)
+	}
+
+	return endpoint, nil
+}
+
+// Builds the location of the DID document
+//
+// did:web hosts only support the domain form, with an optional encoded port.
+// localhost is served over plain http for local development.
+func (r *Resolver) documentURL(did string) (string, error) {
+	switch {
+	case strings.HasPrefix(did, "did:plc:"):
+		return fmt.Sprintf("%s/%s", r.PLCDirectory, did), nil
+	case strings.HasPrefix(did, "did:web:"):
+		host, err := url.PathUnescape(strings.TrimPrefix(did, "did:web:"))
+
+		if err != nil {
+			return "", err
+		}
+
+		hostname := host
+
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			hostname = h
+		}
+
+		local := hostname == "localhost"
+
+		if strings.Contains(host, ":") && !local {
+			return "", fmt.Errorf("unsupported did:web %s", did)
+		}
+
+		scheme := "https"
+
+		if local {
+			scheme = "http"
+		}
+
+		return fmt.Sprintf("%s://%s/.well-known/did.json", scheme, host), nil
+	}
+
+	return "", fmt.Errorf("unsupported did method: %s", did)
+}
+
+func (r *Resolver) fetch(ctx context.Context, uri string) (*DidDoc, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := r.HTTP.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to resolve %s: %s", uri, res.Status)
+	}
+
+	body, err := io.ReadAll(res.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	doc := DidDoc{}
+
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, err
+	}
+
+	return &doc, nil
+}
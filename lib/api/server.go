@@ -0,0 +1,36 @@
+// Server metadata
+package api
+
+import (
+	"context"
+	"net/http"
+)
+
+const describeServer string = "com.atproto.server.describeServer"
+
+type ServerLinks struct {
+	PrivacyPolicy  string `json:"privacyPolicy"`
+	TermsOfService string `json:"termsOfService"`
+}
+
+// Response from com.atproto.server.describeServer
+type ServerDescription struct {
+	DID                       string      `json:"did"`
+	AvailableUserDomains      []string    `json:"availableUserDomains"`
+	InviteCodeRequired        bool        `json:"inviteCodeRequired"`
+	PhoneVerificationRequired bool        `json:"phoneVerificationRequired"`
+	Links                     ServerLinks `json:"links"`
+}
+
+// Describes the entryway or PDS the client is configured for
+//
+// Doubles as a check that Service points at a working atproto server.
+func (c Client) DescribeServer(ctx context.Context) (*ServerDescription, error) {
+	d := ServerDescription{}
+
+	if err := c.call(ctx, c.Service, "", http.MethodGet, describeServer, nil, nil, &d); err != nil {
+		return nil, err
+	}
+
+	return &d, nil
+}
@@ -0,0 +1,102 @@
+// Session management
+package api
+
+import (
+	"context"
+	"net/http"
+)
+
+const getSession string = "com.atproto.server.getSession"
+const refreshSession string = "com.atproto.server.refreshSession"
+const deleteSession string = "com.atproto.server.deleteSession"
+
+// Account states reported in Session.Status when Active is false
+const (
+	StatusDeactivated string = "deactivated"
+	StatusSuspended   string = "suspended"
+	StatusTakendown   string = "takendown"
+)
+
+// Fetches the current session's account details
+func (c Client) GetSession(ctx context.Context) (*Session, error) {
+	s := Session{}
+
+	if err := c.xrpc(ctx, http.MethodGet, getSession, nil, nil, &s); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// Trades the refresh token for a new pair of tokens
+func (c Client) RefreshSession(ctx context.Context) (*Session, error) {
+	s := Session{}
+	_, refresh := c.Credentials.Tokens()
+	err := c.call(ctx, c.sessionHost(), refresh, http.MethodPost, refreshSession, nil, nil, &s)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c.Credentials.SetSession(s)
+
+	if c.Credentials.endpoint() == "" {
+		c.Credentials.setEndpoint(c.discoverPDS(ctx, s.Did))
+	}
+
+	return &s, nil
+}
+
+// Renews an expired password session
+//
+// The refresh token is traded first, signing in again with the password when
+// it has been rejected too. Callers racing on the same stale token share a
+// single renewal.
+func (c Client) renewSession(ctx context.Context, stale string) error {
+	c.Credentials.mu.Lock()
+	defer c.Credentials.mu.Unlock()
+
+	if token, _ := c.Credentials.Tokens(); token != stale {
+		return nil
+	}
+
+	s, err := c.RefreshSession(ctx)
+
+	if err != nil && c.Credentials.Password != "" {
+		c.Log.Warnf("unable to refresh session, signing in again: %s", err.Error())
+		s, err = c.CreateSession(ctx)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if c.OnSession != nil {
+		c.OnSession(*s)
+	}
+
+	return nil
+}
+
+// Revokes the session's refresh token
+func (c Client) DeleteSession(ctx context.Context) error {
+	_, refresh := c.Credentials.Tokens()
+
+	return c.call(ctx, c.sessionHost(), refresh, http.MethodPost, deleteSession, nil, nil, nil)
+}
+
+// Server that issued the session, the PDS once it is known
+func (c Client) sessionHost() string {
+	if e := c.Credentials.endpoint(); e != "" {
+		return e
+	}
+
+	return c.Service
+}
+
+// Reports whether err means the access token has expired
+func IsExpiredToken(err error) bool {
+	e, ok := err.(XRPCError)
+
+	return ok && e.Name == "ExpiredToken"
+}
@@ -0,0 +1,36 @@
+// Repository & blob downloads
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+const getRepo string = "com.atproto.sync.getRepo"
+const getBlob string = "com.atproto.sync.getBlob"
+
+// Fetches raw bytes from the session's PDS along with their content type
+func (c Client) download(
+	ctx context.Context, nsid string, params url.Values,
+) ([]byte, string, error) {
+	out := rawBody{}
+
+	if err := c.xrpc(ctx, http.MethodGet, nsid, params, nil, &out); err != nil {
+		return nil, "", err
+	}
+
+	return out.Data, out.MimeType, nil
+}
+
+// Downloads the whole repository of did as a CAR file
+func (c Client) GetRepo(ctx context.Context, did string) ([]byte, error) {
+	data, _, err := c.download(ctx, getRepo, url.Values{"did": {did}})
+
+	return data, err
+}
+
+// Downloads a blob of did's, returning it with its mime type
+func (c Client) GetBlob(ctx context.Context, did string, cid string) ([]byte, string, error) {
+	return c.download(ctx, getBlob, url.Values{"did": {did}, "cid": {cid}})
+}
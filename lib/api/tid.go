@@ -0,0 +1,91 @@
+// Timestamp identifiers
+package api
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+const tidAlphabet string = "234567abcdefghijklmnopqrstuvwxyz"
+const tidLength int = 13
+
+// Generates record keys following the atproto TID spec
+//
+// A TID is 53 bits of microseconds since the unix epoch followed by a
+// 10 bit clock id, encoded as 13 characters of base32-sortable.
+//
+// https://atproto.com/specs/tid
+type TIDGenerator struct {
+	mu      sync.Mutex
+	clockID uint64
+	last    uint64
+}
+
+var tids = NewTIDGenerator()
+
+// TIDGenerator constructor with a random clock id
+func NewTIDGenerator() *TIDGenerator {
+	return &TIDGenerator{clockID: uint64(rand.Intn(1024))}
+}
+
+// Returns the next TID, strictly greater than any issued before it
+func (g *TIDGenerator) Next() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	us := uint64(time.Now().UnixMicro())
+
+	if us <= g.last {
+		us = g.last + 1
+	}
+
+	g.last = us
+
+	return EncodeTID(us, g.clockID)
+}
+
+// Next TID from the package generator
+func NewTID() string {
+	return tids.Next()
+}
+
+// Encodes a timestamp in microseconds & clock id as a TID
+func EncodeTID(us uint64, clockID uint64) string {
+	v := (us&(1<<53-1))<<10 | clockID&(1<<10-1)
+	b := make([]byte, tidLength)
+
+	for i := tidLength - 1; i >= 0; i-- {
+		b[i] = tidAlphabet[v&31]
+		v >>= 5
+	}
+
+	return string(b)
+}
+
+// Decodes a valid TID into its timestamp in microseconds & clock id
+func DecodeTID(s string) (uint64, uint64) {
+	v := uint64(0)
+
+	for i := 0; i < len(s); i++ {
+		v = v<<5 | uint64(strings.IndexByte(tidAlphabet, s[i]))
+	}
+
+	return v >> 10, v & (1<<10 - 1)
+}
+
+// Reports whether s is a syntactically valid TID
+func ValidTID(s string) bool {
+	if len(s) != tidLength || strings.IndexByte("234567abcdefghij", s[0]) < 0 {
+		return false
+	}
+
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(tidAlphabet, s[i]) < 0 {
+			return false
+		}
+	}
+
+	return true
+}
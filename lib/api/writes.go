@@ -0,0 +1,233 @@
+// Batched repository writes
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+const applyWrites string = "com.atproto.repo.applyWrites"
+const writeCreate string = "com.atproto.repo.applyWrites#create"
+const writeUpdate string = "com.atproto.repo.applyWrites#update"
+const writeDelete string = "com.atproto.repo.applyWrites#delete"
+
+// Most operations the PDS accepts in a single applyWrites call
+const MaxWrites int = 200
+
+// A single create, update or delete in an applyWrites batch
+type WriteOp struct {
+	Type       string `json:"$type"`
+	Collection string `json:"collection"`
+	Rkey       string `json:"rkey,omitempty"`
+	Value      any    `json:"value,omitempty"`
+}
+
+// Create operation for a record with a fixed key
+func CreateOp(collection string, rkey string, v any) WriteOp {
+	return WriteOp{Type: writeCreate, Collection: collection, Rkey: rkey, Value: v}
+}
+
+// Update operation replacing the record at rkey
+func UpdateOp(collection string, rkey string, v any) WriteOp {
+	return WriteOp{Type: writeUpdate, Collection: collection, Rkey: rkey, Value: v}
+}
+
+// Delete operation for the record at rkey
+func DeleteOp(collection string, rkey string) WriteOp {
+	return WriteOp{Type: writeDelete, Collection: collection, Rkey: rkey}
+}
+
+// Request Body for com.atproto.repo.applyWrites
+type ApplyWritesRequest struct {
+	Repo   string    `json:"repo"`
+	Writes []WriteOp `json:"writes"`
+}
+
+type WriteResult struct {
+	Type             string `json:"$type"`
+	URI              string `json:"uri,omitempty"`
+	CID              string `json:"cid,omitempty"`
+	ValidationStatus string `json:"validationStatus,omitempty"`
+}
+
+type ApplyWritesResult struct {
+	Commit  CommitMeta    `json:"commit"`
+	Results []WriteResult `json:"results"`
+}
+
+// Applies all writes in a single repo commit
+//
+// Either every operation lands or none do.
+func (c Client) ApplyWrites(ctx context.Context, writes []WriteOp) (*ApplyWritesResult, error) {
+	if len(writes) > MaxWrites {
+		return nil, fmt.Errorf("%d writes exceeds the limit of %d", len(writes), MaxWrites)
+	}
+
+	r := ApplyWritesResult{}
+	req := ApplyWritesRequest{Repo: c.Credentials.DID, Writes: writes}
+
+	if err := c.xrpc(ctx, http.MethodPost, applyWrites, nil, req, &r); err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// Publishes every part of a thread in one commit
+//
+// Reply references need the CIDs of earlier posts, so they are computed
+// locally before anything is sent. rootKey, when set, is used for the first
+// post and every later part's key is derived from it, so a retry writes the
+// same keys. A conflict then means a previous attempt already landed the
+// thread, whose records are fetched back. A first post that is itself a reply
+// keeps the whole thread under its root.
+//
+// The threadgate and postgates for g are written in the same commit.
+func (c Client) createThread(
+	ctx context.Context, posts []PostRecord, rootKey string, g Gates,
+) (*PostResult, error) {
+	results := make([]PostResult, len(posts))
+	writes := make([]WriteOp, len(posts))
+	gates := []WriteOp{}
+
+	if rootKey == "" {
+		rootKey = NewTID()
+	}
+
+	for i := range posts {
+		rkey := threadKey(rootKey, i)
+
+		uri := ATURI{c.Credentials.DID, PostType, rkey}
+
+		if i > 0 {
+			root := StrongRef{results[0].URI, results[0].CID}
+
+			if posts[0].Reply != nil {
+				root = posts[0].Reply.Root
+			}
+
+			posts[i].Reply = &ReplyRef{
+				Root:   root,
+				Parent: StrongRef{results[i-1].URI, results[i-1].CID},
+			}
+		}
+
+		cid, err := RecordCID(posts[i])
+
+		if err != nil {
+			return nil, err
+		}
+
+		results[i] = PostResult{URI: uri.String(), CID: cid, Rkey: rkey}
+		writes[i] = CreateOp(PostType, rkey, posts[i])
+		gates = append(gates, g.writes(uri, i > 0 || posts[0].Reply != nil)...)
+	}
+
+	r, err := c.ApplyWrites(ctx, append(writes, gates...))
+
+	if isConflict(err) {
+		c.Log.Warnf("thread %s already exists, treating as created", results[0].URI)
+		return c.existingThread(ctx, results)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	root := results[0]
+	root.Thread = results
+
+	if r != nil {
+		for i := range root.Thread {
+			root.Thread[i].Commit = r.Commit
+		}
+
+		root.Commit = r.Commit
+	}
+
+	if len(results) == 1 {
+		c.Log.Infof("created post %s with %d gates", root.URI, len(gates))
+	} else {
+		c.Log.Infof("created thread %s with %d posts", root.URI, len(results))
+	}
+
+	return &root, nil
+}
+
+// Looks up every part of a thread that a previous attempt already wrote
+//
+// The records that landed may differ from the ones built for this attempt,
+// their timestamps for one, so their CIDs are read back from the PDS.
+func (c Client) existingThread(ctx context.Context, parts []PostResult) (*PostResult, error) {
+	thread := make([]PostResult, len(parts))
+
+	for i, part := range parts {
+		p, err := c.existingPost(ctx, part.Rkey)
+
+		if err != nil {
+			return nil, err
+		}
+
+		thread[i] = *p
+	}
+
+	root := thread[0]
+	root.Thread = thread
+
+	return &root, nil
+}
+
+// Record key for part i of a thread whose first post is at rkey
+//
+// Parts share a TID root's timestamp with the clock id advanced by i, which
+// the package generator never issues since it keeps a single clock id.
+func threadKey(rkey string, i int) string {
+	if i == 0 {
+		return rkey
+	}
+
+	if !ValidTID(rkey) {
+		return fmt.Sprintf("%s-%d", rkey, i)
+	}
+
+	us, clockID := DecodeTID(rkey)
+
+	return EncodeTID(us, clockID+uint64(i))
+}
+
+// Deletes posts by at-uri in batches of MaxWrites per commit
+func (c Client) DeletePosts(ctx context.Context, uris []string) error {
+	writes := []WriteOp{}
+
+	for _, s := range uris {
+		u, err := ParseATURI(s)
+
+		if err != nil {
+			return err
+		}
+
+		if u.Collection != PostType || u.Rkey == "" {
+			return fmt.Errorf("%s is not a post", s)
+		}
+
+		if u.Authority != c.Credentials.DID {
+			return fmt.Errorf("%s does not belong to %s", s, c.Credentials.DID)
+		}
+
+		writes = append(writes, DeleteOp(PostType, u.Rkey))
+	}
+
+	for len(writes) > 0 {
+		n := min(len(writes), MaxWrites)
+
+		if _, err := c.ApplyWrites(ctx, writes[:n]); err != nil {
+			return err
+		}
+
+		c.Log.Infof("deleted %d posts", n)
+		writes = writes[n:]
+	}
+
+	return nil
+}
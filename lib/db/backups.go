@@ -0,0 +1,190 @@
+package db
+
+import (
+	"database/sql"
+	"os"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/desertthunder/quotesky/lib/utils"
+)
+
+// Repository backups, the posts they contain & their blobs
+type BackupRepository struct {
+	conn *sql.DB
+	Log  *log.Logger
+}
+
+// Downloaded copy of an account's repository
+type Backup struct {
+	ID      int
+	Account string
+	Rev     string
+	// CID of the signed commit the CAR file is rooted at
+	Commit  string
+	CAR     []byte
+	Records int
+	// Size of the CAR file in bytes
+	Size      int
+	CreatedAt time.Time
+}
+
+// Post extracted from a backup
+//
+// Posts are kept after they're deleted from the repository; BackupID is
+// the latest backup they were seen in.
+type ArchivedPost struct {
+	Account string
+	URI     string
+	CID     string
+	// Record as JSON
+	Record   string
+	Text     string
+	PostedAt string
+	BackupID int
+}
+
+type Blob struct {
+	CID      string
+	Account  string
+	MimeType string
+	Data     []byte
+}
+
+func InitBackupRepo(dbg bool) *BackupRepository {
+	dbc := Connect(dbg)
+	l := log.NewWithOptions(os.Stderr, utils.Options("Backup Repo 💾", dbg))
+	return &BackupRepository{dbc.db, l}
+}
+
+// Stores a backup and archives its posts, returning the backup's id
+func (r BackupRepository) Save(b Backup, posts []ArchivedPost) (int, error) {
+	tx, err := r.conn.Begin()
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	id := 0
+	err = tx.QueryRow(
+		`INSERT INTO backups (account, rev, commit_cid, car, records, created_at)
+		VALUES (?, ?, ?, ?, ?, ?) RETURNING id`,
+		b.Account, b.Rev, b.Commit, b.CAR, b.Records, now,
+	).Scan(&id)
+
+	if err != nil {
+		return 0, err
+	}
+
+	for _, p := range posts {
+		_, err := tx.Exec(
+			`INSERT INTO archived_posts
+				(account, uri, cid, record, text, posted_at, backup_id, archived_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (uri) DO UPDATE SET cid = excluded.cid, record = excluded.record,
+				text = excluded.text, backup_id = excluded.backup_id`,
+			p.Account, p.URI, p.CID, p.Record, p.Text, p.PostedAt, id, now,
+		)
+
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return id, tx.Commit()
+}
+
+// Backups of account, newest first, without their CAR files
+func (r BackupRepository) List(account string) ([]Backup, error) {
+	rows, err := r.conn.Query(
+		`SELECT id, account, rev, commit_cid, records, length(car), created_at
+		FROM backups WHERE account = ? ORDER BY id DESC`, account,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	backups := []Backup{}
+
+	for rows.Next() {
+		b := Backup{}
+		at := ""
+		err := rows.Scan(&b.ID, &b.Account, &b.Rev, &b.Commit, &b.Records, &b.Size, &at)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if b.CreatedAt, err = time.Parse(time.RFC3339, at); err != nil {
+			return nil, err
+		}
+
+		backups = append(backups, b)
+	}
+
+	return backups, rows.Err()
+}
+
+// CAR file of backup id
+func (r BackupRepository) CAR(id int) ([]byte, error) {
+	car := []byte{}
+	err := r.conn.QueryRow(`SELECT car FROM backups WHERE id = ?`, id).Scan(&car)
+
+	return car, err
+}
+
+// Archived posts of account, oldest first
+func (r BackupRepository) Posts(account string) ([]ArchivedPost, error) {
+	rows, err := r.conn.Query(
+		`SELECT account, uri, cid, record, text, COALESCE(posted_at, ''), COALESCE(backup_id, 0)
+		FROM archived_posts WHERE account = ? ORDER BY posted_at, id`, account,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	posts := []ArchivedPost{}
+
+	for rows.Next() {
+		p := ArchivedPost{}
+		err := rows.Scan(
+			&p.Account, &p.URI, &p.CID, &p.Record, &p.Text, &p.PostedAt, &p.BackupID,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		posts = append(posts, p)
+	}
+
+	return posts, rows.Err()
+}
+
+// Reports whether the blob with cid is already stored
+func (r BackupRepository) HasBlob(cid string) (bool, error) {
+	n := 0
+	err := r.conn.QueryRow(`SELECT COUNT(*) FROM blobs WHERE cid = ?`, cid).Scan(&n)
+
+	return n > 0, err
+}
+
+// Stores a blob, keeping the first copy of a cid
+func (r BackupRepository) SaveBlob(b Blob) error {
+	_, err := r.conn.Exec(
+		`INSERT INTO blobs (cid, account, mime_type, data, created_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (cid) DO NOTHING`,
+		b.CID, b.Account, b.MimeType, b.Data, time.Now().UTC().Format(time.RFC3339),
+	)
+
+	return err
+}
@@ -0,0 +1,162 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/desertthunder/quotesky/lib/utils"
+)
+
+// Draft states
+const (
+	DraftPending   string = "pending"
+	DraftPublished string = "published"
+)
+
+// Messages waiting for review before they're posted
+type DraftRepository struct {
+	conn *sql.DB
+	Log  *log.Logger
+}
+
+type Draft struct {
+	ID      int
+	Account string
+	// JSON encoded message, posted as is once approved
+	Message string
+	// Where the draft came from, e.g. cli or tcp
+	Source    string
+	Status    string
+	URI       string
+	CreatedAt string
+	UpdatedAt string
+}
+
+const draftColumns string = `id, COALESCE(account, ''), message, source, status,
+	COALESCE(uri, ''), created_at, updated_at`
+
+func scanDraft(row interface{ Scan(...any) error }) (*Draft, error) {
+	d := Draft{}
+	err := row.Scan(
+		&d.ID, &d.Account, &d.Message, &d.Source, &d.Status, &d.URI, &d.CreatedAt, &d.UpdatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &d, nil
+}
+
+func InitDraftRepo(dbg bool) *DraftRepository {
+	dbc := Connect(dbg)
+	l := log.NewWithOptions(os.Stderr, utils.Options("Draft Repo 📝", dbg))
+	return &DraftRepository{dbc.db, l}
+}
+
+// Stores a pending draft and returns its id
+func (r DraftRepository) Add(account string, message string, source string) (int, error) {
+	id := 0
+	now := time.Now().Format(time.RFC3339)
+	err := r.conn.QueryRow(
+		"INSERT INTO drafts (account, message, source, status, created_at, updated_at) "+
+			"VALUES (?, ?, ?, ?, ?, ?) RETURNING id",
+		account, message, source, DraftPending, now, now,
+	).Scan(&id)
+
+	return id, err
+}
+
+func (r DraftRepository) Get(id int) (*Draft, error) {
+	d, err := scanDraft(r.conn.QueryRow(`SELECT `+draftColumns+` FROM drafts WHERE id = ?`, id))
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("no draft with id %d", id)
+	}
+
+	return d, err
+}
+
+// Pending drafts oldest first, or every draft when all is set
+func (r DraftRepository) List(all bool) ([]Draft, error) {
+	rows, err := r.conn.Query(
+		`SELECT `+draftColumns+` FROM drafts WHERE ? OR status = ? ORDER BY id`,
+		all, DraftPending,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	drafts := []Draft{}
+
+	for rows.Next() {
+		d, err := scanDraft(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		drafts = append(drafts, *d)
+	}
+
+	return drafts, rows.Err()
+}
+
+// Replaces the account and message of a pending draft
+func (r DraftRepository) Update(id int, account string, message string) error {
+	res, err := r.conn.Exec(
+		`UPDATE drafts SET account = ?, message = ?, updated_at = ? WHERE id = ? AND status = ?`,
+		account, message, time.Now().Format(time.RFC3339), id, DraftPending,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return expectDraft(res, id)
+}
+
+// Marks a pending draft as published at uri
+func (r DraftRepository) Published(id int, uri string) error {
+	res, err := r.conn.Exec(
+		`UPDATE drafts SET status = ?, uri = ?, updated_at = ? WHERE id = ? AND status = ?`,
+		DraftPublished, uri, time.Now().Format(time.RFC3339), id, DraftPending,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return expectDraft(res, id)
+}
+
+// Deletes a pending draft
+func (r DraftRepository) Discard(id int) error {
+	res, err := r.conn.Exec(`DELETE FROM drafts WHERE id = ? AND status = ?`, id, DraftPending)
+
+	if err != nil {
+		return err
+	}
+
+	return expectDraft(res, id)
+}
+
+func expectDraft(res sql.Result, id int) error {
+	n, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return fmt.Errorf("no pending draft with id %d", id)
+	}
+
+	return nil
+}
@@ -0,0 +1,194 @@
+package db
+
+import (
+	"database/sql"
+	"os"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/desertthunder/quotesky/lib/utils"
+)
+
+// Published posts & their engagement snapshots
+type HistoryRepository struct {
+	conn *sql.DB
+	Log  *log.Logger
+}
+
+// Post published by one of the accounts
+type HistoryPost struct {
+	ID      int
+	Account string
+	URI     string
+	CID     string
+	Text    string
+	Tags    []string
+	// Quote the post was made from, 0 for free text
+	QuoteID int
+	// Current text of that quote, read back only
+	QuoteText string
+	// Draft the post was published from, 0 when posted directly
+	DraftID  int
+	PostedAt time.Time
+}
+
+// Engagement counts at one point in time
+type Metrics struct {
+	Likes   int
+	Reposts int
+	Replies int
+	Quotes  int
+}
+
+func (m Metrics) Total() int {
+	return m.Likes + m.Reposts + m.Replies + m.Quotes
+}
+
+type Snapshot struct {
+	PostID int
+	Metrics
+	CollectedAt time.Time
+}
+
+const historyColumns string = `history.id, history.account, history.uri,
+	COALESCE(history.cid, ''), history.text, COALESCE(history.tags, ''),
+	COALESCE(history.quote_id, 0), COALESCE(history.draft_id, 0), history.posted_at,
+	COALESCE(quotes.text, '')`
+
+func scanHistoryPost(row interface{ Scan(...any) error }) (*HistoryPost, error) {
+	p := HistoryPost{}
+	tags, posted := "", ""
+	err := row.Scan(
+		&p.ID, &p.Account, &p.URI, &p.CID, &p.Text, &tags, &p.QuoteID, &p.DraftID, &posted,
+		&p.QuoteText,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	p.Tags = splitTags(tags)
+	p.PostedAt, err = time.Parse(time.RFC3339, posted)
+
+	return &p, err
+}
+
+func InitHistoryRepo(dbg bool) *HistoryRepository {
+	dbc := Connect(dbg)
+	l := log.NewWithOptions(os.Stderr, utils.Options("History Repo 📈", dbg))
+	return &HistoryRepository{dbc.db, l}
+}
+
+// Stores a published post, keeping the first record of a uri
+func (r HistoryRepository) Record(p HistoryPost) error {
+	_, err := r.conn.Exec(
+		`INSERT INTO history (account, uri, cid, text, tags, quote_id, draft_id, posted_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (uri) DO NOTHING`,
+		p.Account, p.URI, p.CID, p.Text, joinTags(p.Tags), nullID(p.QuoteID), nullID(p.DraftID),
+		p.PostedAt.UTC().Format(time.RFC3339),
+	)
+
+	return err
+}
+
+// Posts published at or after t, oldest first
+func (r HistoryRepository) Since(t time.Time) ([]HistoryPost, error) {
+	rows, err := r.conn.Query(
+		`SELECT `+historyColumns+` FROM history
+		LEFT JOIN quotes ON quotes.id = history.quote_id
+		WHERE history.posted_at >= ? ORDER BY history.posted_at`,
+		t.UTC().Format(time.RFC3339),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	posts := []HistoryPost{}
+
+	for rows.Next() {
+		p, err := scanHistoryPost(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		posts = append(posts, *p)
+	}
+
+	return posts, rows.Err()
+}
+
+// Stores one snapshot per post id collected at t
+func (r HistoryRepository) AddSnapshots(metrics map[int]Metrics, t time.Time) error {
+	tx, err := r.conn.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	at := t.UTC().Format(time.RFC3339)
+
+	for id, m := range metrics {
+		_, err := tx.Exec(
+			`INSERT INTO post_metrics (post_id, likes, reposts, replies, quotes, collected_at)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			id, m.Likes, m.Reposts, m.Replies, m.Quotes, at,
+		)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Snapshots of posts published at or after t, oldest first
+func (r HistoryRepository) Snapshots(t time.Time) ([]Snapshot, error) {
+	rows, err := r.conn.Query(
+		`SELECT m.post_id, m.likes, m.reposts, m.replies, m.quotes, m.collected_at
+		FROM post_metrics m JOIN history h ON h.id = m.post_id
+		WHERE h.posted_at >= ? ORDER BY m.collected_at`,
+		t.UTC().Format(time.RFC3339),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	snaps := []Snapshot{}
+
+	for rows.Next() {
+		s := Snapshot{}
+		at := ""
+		err := rows.Scan(&s.PostID, &s.Likes, &s.Reposts, &s.Replies, &s.Quotes, &at)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if s.CollectedAt, err = time.Parse(time.RFC3339, at); err != nil {
+			return nil, err
+		}
+
+		snaps = append(snaps, s)
+	}
+
+	return snaps, rows.Err()
+}
+
+// Stores ids below 1 as NULL so foreign keys hold
+func nullID(id int) any {
+	if id < 1 {
+		return nil
+	}
+
+	return id
+}
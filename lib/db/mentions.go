@@ -0,0 +1,137 @@
+package db
+
+import (
+	"database/sql"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/desertthunder/quotesky/lib/utils"
+)
+
+// Notification & conversation cursors and the blocklist for the bots
+type MentionRepository struct {
+	conn *sql.DB
+	Log  *log.Logger
+}
+
+func InitMentionRepo(dbg bool) *MentionRepository {
+	dbc := Connect(dbg)
+	l := log.NewWithOptions(os.Stderr, utils.Options("Mention Repo 🔔", dbg))
+	return &MentionRepository{dbc.db, l}
+}
+
+// Timestamp of the newest notification handled for account
+//
+// Returns an empty string when the account has never been polled.
+func (r MentionRepository) SeenAt(account string) (string, error) {
+	seen := ""
+	err := r.conn.QueryRow(
+		`SELECT seen_at FROM notification_state WHERE account = ?`, account,
+	).Scan(&seen)
+
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+
+	return seen, err
+}
+
+func (r MentionRepository) SetSeenAt(account string, seen string) error {
+	_, err := r.conn.Exec(
+		`INSERT INTO notification_state (account, seen_at, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT (account) DO UPDATE SET seen_at = excluded.seen_at,
+			updated_at = excluded.updated_at`,
+		account, seen, time.Now().Format(time.RFC3339),
+	)
+
+	return err
+}
+
+// Id of the last message handled in a conversation, empty when unseen
+func (r MentionRepository) LastMessage(account string, convo string) (string, error) {
+	id := ""
+	err := r.conn.QueryRow(
+		`SELECT last_message_id FROM convo_state WHERE account = ? AND convo_id = ?`,
+		account, convo,
+	).Scan(&id)
+
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+
+	return id, err
+}
+
+func (r MentionRepository) SetLastMessage(account string, convo string, id string) error {
+	_, err := r.conn.Exec(
+		`INSERT INTO convo_state (account, convo_id, last_message_id, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (account, convo_id) DO UPDATE SET
+			last_message_id = excluded.last_message_id, updated_at = excluded.updated_at`,
+		account, convo, id, time.Now().Format(time.RFC3339),
+	)
+
+	return err
+}
+
+// Adds a handle or did to the blocklist
+func (r MentionRepository) Block(actor string) error {
+	_, err := r.conn.Exec(
+		`INSERT OR IGNORE INTO blocklist (actor, created_at) VALUES (?, ?)`,
+		strings.ToLower(actor), time.Now().Format(time.RFC3339),
+	)
+
+	return err
+}
+
+func (r MentionRepository) Unblock(actor string) error {
+	_, err := r.conn.Exec(`DELETE FROM blocklist WHERE actor = ?`, strings.ToLower(actor))
+
+	return err
+}
+
+func (r MentionRepository) Blocked() ([]string, error) {
+	rows, err := r.conn.Query(`SELECT actor FROM blocklist ORDER BY actor`)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	actors := []string{}
+
+	for rows.Next() {
+		a := ""
+
+		if err := rows.Scan(&a); err != nil {
+			return nil, err
+		}
+
+		actors = append(actors, a)
+	}
+
+	return actors, rows.Err()
+}
+
+// Reports whether any of the given handles or dids is blocked
+func (r MentionRepository) IsBlocked(actors ...string) (bool, error) {
+	for _, a := range actors {
+		count := 0
+		err := r.conn.QueryRow(
+			`SELECT COUNT(*) FROM blocklist WHERE actor = ?`, strings.ToLower(a),
+		).Scan(&count)
+
+		if err != nil {
+			return false, err
+		}
+
+		if count > 0 {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
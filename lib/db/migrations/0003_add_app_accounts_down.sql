@@ -0,0 +1,4 @@
+ALTER TABLE apps DROP COLUMN is_default;
+ALTER TABLE apps DROP COLUMN refresh_token;
+ALTER TABLE apps DROP COLUMN password;
+ALTER TABLE apps DROP COLUMN did;
@@ -0,0 +1,4 @@
+ALTER TABLE apps ADD COLUMN did TEXT;
+ALTER TABLE apps ADD COLUMN password TEXT;
+ALTER TABLE apps ADD COLUMN refresh_token TEXT;
+ALTER TABLE apps ADD COLUMN is_default BOOLEAN DEFAULT FALSE NOT NULL;
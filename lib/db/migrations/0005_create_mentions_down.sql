@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS blocklist;
+DROP TABLE IF EXISTS notification_state;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS notification_state (
+    account TEXT PRIMARY KEY NOT NULL,
+    seen_at TEXT NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS blocklist (
+    actor TEXT PRIMARY KEY NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
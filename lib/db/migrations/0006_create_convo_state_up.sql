@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS convo_state (
+    account TEXT NOT NULL,
+    convo_id TEXT NOT NULL,
+    last_message_id TEXT NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    PRIMARY KEY (account, convo_id)
+);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS post_metrics_post_id;
+DROP TABLE IF EXISTS post_metrics;
+DROP TABLE IF EXISTS history;
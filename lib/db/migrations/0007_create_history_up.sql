@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    account TEXT NOT NULL,
+    uri TEXT UNIQUE NOT NULL,
+    cid TEXT,
+    text TEXT NOT NULL,
+    tags TEXT,
+    quote_id INTEGER REFERENCES quotes (id) ON DELETE SET NULL,
+    posted_at TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS post_metrics (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    post_id INTEGER NOT NULL REFERENCES history (id) ON DELETE CASCADE,
+    likes INTEGER DEFAULT 0 NOT NULL,
+    reposts INTEGER DEFAULT 0 NOT NULL,
+    replies INTEGER DEFAULT 0 NOT NULL,
+    quotes INTEGER DEFAULT 0 NOT NULL,
+    collected_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS post_metrics_post_id ON post_metrics (post_id, collected_at);
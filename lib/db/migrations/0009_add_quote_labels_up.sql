@@ -0,0 +1 @@
+ALTER TABLE quotes ADD COLUMN labels TEXT;
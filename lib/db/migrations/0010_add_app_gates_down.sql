@@ -0,0 +1,2 @@
+ALTER TABLE apps DROP COLUMN no_quotes;
+ALTER TABLE apps DROP COLUMN reply_rules;
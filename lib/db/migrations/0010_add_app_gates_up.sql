@@ -0,0 +1,2 @@
+ALTER TABLE apps ADD COLUMN reply_rules TEXT;
+ALTER TABLE apps ADD COLUMN no_quotes BOOLEAN DEFAULT FALSE NOT NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE history DROP COLUMN draft_id;
+DROP TABLE IF EXISTS drafts;
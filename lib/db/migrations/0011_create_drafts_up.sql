@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS drafts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    account TEXT,
+    message TEXT NOT NULL,
+    source TEXT NOT NULL,
+    status TEXT DEFAULT 'pending' NOT NULL,
+    uri TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+ALTER TABLE history ADD COLUMN draft_id INTEGER REFERENCES drafts (id) ON DELETE SET NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE apps DROP COLUMN dpop_key;
+ALTER TABLE apps DROP COLUMN oauth_client_id;
+ALTER TABLE apps DROP COLUMN auth_server;
@@ -0,0 +1,3 @@
+ALTER TABLE apps ADD COLUMN auth_server TEXT;
+ALTER TABLE apps ADD COLUMN oauth_client_id TEXT;
+ALTER TABLE apps ADD COLUMN dpop_key TEXT;
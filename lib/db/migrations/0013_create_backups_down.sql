@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS blobs;
+DROP TABLE IF EXISTS archived_posts;
+DROP TABLE IF EXISTS backups;
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS backups (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    account TEXT NOT NULL,
+    rev TEXT NOT NULL,
+    commit_cid TEXT NOT NULL,
+    car BLOB NOT NULL,
+    records INTEGER NOT NULL,
+    created_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS archived_posts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    account TEXT NOT NULL,
+    uri TEXT UNIQUE NOT NULL,
+    cid TEXT NOT NULL,
+    record TEXT NOT NULL,
+    text TEXT NOT NULL,
+    posted_at TEXT,
+    backup_id INTEGER REFERENCES backups (id) ON DELETE SET NULL,
+    archived_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS blobs (
+    cid TEXT PRIMARY KEY NOT NULL,
+    account TEXT NOT NULL,
+    mime_type TEXT,
+    data BLOB NOT NULL,
+    created_at TEXT NOT NULL
+);
@@ -0,0 +1,181 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/desertthunder/quotesky/lib/utils"
+)
+
+// Quotes store
+type QuoteRepository struct {
+	conn *sql.DB
+	Log  *log.Logger
+}
+
+type Quote struct {
+	ID     int
+	Text   string
+	Author string
+	Tags   []string
+	// Language tags for posts of this quote, detected when empty
+	Langs []string
+	// Self-labels every post of this quote carries
+	Labels []string
+}
+
+// Quote text with its attribution
+func (q Quote) String() string {
+	if q.Author == "" {
+		return q.Text
+	}
+
+	return fmt.Sprintf("%s — %s", q.Text, q.Author)
+}
+
+const quoteColumns string = `id, text, COALESCE(author, ''), COALESCE(tags, ''),
+	COALESCE(langs, ''), COALESCE(labels, '')`
+
+func scanQuote(row interface{ Scan(...any) error }) (*Quote, error) {
+	q := Quote{}
+	tags, langs, labels := "", "", ""
+
+	if err := row.Scan(&q.ID, &q.Text, &q.Author, &tags, &langs, &labels); err != nil {
+		return nil, err
+	}
+
+	q.Tags = splitTags(tags)
+	q.Langs = splitTags(langs)
+	q.Labels = splitTags(labels)
+
+	return &q, nil
+}
+
+// Tags are stored comma separated, lower case and without the leading #
+func joinTags(tags []string) string {
+	clean := []string{}
+
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(t), "#"))
+
+		if t != "" {
+			clean = append(clean, t)
+		}
+	}
+
+	return strings.Join(clean, ",")
+}
+
+func splitTags(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+
+	return strings.Split(s, ",")
+}
+
+func InitQuoteRepo(dbg bool) *QuoteRepository {
+	dbc := Connect(dbg)
+	l := log.NewWithOptions(os.Stderr, utils.Options("Quote Repo 💬", dbg))
+	return &QuoteRepository{dbc.db, l}
+}
+
+// Stores a new quote and returns its id
+func (r QuoteRepository) Add(q Quote) (int, error) {
+	id := 0
+	now := time.Now().Format(time.RFC3339)
+	err := r.conn.QueryRow(
+		"INSERT INTO quotes (text, author, tags, langs, labels, created_at, updated_at) "+
+			"VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id",
+		q.Text, q.Author, joinTags(q.Tags), joinTags(q.Langs), joinTags(q.Labels), now, now,
+	).Scan(&id)
+
+	return id, err
+}
+
+// Replaces the text, author, tags, langs and labels of quote q.ID
+func (r QuoteRepository) Update(q Quote) error {
+	res, err := r.conn.Exec(
+		`UPDATE quotes SET text = ?, author = ?, tags = ?, langs = ?, labels = ?, updated_at = ?
+		WHERE id = ?`,
+		q.Text, q.Author, joinTags(q.Tags), joinTags(q.Langs), joinTags(q.Labels),
+		time.Now().Format(time.RFC3339), q.ID,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return expectQuote(res, q.ID)
+}
+
+func (r QuoteRepository) Remove(id int) error {
+	res, err := r.conn.Exec(`DELETE FROM quotes WHERE id = ?`, id)
+
+	if err != nil {
+		return err
+	}
+
+	return expectQuote(res, id)
+}
+
+func (r QuoteRepository) Get(id int) (*Quote, error) {
+	return scanQuote(r.conn.QueryRow(`SELECT `+quoteColumns+` FROM quotes WHERE id = ?`, id))
+}
+
+func (r QuoteRepository) List() ([]Quote, error) {
+	rows, err := r.conn.Query(`SELECT ` + quoteColumns + ` FROM quotes ORDER BY id`)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	quotes := []Quote{}
+
+	for rows.Next() {
+		q, err := scanQuote(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		quotes = append(quotes, *q)
+	}
+
+	return quotes, rows.Err()
+}
+
+// Picks a random quote, matching term against tags, text and author
+//
+// An empty term matches every quote. Returns sql.ErrNoRows when nothing
+// matches.
+func (r QuoteRepository) Random(term string) (*Quote, error) {
+	like := "%" + strings.ToLower(strings.TrimPrefix(term, "#")) + "%"
+
+	return scanQuote(r.conn.QueryRow(
+		`SELECT `+quoteColumns+` FROM quotes WHERE ? = '' OR tags LIKE ?
+			OR LOWER(text) LIKE ? OR LOWER(author) LIKE ?
+		ORDER BY RANDOM() LIMIT 1`,
+		term, like, like, like,
+	))
+}
+
+func expectQuote(res sql.Result, id int) error {
+	n, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return fmt.Errorf("no quote with id %d", id)
+	}
+
+	return nil
+}
@@ -11,83 +11,368 @@ import (
 )
 
 type Repository interface{}
+
+// Accounts store
+//
+// Passwords and tokens are encrypted with cipher when one is configured.
 type AppRepository struct {
-	conn *sql.DB
-	Log  *log.Logger
+	conn   *sql.DB
+	Log    *log.Logger
+	cipher Cipher
 }
+
+// Stored account
 type App struct {
-	token  string
-	handle string
-	id     int
+	ID           int
+	Handle       string
+	DID          string
+	Service      string
+	Password     string
+	Token        string
+	RefreshToken string
+	Default      bool
+	// Default reply rules for new posts, comma separated
+	ReplyRules string
+	// Disables quote posts of new posts by default
+	NoQuotes bool
+	// OAuth issuer, empty for app password accounts
+	AuthServer string
+	ClientID   string
+	// DPoP private key the OAuth tokens are bound to
+	DPoPKey string
+	// PDS from the last session's DID document, Service may be an entryway
+	PDS string
+}
+
+const appColumns string = `id, handle, COALESCE(did, ''), COALESCE(service, ''),
+	COALESCE(password, ''), COALESCE(token, ''), COALESCE(refresh_token, ''), is_default,
+	COALESCE(reply_rules, ''), no_quotes, COALESCE(auth_server, ''),
+	COALESCE(oauth_client_id, ''), COALESCE(dpop_key, ''), COALESCE(pds, '')`
+
+func (a AppRepository) scanApp(row interface{ Scan(...any) error }) (*App, error) {
+	app := App{}
+	err := row.Scan(
+		&app.ID, &app.Handle, &app.DID, &app.Service,
+		&app.Password, &app.Token, &app.RefreshToken, &app.Default,
+		&app.ReplyRules, &app.NoQuotes, &app.AuthServer, &app.ClientID, &app.DPoPKey, &app.PDS,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range []*string{&app.Password, &app.Token, &app.RefreshToken, &app.DPoPKey} {
+		if *v, err = a.open(*v); err != nil {
+			return nil, fmt.Errorf("unable to read secrets for %s: %w", app.Handle, err)
+		}
+	}
+
+	return &app, nil
+}
+
+// Encrypts v when a cipher is configured
+func (a AppRepository) seal(v string) (string, error) {
+	if a.cipher == nil || v == "" {
+		return v, nil
+	}
+
+	return a.cipher.Seal(v)
 }
 
-func InitAppRepo(dbg bool) *AppRepository {
+// Decrypts v, passing plaintext written before encryption was enabled through
+func (a AppRepository) open(v string) (string, error) {
+	if !IsSealed(v) {
+		return v, nil
+	}
+
+	if a.cipher == nil {
+		return "", ErrNoKey
+	}
+
+	return a.cipher.Open(v)
+}
+
+// AppRepository constructor
+//
+// Encrypts secrets with the cipher from QSKY_KEY_FILE or QSKY_PASSPHRASE.
+func InitAppRepo(dbg bool) (*AppRepository, error) {
+	c, err := CipherFromEnv()
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to load encryption key: %w", err)
+	}
+
 	dbc := Connect(dbg)
 	l := log.NewWithOptions(os.Stderr, utils.Options("App Repo 🗂️", dbg))
-	return &AppRepository{dbc.db, l}
+
+	return &AppRepository{dbc.db, l, c}, nil
+}
+
+// Re-encrypts every stored secret under next
+//
+// Returns the number of accounts rewritten.
+func (a AppRepository) Rotate(next Cipher) (int, error) {
+	apps, err := a.List()
+
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := a.conn.Begin()
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	r := AppRepository{cipher: next}
+
+	for _, app := range apps {
+		vals := []string{app.Password, app.Token, app.RefreshToken, app.DPoPKey}
+
+		for i := range vals {
+			if vals[i], err = r.seal(vals[i]); err != nil {
+				return 0, err
+			}
+		}
+
+		_, err = tx.Exec(
+			`UPDATE apps SET password = ?, token = ?, refresh_token = ?, dpop_key = ? `+
+				`WHERE id = ?`,
+			vals[0], vals[1], vals[2], vals[3], app.ID,
+		)
+
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(apps), tx.Commit()
+}
+
+// Retrieve by handle
+func (a AppRepository) GetByHandle(h string) (*App, error) {
+	return a.scanApp(a.conn.QueryRow(`SELECT `+appColumns+` FROM apps WHERE handle = ?`, h))
 }
 
-func (a AppRepository) CreateOrUpdate(h string, t string) error {
-	id := 0
+// Retrieve by DID, known once the account has signed in
+func (a AppRepository) GetByDID(did string) (*App, error) {
+	return a.scanApp(a.conn.QueryRow(`SELECT `+appColumns+` FROM apps WHERE did = ?`, did))
+}
 
-	err := a.conn.QueryRow(`SELECT id FROM apps WHERE handle = ?`, h).Scan(&id)
+// Retrieve the default account
+//
+// Returns sql.ErrNoRows when no account is marked as the default.
+func (a AppRepository) GetDefault() (*App, error) {
+	return a.scanApp(a.conn.QueryRow(
+		`SELECT ` + appColumns + ` FROM apps WHERE is_default = TRUE LIMIT 1`,
+	))
+}
 
-	if err == sql.ErrNoRows {
-		a.Log.Debug("creating record")
+// All stored accounts ordered by handle
+func (a AppRepository) List() ([]App, error) {
+	rows, err := a.conn.Query(`SELECT ` + appColumns + ` FROM apps ORDER BY handle`)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	apps := []App{}
+
+	for rows.Next() {
+		app, err := a.scanApp(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		apps = append(apps, *app)
 	}
 
+	return apps, rows.Err()
+}
+
+// Stores the app password and service for handle h
+func (a AppRepository) SaveAccount(h string, p string, s string) error {
+	p, err := a.seal(p)
+
 	if err != nil {
 		return err
 	}
 
-	if id == 0 {
-		now := time.Now().Format(time.RFC3339)
-		err := a.conn.QueryRow(
-			"INSERT INTO apps (handle, token, created_at, updated_at) "+
-				"VALUES (?, ?, ?, ?) RETURNING id", h, t, now, now,
-		).Scan(&id)
+	now := time.Now().Format(time.RFC3339)
+	res, err := a.conn.Exec(
+		`UPDATE apps SET password = ?, service = ?, updated_at = ? WHERE handle = ?`,
+		p, s, now, h,
+	)
 
-		if err != nil {
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+
+	a.Log.Debugf("creating account %s", h)
+
+	_, err = a.conn.Exec(
+		"INSERT INTO apps (handle, password, service, created_at, updated_at) "+
+			"VALUES (?, ?, ?, ?, ?)", h, p, s, now, now,
+	)
+
+	return err
+}
+
+// Stores an account signed in with OAuth, replacing any app password
+//
+// The PDS is stored apart from the service, as for password sessions.
+func (a AppRepository) SaveOAuth(app App) error {
+	vals := []string{app.Token, app.RefreshToken, app.DPoPKey}
+
+	for i := range vals {
+		var err error
+
+		if vals[i], err = a.seal(vals[i]); err != nil {
 			return err
 		}
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	res, err := a.conn.Exec(
+		`UPDATE apps SET did = ?, service = ?, pds = ?, password = NULL, token = ?,
+			refresh_token = ?, auth_server = ?, oauth_client_id = ?, dpop_key = ?, updated_at = ?
+		WHERE handle = ?`,
+		app.DID, app.Service, app.PDS, vals[0], vals[1], app.AuthServer, app.ClientID, vals[2],
+		now, app.Handle,
+	)
+
+	if err != nil {
+		return err
+	}
 
-		return nil
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
 	}
 
-	a.Log.Infof("app %d already exists, updating token", id)
+	a.Log.Debugf("creating account %s", app.Handle)
+
+	_, err = a.conn.Exec(
+		`INSERT INTO apps (handle, did, service, pds, token, refresh_token, auth_server,
+			oauth_client_id, dpop_key, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		app.Handle, app.DID, app.Service, app.PDS, vals[0], vals[1], app.AuthServer,
+		app.ClientID, vals[2], now, now,
+	)
+
+	return err
+}
+
+// Stores session tokens for handle h along with its PDS, kept when pds is empty
+func (a AppRepository) SetSession(h string, did string, pds string, t string, rt string) error {
+	t, err := a.seal(t)
+
+	if err != nil {
+		return err
+	}
+
+	if rt, err = a.seal(rt); err != nil {
+		return err
+	}
 
 	res, err := a.conn.Exec(
-		`UPDATE apps SET handle = ?, token = ? WHERE id = ?`,
-		h, t, id,
+		`UPDATE apps SET did = ?, pds = COALESCE(NULLIF(?, ''), pds), token = ?,
+			refresh_token = ?, updated_at = ? WHERE handle = ?`,
+		did, pds, t, rt, time.Now().Format(time.RFC3339), h,
 	)
 
 	if err != nil {
 		return err
 	}
 
-	af, err := res.RowsAffected()
+	return expectOne(res, h)
+}
+
+// Forgets the session tokens stored for handle h
+func (a AppRepository) ClearSession(h string) error {
+	res, err := a.conn.Exec(
+		`UPDATE apps SET token = NULL, refresh_token = NULL, updated_at = ? WHERE handle = ?`,
+		time.Now().Format(time.RFC3339), h,
+	)
 
 	if err != nil {
 		return err
 	}
 
-	if af != 1 {
-		return fmt.Errorf("%d was updated instead of %d", af, id)
+	return expectOne(res, h)
+}
+
+// Marks handle h as the default account, clearing any other
+func (a AppRepository) SetDefault(h string) error {
+	tx, err := a.conn.Begin()
+
+	if err != nil {
+		return err
 	}
 
-	return nil
+	defer tx.Rollback()
+
+	if _, err = tx.Exec(`UPDATE apps SET is_default = FALSE`); err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(`UPDATE apps SET is_default = TRUE WHERE handle = ?`, h)
+
+	if err != nil {
+		return err
+	}
+
+	if err = expectOne(res, h); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-// Retrieve by handle
-func (a AppRepository) GetByHandle(h string) (*App, error) {
-	app := App{}
+// Stores the interaction defaults for posts by handle h
+func (a AppRepository) SetGates(h string, rules string, noQuotes bool) error {
+	res, err := a.conn.Exec(
+		`UPDATE apps SET reply_rules = ?, no_quotes = ?, updated_at = ? WHERE handle = ?`,
+		rules, noQuotes, time.Now().Format(time.RFC3339), h,
+	)
 
-	err := a.conn.QueryRow(`SELECT id FROM apps WHERE handle = ?`, h).
-		Scan(&app.id, &app.handle, &app.token)
+	if err != nil {
+		return err
+	}
+
+	return expectOne(res, h)
+}
+
+// Deletes the account for handle h
+func (a AppRepository) Remove(h string) error {
+	res, err := a.conn.Exec(`DELETE FROM apps WHERE handle = ?`, h)
 
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return &app, nil
+	return expectOne(res, h)
+}
+
+// Checks that a write touched a single account row
+func expectOne(res sql.Result, h string) error {
+	n, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return fmt.Errorf("no account for %s", h)
+	}
+
+	return nil
 }
@@ -0,0 +1,226 @@
+// Encryption of stored credentials
+package db
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+const sealedPrefix string = "enc:v1:"
+const saltSize int = 16
+const keySize int = 32
+const pbkdf2Iterations int = 600_000
+
+// Returned when an encrypted value is read without a configured key
+var ErrNoKey = errors.New("value is encrypted, set QSKY_PASSPHRASE or QSKY_KEY_FILE")
+
+// Encrypts values before they are written to the database
+type Cipher interface {
+	Seal(plain string) (string, error)
+	Open(sealed string) (string, error)
+}
+
+// AES-256-GCM cipher keyed from a passphrase or key file
+//
+// Sealed values are "enc:v1:" followed by base64 of salt, nonce and
+// ciphertext. Each instance seals with one random salt so the key is
+// derived once; keys for other salts are derived and cached on Open.
+type AESCipher struct {
+	derive func(salt []byte) []byte
+	salt   []byte
+	mu     sync.Mutex
+	keys   map[string]cipher.AEAD
+}
+
+func newAESCipher(derive func(salt []byte) []byte) (*AESCipher, error) {
+	salt := make([]byte, saltSize)
+
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	return &AESCipher{derive: derive, salt: salt, keys: map[string]cipher.AEAD{}}, nil
+}
+
+// Cipher keyed with PBKDF2-HMAC-SHA256 over a passphrase
+func PassphraseCipher(p string) (*AESCipher, error) {
+	if p == "" {
+		return nil, errors.New("passphrase is empty")
+	}
+
+	return newAESCipher(func(salt []byte) []byte {
+		return pbkdf2([]byte(p), salt, pbkdf2Iterations, keySize)
+	})
+}
+
+// Cipher keyed from a file holding at least 32 random bytes, raw or hex
+func KeyFileCipher(path string) (*AESCipher, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	key := []byte(strings.TrimSpace(string(data)))
+
+	if decoded, err := hex.DecodeString(string(key)); err == nil {
+		key = decoded
+	}
+
+	if len(key) < keySize {
+		return nil, fmt.Errorf("%s holds %d bytes, need at least %d", path, len(key), keySize)
+	}
+
+	return newAESCipher(func(salt []byte) []byte {
+		m := hmac.New(sha256.New, key)
+		m.Write(salt)
+
+		return m.Sum(nil)
+	})
+}
+
+// Writes a new hex encoded key file readable only by the owner
+func GenerateKeyFile(path string) error {
+	key := make([]byte, keySize)
+
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0o600)
+}
+
+// Cipher configured through QSKY_KEY_FILE or QSKY_PASSPHRASE
+//
+// Returns nil without an error when neither is set.
+func CipherFromEnv() (Cipher, error) {
+	if path := os.Getenv("QSKY_KEY_FILE"); path != "" {
+		return KeyFileCipher(path)
+	}
+
+	if p := os.Getenv("QSKY_PASSPHRASE"); p != "" {
+		return PassphraseCipher(p)
+	}
+
+	return nil, nil
+}
+
+func (c *AESCipher) aead(salt []byte) (cipher.AEAD, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if a, ok := c.keys[string(salt)]; ok {
+		return a, nil
+	}
+
+	block, err := aes.NewCipher(c.derive(salt))
+
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := cipher.NewGCM(block)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c.keys[string(salt)] = a
+
+	return a, nil
+}
+
+func (c *AESCipher) Seal(plain string) (string, error) {
+	a, err := c.aead(c.salt)
+
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, a.NonceSize())
+
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	out := append(append([]byte{}, c.salt...), nonce...)
+	out = a.Seal(out, nonce, []byte(plain), nil)
+
+	return sealedPrefix + base64.StdEncoding.EncodeToString(out), nil
+}
+
+func (c *AESCipher) Open(sealed string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(sealed, sealedPrefix))
+
+	if err != nil {
+		return "", err
+	}
+
+	if len(data) < saltSize {
+		return "", errors.New("sealed value is truncated")
+	}
+
+	a, err := c.aead(data[:saltSize])
+
+	if err != nil {
+		return "", err
+	}
+
+	data = data[saltSize:]
+
+	if len(data) < a.NonceSize() {
+		return "", errors.New("sealed value is truncated")
+	}
+
+	plain, err := a.Open(nil, data[:a.NonceSize()], data[a.NonceSize():], nil)
+
+	if err != nil {
+		return "", fmt.Errorf("unable to decrypt, wrong key? %w", err)
+	}
+
+	return string(plain), nil
+}
+
+// Reports whether a stored value was written by a Cipher
+func IsSealed(v string) bool {
+	return strings.HasPrefix(v, sealedPrefix)
+}
+
+// PBKDF2 (RFC 8018) with HMAC-SHA256
+func pbkdf2(password []byte, salt []byte, iter int, size int) []byte {
+	prf := hmac.New(sha256.New, password)
+	out := []byte{}
+
+	for block := uint32(1); len(out) < size; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(binary.BigEndian.AppendUint32(nil, block))
+		u := prf.Sum(nil)
+		t := append([]byte{}, u...)
+
+		for i := 1; i < iter; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+
+		out = append(out, t...)
+	}
+
+	return out[:size]
+}
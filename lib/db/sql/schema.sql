@@ -3,6 +3,111 @@
 CREATE TABLE apps IF NOT EXISTS (
     handle TEXT PRIMARY KEY NOT NULL,
     token TEXT,
+    service TEXT,
+    did TEXT,
+    password TEXT,
+    refresh_token TEXT,
+    is_default BOOLEAN DEFAULT FALSE NOT NULL,
+    reply_rules TEXT,
+    no_quotes BOOLEAN DEFAULT FALSE NOT NULL,
+    auth_server TEXT,
+    oauth_client_id TEXT,
+    dpop_key TEXT,
+    pds TEXT,
     created_at TEXT NOT NULL,
     updated_at TEXT NOT NULL
 );
+
+CREATE TABLE quotes IF NOT EXISTS (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    text TEXT NOT NULL,
+    author TEXT,
+    tags TEXT,
+    langs TEXT,
+    labels TEXT,
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL
+);
+
+CREATE TABLE notification_state IF NOT EXISTS (
+    account TEXT PRIMARY KEY NOT NULL,
+    seen_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL
+);
+
+CREATE TABLE blocklist IF NOT EXISTS (
+    actor TEXT PRIMARY KEY NOT NULL,
+    created_at TEXT NOT NULL
+);
+
+CREATE TABLE convo_state IF NOT EXISTS (
+    account TEXT NOT NULL,
+    convo_id TEXT NOT NULL,
+    last_message_id TEXT NOT NULL,
+    updated_at TEXT NOT NULL,
+    PRIMARY KEY (account, convo_id)
+);
+
+CREATE TABLE history IF NOT EXISTS (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    account TEXT NOT NULL,
+    uri TEXT UNIQUE NOT NULL,
+    cid TEXT,
+    text TEXT NOT NULL,
+    tags TEXT,
+    quote_id INTEGER REFERENCES quotes (id) ON DELETE SET NULL,
+    draft_id INTEGER REFERENCES drafts (id) ON DELETE SET NULL,
+    posted_at TEXT NOT NULL,
+    created_at TEXT NOT NULL
+);
+
+CREATE TABLE post_metrics IF NOT EXISTS (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    post_id INTEGER NOT NULL REFERENCES history (id) ON DELETE CASCADE,
+    likes INTEGER NOT NULL,
+    reposts INTEGER NOT NULL,
+    replies INTEGER NOT NULL,
+    quotes INTEGER NOT NULL,
+    collected_at TEXT NOT NULL
+);
+
+CREATE TABLE drafts IF NOT EXISTS (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    account TEXT,
+    message TEXT NOT NULL,
+    source TEXT NOT NULL,
+    status TEXT NOT NULL,
+    uri TEXT,
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL
+);
+
+CREATE TABLE backups IF NOT EXISTS (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    account TEXT NOT NULL,
+    rev TEXT NOT NULL,
+    commit_cid TEXT NOT NULL,
+    car BLOB NOT NULL,
+    records INTEGER NOT NULL,
+    created_at TEXT NOT NULL
+);
+
+CREATE TABLE archived_posts IF NOT EXISTS (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    account TEXT NOT NULL,
+    uri TEXT UNIQUE NOT NULL,
+    cid TEXT NOT NULL,
+    record TEXT NOT NULL,
+    text TEXT NOT NULL,
+    posted_at TEXT,
+    backup_id INTEGER REFERENCES backups (id) ON DELETE SET NULL,
+    archived_at TEXT NOT NULL
+);
+
+CREATE TABLE blobs IF NOT EXISTS (
+    cid TEXT PRIMARY KEY NOT NULL,
+    account TEXT NOT NULL,
+    mime_type TEXT,
+    data BLOB NOT NULL,
+    created_at TEXT NOT NULL
+);
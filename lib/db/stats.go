@@ -0,0 +1,187 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Post ages in hours the decay curve is sampled at
+var DecayHours = []int{1, 3, 6, 12, 24, 48, 72, 168}
+
+// Average engagement of the posts sharing a quote, hour, weekday or tag
+type Ranked struct {
+	Key        string  `json:"key"`
+	Posts      int     `json:"posts"`
+	Engagement float64 `json:"engagement"`
+	// Quote ranked, set for top quotes only
+	QuoteID int `json:"quoteId,omitempty"`
+}
+
+// Share of its latest engagement a post had reached by Hours after posting
+type DecayPoint struct {
+	Hours int     `json:"hours"`
+	Posts int     `json:"posts"`
+	Share float64 `json:"share"`
+}
+
+type Report struct {
+	Posts     int          `json:"posts"`
+	TopQuotes []Ranked     `json:"topQuotes"`
+	Hours     []Ranked     `json:"hours"`
+	Weekdays  []Ranked     `json:"weekdays"`
+	Tags      []Ranked     `json:"tags"`
+	Decay     []DecayPoint `json:"decay"`
+}
+
+type tally map[string]*Ranked
+
+func (t tally) add(key string, engagement int) {
+	r, ok := t[key]
+
+	if !ok {
+		r = &Ranked{Key: key}
+		t[key] = r
+	}
+
+	r.Posts++
+	r.Engagement += float64(engagement)
+}
+
+// Counts a post made from a quote under its id, keyed by the quote's text
+//
+// Removed quotes fall back to the text they were posted with.
+func (t tally) addQuote(p HistoryPost, engagement int) {
+	id := strconv.Itoa(p.QuoteID)
+
+	if _, ok := t[id]; !ok {
+		text := p.QuoteText
+
+		if text == "" {
+			text = p.Text
+		}
+
+		t[id] = &Ranked{Key: text, QuoteID: p.QuoteID}
+	}
+
+	t.add(id, engagement)
+}
+
+// Averages, best first, keeping at most n when n > 0
+func (t tally) ranked(n int) []Ranked {
+	out := []Ranked{}
+
+	for _, r := range t {
+		r.Engagement /= float64(r.Posts)
+		out = append(out, *r)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Engagement != out[j].Engagement {
+			return out[i].Engagement > out[j].Engagement
+		}
+
+		if out[i].Key != out[j].Key {
+			return out[i].Key < out[j].Key
+		}
+
+		return out[i].QuoteID < out[j].QuoteID
+	})
+
+	if n > 0 && len(out) > n {
+		out = out[:n]
+	}
+
+	return out
+}
+
+// Builds the engagement report from post history and its snapshots
+//
+// Each post counts with its latest snapshot, posts never collected are left
+// out. Top quotes only count posts made from a stored quote. Hours and
+// weekdays use the local time zone.
+func BuildReport(posts []HistoryPost, snaps []Snapshot, top int) Report {
+	byPost := map[int][]Snapshot{}
+
+	for _, s := range snaps {
+		byPost[s.PostID] = append(byPost[s.PostID], s)
+	}
+
+	for _, s := range byPost {
+		sort.Slice(s, func(i, j int) bool { return s[i].CollectedAt.Before(s[j].CollectedAt) })
+	}
+
+	quotes, hours, days, tags := tally{}, tally{}, tally{}, tally{}
+	reached := make([]float64, len(DecayHours))
+	sampled := make([]int, len(DecayHours))
+	r := Report{}
+
+	for _, p := range posts {
+		s := byPost[p.ID]
+
+		if len(s) == 0 {
+			continue
+		}
+
+		latest := s[len(s)-1].Total()
+		posted := p.PostedAt.Local()
+
+		r.Posts++
+
+		if p.QuoteID != 0 {
+			quotes.addQuote(p, latest)
+		}
+
+		hours.add(fmt.Sprintf("%02d:00", posted.Hour()), latest)
+		days.add(posted.Weekday().String(), latest)
+
+		for _, t := range p.Tags {
+			tags.add("#"+t, latest)
+		}
+
+		if latest == 0 {
+			continue
+		}
+
+		for i, h := range DecayHours {
+			cutoff := p.PostedAt.Add(time.Duration(h) * time.Hour)
+
+			// Only ages the collector has actually seen the post past
+			if s[len(s)-1].CollectedAt.Before(cutoff) {
+				break
+			}
+
+			at := 0
+
+			for _, snap := range s {
+				if snap.CollectedAt.After(cutoff) {
+					break
+				}
+
+				at = snap.Total()
+			}
+
+			reached[i] += float64(at) / float64(latest)
+			sampled[i]++
+		}
+	}
+
+	r.TopQuotes = quotes.ranked(top)
+	r.Hours = hours.ranked(0)
+	r.Weekdays = days.ranked(0)
+	r.Tags = tags.ranked(top)
+	r.Decay = []DecayPoint{}
+
+	for i, h := range DecayHours {
+		if sampled[i] == 0 {
+			continue
+		}
+
+		r.Decay = append(r.Decay, DecayPoint{
+			Hours: h, Posts: sampled[i], Share: reached[i] / float64(sampled[i]),
+		})
+	}
+
+	return r
+}
@@ -0,0 +1,76 @@
+package publish
+
+import (
+	"context"
+
+	"github.com/desertthunder/quotesky/lib/api"
+)
+
+// Authenticated clients by account handle or DID, the default account for ""
+type Clients interface {
+	Client(ctx context.Context, account string) (*api.Client, error)
+}
+
+type single struct {
+	c *api.Client
+}
+
+func (s single) Client(context.Context, string) (*api.Client, error) {
+	return s.c, nil
+}
+
+// Publishes to Bluesky as the message's account
+type Bluesky struct {
+	clients Clients
+}
+
+// Bluesky constructor
+func NewBluesky(c Clients) *Bluesky {
+	return &Bluesky{clients: c}
+}
+
+// Bluesky publisher posting every message with c
+func BlueskyClient(c *api.Client) *Bluesky {
+	return NewBluesky(single{c})
+}
+
+func (b *Bluesky) Publish(ctx context.Context, m api.Message) (*Result, error) {
+	c, err := b.clients.Client(ctx, m.Account)
+
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.CreatePost(ctx, m)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{
+		ID: res.URI, URL: res.WebURL(), Account: c.Credentials.DID, Post: res,
+	}, nil
+}
+
+// Deletes the post at-uri id from the account whose repo holds it
+//
+// Clients looks the account up by the uri's DID.
+func (b *Bluesky) Delete(ctx context.Context, id string) error {
+	u, err := api.ParseATURI(id)
+
+	if err != nil {
+		return err
+	}
+
+	c, err := b.clients.Client(ctx, u.Authority)
+
+	if err != nil {
+		return err
+	}
+
+	return c.DeletePosts(ctx, []string{id})
+}
+
+func (b *Bluesky) Capabilities() Capabilities {
+	return Capabilities{MaxLength: api.MaxPostLength, Threads: true, Delete: true, Labels: true}
+}
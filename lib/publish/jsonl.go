@@ -0,0 +1,85 @@
+package publish
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/desertthunder/quotesky/lib/api"
+)
+
+// Line appended to a JSONL sink
+type Entry struct {
+	ID          string           `json:"id"`
+	PublishedAt string           `json:"publishedAt,omitempty"`
+	DeletedAt   string           `json:"deletedAt,omitempty"`
+	Message     *api.Message     `json:"message,omitempty"`
+	Records     []api.PostRecord `json:"records,omitempty"`
+}
+
+// Appends each message and its records to a file, one JSON object per line
+//
+// Deletes append a tombstone entry rather than rewriting the file.
+type JSONL struct {
+	mu   sync.Mutex
+	path string
+}
+
+// JSONL constructor
+func NewJSONL(path string) *JSONL {
+	return &JSONL{path: path}
+}
+
+func (j *JSONL) append(e Entry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	f, err := os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	data, err := json.Marshal(e)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(append(data, '\n'))
+
+	return err
+}
+
+func (j *JSONL) Publish(ctx context.Context, m api.Message) (*Result, error) {
+	id := m.Rkey
+
+	if id == "" {
+		id = api.NewTID()
+	}
+
+	e := Entry{
+		ID:          id,
+		PublishedAt: time.Now().UTC().Format(time.RFC3339),
+		Message:     &m,
+		Records:     api.BuildThread(m, j.Capabilities().MaxLength),
+	}
+
+	if err := j.append(e); err != nil {
+		return nil, err
+	}
+
+	return &Result{ID: id}, nil
+}
+
+func (j *JSONL) Delete(ctx context.Context, id string) error {
+	return j.append(Entry{ID: id, DeletedAt: time.Now().UTC().Format(time.RFC3339)})
+}
+
+func (j *JSONL) Capabilities() Capabilities {
+	return Capabilities{MaxLength: api.MaxPostLength, Threads: true, Delete: true, Labels: true}
+}
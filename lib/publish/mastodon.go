@@ -0,0 +1,207 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/desertthunder/quotesky/lib/api"
+)
+
+// Characters a status may have on a stock Mastodon server
+const MastodonMaxLength int = 500
+
+// Publishes statuses through the Mastodon API
+//
+// Works with servers implementing the same API, e.g. GoToSocial or Akkoma.
+type Mastodon struct {
+	Server     string
+	Token      string
+	Visibility string
+	HTTP       *http.Client
+}
+
+// Mastodon constructor
+func NewMastodon(server string, token string) *Mastodon {
+	return &Mastodon{
+		Server:     strings.TrimSuffix(server, "/"),
+		Token:      token,
+		Visibility: "public",
+		HTTP:       &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Mastodon publisher configured by MASTODON_SERVER & MASTODON_TOKEN
+func MastodonFromEnv() (*Mastodon, error) {
+	server, token := os.Getenv("MASTODON_SERVER"), os.Getenv("MASTODON_TOKEN")
+
+	if server == "" || token == "" {
+		return nil, fmt.Errorf("MASTODON_SERVER and MASTODON_TOKEN must be set")
+	}
+
+	return NewMastodon(server, token), nil
+}
+
+type mastodonStatus struct {
+	Status      string `json:"status"`
+	InReplyToID string `json:"in_reply_to_id,omitempty"`
+	Language    string `json:"language,omitempty"`
+	Sensitive   bool   `json:"sensitive,omitempty"`
+	SpoilerText string `json:"spoiler_text,omitempty"`
+	Visibility  string `json:"visibility,omitempty"`
+}
+
+type mastodonError struct {
+	Error string `json:"error"`
+}
+
+func (m *Mastodon) request(
+	ctx context.Context, method string, path string, key string, in any, out any,
+) error {
+	var body io.Reader
+
+	if in != nil {
+		data, err := json.Marshal(in)
+
+		if err != nil {
+			return err
+		}
+
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, m.Server+path, body)
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+m.Token)
+
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	// Lets the server drop retried requests it already handled
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+
+	res, err := m.HTTP.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode >= 300 {
+		e := mastodonError{}
+		json.Unmarshal(data, &e)
+
+		return fmt.Errorf("mastodon %d: %s", res.StatusCode, e.Error)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.Unmarshal(data, out)
+}
+
+// Posts the message's parts as a reply chain, returning the first status
+//
+// Parts are split at the server's own limit and carry no timestamp.
+// Self-labels become a content warning. When a later part fails, the statuses
+// already posted are returned with the error, and publishing the same message
+// again picks up where it stopped since the server drops repeated keys.
+func (m *Mastodon) Publish(ctx context.Context, msg api.Message) (*Result, error) {
+	key := idempotencyKey(msg)
+	langs := msg.Langs
+
+	if len(langs) == 0 {
+		langs = api.DetectLangs(msg.Content)
+	}
+
+	var first *Result
+	parent := ""
+
+	parts := api.SplitText(msg.Content, m.Capabilities().MaxLength)
+
+	for i, text := range parts {
+		s := mastodonStatus{
+			Status:      text,
+			InReplyToID: parent,
+			Visibility:  m.Visibility,
+			Sensitive:   len(msg.Labels) > 0,
+			SpoilerText: strings.Join(msg.Labels, ", "),
+		}
+
+		if len(langs) > 0 {
+			s.Language = strings.SplitN(langs[0], "-", 2)[0]
+		}
+
+		out := struct {
+			ID  string `json:"id"`
+			URL string `json:"url"`
+		}{}
+
+		err := m.request(ctx, http.MethodPost, "/api/v1/statuses",
+			fmt.Sprintf("%s-%d", key, i), s, &out)
+
+		if err != nil && first != nil {
+			return first, fmt.Errorf("part %d of %d: %w", i+1, len(parts), err)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if first == nil {
+			first = &Result{ID: out.ID, URL: out.URL}
+		}
+
+		parent = out.ID
+	}
+
+	return first, nil
+}
+
+// Key the server deduplicates posts of msg by, its record key when set
+//
+// Otherwise the key is a hash of the message, so retries of the same message
+// share it.
+func idempotencyKey(msg api.Message) string {
+	if msg.Rkey != "" {
+		return msg.Rkey
+	}
+
+	data, _ := json.Marshal(msg)
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:16])
+}
+
+// Deletes the status with id
+func (m *Mastodon) Delete(ctx context.Context, id string) error {
+	return m.request(ctx, http.MethodDelete, "/api/v1/statuses/"+url.PathEscape(id), "", nil, nil)
+}
+
+func (m *Mastodon) Capabilities() Capabilities {
+	return Capabilities{MaxLength: MastodonMaxLength, Threads: true, Delete: true, Labels: true}
+}
@@ -0,0 +1,104 @@
+// Destinations messages can be published to
+package publish
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/desertthunder/quotesky/lib/api"
+)
+
+// What a destination supports
+type Capabilities struct {
+	// Longest post in characters, longer messages are threaded
+	MaxLength int
+	Threads   bool
+	Delete    bool
+	// Whether self-labels become content warnings
+	Labels bool
+}
+
+// Outcome of publishing one message to one destination
+type Result struct {
+	Destination string `json:"destination"`
+	// Identifier Delete takes, e.g. an at-uri or status id
+	ID  string `json:"id,omitempty"`
+	URL string `json:"url,omitempty"`
+	// Account the message was posted as, when the destination has one
+	Account string `json:"account,omitempty"`
+	// Created records when posted to Bluesky
+	Post *api.PostResult `json:"-"`
+	Err  error           `json:"-"`
+}
+
+// Destination messages are published to
+//
+// Publish may return what it managed to post along with an error.
+type Publisher interface {
+	Publish(ctx context.Context, m api.Message) (*Result, error)
+	Delete(ctx context.Context, id string) error
+	Capabilities() Capabilities
+}
+
+// Named publisher
+type Destination struct {
+	Name string
+	Publisher
+}
+
+// Publishes m to every destination concurrently
+//
+// Results are in the order of dests, failures carry their error in Err
+// alongside anything posted before it.
+func FanOut(ctx context.Context, dests []Destination, m api.Message) []Result {
+	results := make([]Result, len(dests))
+	wg := sync.WaitGroup{}
+
+	for i, d := range dests {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			r, err := d.Publish(ctx, m)
+
+			if r != nil {
+				results[i] = *r
+			}
+
+			results[i].Err = err
+			results[i].Destination = d.Name
+		}()
+	}
+
+	wg.Wait()
+
+	return results
+}
+
+// Destinations named in names, all of them when names is empty
+func Select(dests []Destination, names []string) ([]Destination, error) {
+	if len(names) == 0 {
+		return dests, nil
+	}
+
+	out := []Destination{}
+
+	for _, n := range names {
+		found := false
+
+		for _, d := range dests {
+			if d.Name == n {
+				out = append(out, d)
+				found = true
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("unknown destination %s", n)
+		}
+	}
+
+	return out, nil
+}
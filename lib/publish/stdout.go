@@ -0,0 +1,46 @@
+package publish
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/desertthunder/quotesky/lib/api"
+)
+
+// Writes the records a message would create instead of posting them
+type Stdout struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// Stdout constructor, usually given os.Stdout
+func NewStdout(w io.Writer) *Stdout {
+	return &Stdout{w: w}
+}
+
+func (s *Stdout) Publish(ctx context.Context, m api.Message) (*Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := json.NewEncoder(s.w)
+	e.SetIndent("", "  ")
+
+	for _, p := range api.BuildThread(m, s.Capabilities().MaxLength) {
+		if err := e.Encode(p); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Result{ID: "dry-run"}, nil
+}
+
+// Nothing was posted, so there is nothing to delete
+func (s *Stdout) Delete(ctx context.Context, id string) error {
+	return nil
+}
+
+func (s *Stdout) Capabilities() Capabilities {
+	return Capabilities{MaxLength: api.MaxPostLength, Threads: true, Labels: true}
+}
@@ -0,0 +1,364 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/desertthunder/quotesky/cmd/server"
+	"github.com/desertthunder/quotesky/lib/api"
+	"github.com/desertthunder/quotesky/lib/db"
+)
+
+// Secrets as stored, by column, for every account
+func storedSecrets(t *testing.T) map[string][]string {
+	t.Helper()
+
+	conn, err := sql.Open("sqlite3", "db.sqlite3")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	rows, err := conn.Query(`SELECT handle, COALESCE(password, ''), COALESCE(token, ''),
+		COALESCE(refresh_token, ''), COALESCE(dpop_key, '') FROM apps`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rows.Close()
+
+	secrets := map[string][]string{}
+
+	for rows.Next() {
+		h, vals := "", make([]string, 4)
+
+		if err := rows.Scan(&h, &vals[0], &vals[1], &vals[2], &vals[3]); err != nil {
+			t.Fatal(err)
+		}
+
+		secrets[h] = vals
+	}
+
+	return secrets
+}
+
+func TestAccountSecrets(t *testing.T) {
+	migrated(t)
+	t.Setenv("QSKY_PASSPHRASE", "correct horse")
+
+	a, err := db.InitAppRepo(false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.SaveAccount("bot.test", "abcd-efgh-ijkl-mnop", "https://pds.test"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.SetSession("bot.test", "did:plc:bot", "", "access", "refresh"); err != nil {
+		t.Fatal(err)
+	}
+
+	err = a.SaveOAuth(db.App{
+		Handle:       "oauth.test",
+		DID:          "did:plc:oauth",
+		Service:      "https://pds.test",
+		Token:        "oauth-access",
+		RefreshToken: "oauth-refresh",
+		DPoPKey:      "dpop-key",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain := map[string][]string{
+		"bot.test":   {"abcd-efgh-ijkl-mnop", "access", "refresh", ""},
+		"oauth.test": {"", "oauth-access", "oauth-refresh", "dpop-key"},
+	}
+
+	// Checks every stored secret is sealed and opens to its plaintext with c
+	sealedUnder := func(t *testing.T, c db.Cipher) map[string][]string {
+		t.Helper()
+
+		stored := storedSecrets(t)
+
+		for h, vals := range plain {
+			for i, v := range vals {
+				got := stored[h][i]
+
+				if v == "" {
+					if got != "" {
+						t.Errorf("%s column %d: expected nothing, got %q", h, i, got)
+					}
+
+					continue
+				}
+
+				if !db.IsSealed(got) {
+					t.Errorf("%s column %d is stored in plaintext: %q", h, i, got)
+					continue
+				}
+
+				if opened, err := c.Open(got); err != nil || opened != v {
+					t.Errorf("%s column %d opened to %q (%v), want %q", h, i, opened, err, v)
+				}
+			}
+		}
+
+		return stored
+	}
+
+	first, _ := db.PassphraseCipher("correct horse")
+	next, _ := db.PassphraseCipher("battery staple")
+	var before map[string][]string
+
+	t.Run("secrets are sealed at rest", func(t *testing.T) {
+		before = sealedUnder(t, first)
+	})
+
+	t.Run("stored accounts are read back in plaintext", func(t *testing.T) {
+		for h, vals := range plain {
+			app, err := a.GetByHandle(h)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := []string{app.Password, app.Token, app.RefreshToken, app.DPoPKey}
+
+			for i := range vals {
+				if got[i] != vals[i] {
+					t.Errorf("%s column %d read as %q, want %q", h, i, got[i], vals[i])
+				}
+			}
+		}
+	})
+
+	t.Run("sealed secrets need a key", func(t *testing.T) {
+		t.Setenv("QSKY_PASSPHRASE", "")
+
+		keyless, err := db.InitAppRepo(false)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := keyless.GetByHandle("bot.test"); !errors.Is(err, db.ErrNoKey) {
+			t.Errorf("expected ErrNoKey, got %v", err)
+		}
+	})
+
+	t.Run("an unreadable key file is an error", func(t *testing.T) {
+		t.Setenv("QSKY_KEY_FILE", filepath.Join(t.TempDir(), "missing"))
+
+		if _, err := db.InitAppRepo(false); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("rotation re-encrypts every column", func(t *testing.T) {
+		n, err := a.Rotate(next)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if n != len(plain) {
+			t.Errorf("expected %d accounts rewritten, got %d", len(plain), n)
+		}
+
+		after := sealedUnder(t, next)
+
+		for h, vals := range after {
+			for i, v := range vals {
+				if v == "" {
+					continue
+				}
+
+				if v == before[h][i] {
+					t.Errorf("%s column %d was not rewritten", h, i)
+				}
+
+				if _, err := first.Open(v); err == nil {
+					t.Errorf("%s column %d still opens with the old key", h, i)
+				}
+			}
+		}
+
+		t.Setenv("QSKY_PASSPHRASE", "battery staple")
+		rotated, err := db.InitAppRepo(false)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		app, err := rotated.GetByHandle("bot.test")
+
+		if err != nil || app.Password != plain["bot.test"][0] {
+			t.Errorf("expected the new key to read the password, got %+v (%v)", app, err)
+		}
+	})
+}
+
+func TestStoredPDS(t *testing.T) {
+	migrated(t)
+	t.Setenv("QSKY_PASSPHRASE", "")
+
+	a, err := db.InitAppRepo(false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.SaveAccount("bot.test", "hunter2", "https://entryway.test"); err != nil {
+		t.Fatal(err)
+	}
+
+	err = a.SetSession("bot.test", "did:plc:bot", "https://old.test", "stale", "refresh")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("stored clients call the account's pds", func(t *testing.T) {
+		app, err := a.GetByHandle("bot.test")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := server.StoredClient(a, app)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if c.Credentials.ServiceEndpoint != "https://old.test" ||
+			c.Service != "https://entryway.test" {
+			t.Errorf("expected the pds, got %s via %s", c.Credentials.ServiceEndpoint, c.Service)
+		}
+	})
+
+	t.Run("sessions without a did document keep the pds", func(t *testing.T) {
+		if err := a.SetSession("bot.test", "did:plc:bot", "", "stale", "refresh"); err != nil {
+			t.Fatal(err)
+		}
+
+		if app, _ := a.GetByHandle("bot.test"); app.PDS != "https://old.test" {
+			t.Errorf("expected the pds to be kept, got %q", app.PDS)
+		}
+	})
+
+	t.Run("renewed sessions store the new pds", func(t *testing.T) {
+		app, _ := a.GetByHandle("bot.test")
+		c, err := server.StoredClient(a, app)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		hosts := []string{}
+		f := &expiringTransport{valid: map[string]bool{}}
+		c.HTTP = &http.Client{Transport: hostRecorder{f, &hosts}}
+
+		if _, err := c.GetSession(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		want := "old.test old.test pds.test"
+
+		if strings.Join(hosts, " ") != want {
+			t.Errorf("expected calls to %s, got %v", want, hosts)
+		}
+
+		if app, _ := a.GetByHandle("bot.test"); app.PDS != "https://pds.test" {
+			t.Errorf("expected the new pds to be stored, got %q", app.PDS)
+		}
+	})
+}
+
+func TestStoredOAuthPDS(t *testing.T) {
+	migrated(t)
+	t.Setenv("QSKY_PASSPHRASE", "")
+
+	a, err := db.InitAppRepo(false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, _ := api.NewDPoP()
+	encoded, _ := key.Encode()
+	oauth := db.App{
+		Handle:     "oauth.test",
+		DID:        "did:plc:oauth",
+		Service:    "https://entryway.test",
+		PDS:        "https://pds.test",
+		Token:      "access",
+		AuthServer: "https://auth.test",
+		DPoPKey:    encoded,
+	}
+
+	if err := a.SaveOAuth(oauth); err != nil {
+		t.Fatal(err)
+	}
+
+	app, err := a.GetByHandle("oauth.test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if app.PDS != oauth.PDS || app.Service != oauth.Service {
+		t.Errorf("expected the pds apart from the service, got %q and %q", app.PDS, app.Service)
+	}
+
+	t.Run("refreshed tokens are stored with the pds", func(t *testing.T) {
+		// Accounts signed in before the pds was stored kept it as their service
+		legacy := oauth
+		legacy.Service, legacy.PDS = oauth.PDS, ""
+
+		if err := a.SaveOAuth(legacy); err != nil {
+			t.Fatal(err)
+		}
+
+		app, _ := a.GetByHandle("oauth.test")
+		c, err := server.StoredClient(a, app)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		refreshed := api.TokenResponse{Sub: "did:plc:oauth", AccessToken: "next"}
+
+		if err := c.OAuth.OnRefresh(refreshed); err != nil {
+			t.Fatal(err)
+		}
+
+		if app, _ := a.GetByHandle("oauth.test"); app.PDS != "https://pds.test" {
+			t.Errorf("expected the pds to be stored, got %q", app.PDS)
+		}
+	})
+}
+
+// Transport noting the host of each request before passing it on
+type hostRecorder struct {
+	next  http.RoundTripper
+	hosts *[]string
+}
+
+func (h hostRecorder) RoundTrip(r *http.Request) (*http.Response, error) {
+	*h.hosts = append(*h.hosts, r.URL.Host)
+
+	return h.next.RoundTrip(r)
+}
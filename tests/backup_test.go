@@ -0,0 +1,233 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/desertthunder/quotesky/lib/api"
+)
+
+const codecDAGCBOR byte = 0x71
+
+// Adds v to blocks as DAG-CBOR, returning its CID
+func block(t *testing.T, blocks *[][]byte, v any) api.CID {
+	data, err := api.MarshalDAGCBOR(v)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := api.NewCID(codecDAGCBOR, data)
+	*blocks = append(*blocks, append(append([]byte{}, c...), data...))
+
+	return c
+}
+
+func link(c api.CID) map[string]any {
+	return map[string]any{"$link": c.String()}
+}
+
+func key(s string) map[string]any {
+	return map[string]any{"$bytes": base64.StdEncoding.EncodeToString([]byte(s))}
+}
+
+// CAR of a repo with two posts, one with an image, and a follow
+//
+// The tree has a left subtree and a key compressed against its neighbour.
+func testRepo(t *testing.T) ([]byte, string) {
+	blocks := [][]byte{}
+	img := api.NewCID(0x55, []byte("png")).String()
+
+	first := block(t, &blocks, map[string]any{
+		"$type": "app.bsky.feed.post", "text": "first", "createdAt": "2026-10-01T10:00:00Z",
+	})
+	second := block(t, &blocks, map[string]any{
+		"$type": "app.bsky.feed.post", "text": "second", "createdAt": "2026-10-02T10:00:00Z",
+		"embed": map[string]any{
+			"$type": "app.bsky.embed.images",
+			"images": []any{map[string]any{"alt": "", "image": map[string]any{
+				"$type": "blob", "ref": map[string]any{"$link": img},
+				"mimeType": "image/png", "size": 3,
+			}}},
+		},
+	})
+	follow := block(t, &blocks, map[string]any{
+		"$type": "app.bsky.graph.follow", "subject": "did:plc:partner",
+		"createdAt": "2026-10-03T10:00:00Z",
+	})
+
+	left := block(t, &blocks, map[string]any{"l": nil, "e": []any{
+		map[string]any{"p": 0, "k": key("app.bsky.feed.post/3ka"), "v": link(first), "t": nil},
+	}})
+	root := block(t, &blocks, map[string]any{"l": link(left), "e": []any{
+		map[string]any{"p": 0, "k": key("app.bsky.feed.post/3kb"), "v": link(second), "t": nil},
+		map[string]any{"p": 9, "k": key("graph.follow/3kc"), "v": link(follow), "t": nil},
+	}})
+	commit := block(t, &blocks, map[string]any{
+		"did": "did:plc:bot", "version": 3, "data": link(root), "rev": "3krev",
+		"prev": nil, "sig": map[string]any{"$bytes": "c2ln"},
+	})
+
+	header, err := api.MarshalDAGCBOR(map[string]any{
+		"version": 1, "roots": []any{link(commit)},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	car := binary.AppendUvarint(nil, uint64(len(header)))
+	car = append(car, header...)
+
+	// Blocks in reverse, as a PDS streams the commit first
+	for i := len(blocks) - 1; i >= 0; i-- {
+		car = binary.AppendUvarint(car, uint64(len(blocks[i])))
+		car = append(car, blocks[i]...)
+	}
+
+	return car, img
+}
+
+func TestBackup(t *testing.T) {
+	ctx := context.Background()
+	data, img := testRepo(t)
+
+	t.Run("records are read from the tree in key order", func(t *testing.T) {
+		car, err := api.ReadCAR(bytes.NewReader(data))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		commit, err := car.Commit()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if commit.DID != "did:plc:bot" || commit.Rev != "3krev" || commit.Version != 3 {
+			t.Errorf("unexpected commit %+v", commit)
+		}
+
+		records, err := car.Records()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := []string{}
+
+		for _, r := range records {
+			got = append(got, r.Collection+"/"+r.Rkey)
+		}
+
+		want := []string{
+			"app.bsky.feed.post/3ka", "app.bsky.feed.post/3kb", "app.bsky.graph.follow/3kc",
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+
+		if v, _ := records[0].Value.(map[string]any); v["text"] != "first" {
+			t.Errorf("unexpected record %v", records[0].Value)
+		}
+
+		if refs := api.BlobRefs(records[1].Value); len(refs) != 1 || refs[0] != img {
+			t.Errorf("expected the image blob, got %v", refs)
+		}
+	})
+
+	t.Run("tampered blocks are rejected", func(t *testing.T) {
+		bad := bytes.Clone(data)
+		bad[len(bad)-2] ^= 0xff
+
+		if _, err := api.ReadCAR(bytes.NewReader(bad)); err == nil {
+			t.Error("expected a cid mismatch")
+		}
+	})
+
+	t.Run("dag-cbor round trips through json", func(t *testing.T) {
+		record := map[string]any{
+			"$type": "app.bsky.feed.post", "text": "héllo", "langs": []any{"en"},
+			"reply": map[string]any{"root": map[string]any{
+				"uri": likedPost, "cid": api.NewCID(codecDAGCBOR, []byte("x")).String(),
+			}},
+			"count": -3, "big": 70000, "ok": true, "none": nil,
+			"ref": map[string]any{"$link": img}, "raw": map[string]any{"$bytes": "AQID"},
+		}
+		enc, err := api.MarshalDAGCBOR(record)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		v, err := api.UnmarshalDAGCBOR(enc)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, _ := json.Marshal(api.JSONValue(v))
+		want, _ := json.Marshal(record)
+
+		if !bytes.Equal(got, want) {
+			t.Errorf("expected %s, got %s", want, got)
+		}
+	})
+
+	t.Run("repos and blobs are downloaded from the pds", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/xrpc/com.atproto.sync.getRepo":
+				if r.URL.Query().Get("did") != "did:plc:bot" {
+					t.Errorf("unexpected did %s", r.URL.RawQuery)
+				}
+
+				w.Header().Set("Content-Type", "application/vnd.ipld.car")
+				w.Write(data)
+			case "/xrpc/com.atproto.sync.getBlob":
+				if r.URL.Query().Get("cid") != img {
+					w.WriteHeader(http.StatusBadRequest)
+					w.Write([]byte(`{"error":"BlobNotFound"}`))
+
+					return
+				}
+
+				w.Header().Set("Content-Type", "image/png")
+				w.Write([]byte("png"))
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+
+		t.Cleanup(srv.Close)
+
+		c := api.Init(srv.URL, false)
+		c.Credentials.DID = "did:plc:bot"
+		c.Credentials.ServiceEndpoint = srv.URL
+
+		repo, err := c.GetRepo(ctx, "did:plc:bot")
+
+		if err != nil || !bytes.Equal(repo, data) {
+			t.Fatalf("unexpected repo download: %v", err)
+		}
+
+		blob, mime, err := c.GetBlob(ctx, "did:plc:bot", img)
+
+		if err != nil || string(blob) != "png" || mime != "image/png" {
+			t.Errorf("unexpected blob %q %s %v", blob, mime, err)
+		}
+
+		if _, _, err := c.GetBlob(ctx, "did:plc:bot", "bafkmissing"); err == nil {
+			t.Error("expected a missing blob error")
+		}
+	})
+}
@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/desertthunder/quotesky/lib/api"
+	"github.com/rivo/uniseg"
+)
+
+func TestDAGCBOR(t *testing.T) {
+	t.Run("canonical map order", func(t *testing.T) {
+		v := map[string]any{"bb": 1, "a": -1, "c": "x", "l": []any{true, nil}}
+		b, err := api.MarshalDAGCBOR(v)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := hex.EncodeToString(b); got != "a461612061636178616c82f5f662626201" {
+			t.Errorf("unexpected encoding %s", got)
+		}
+	})
+
+	t.Run("empty map cid", func(t *testing.T) {
+		c, err := api.RecordCID(map[string]any{})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if c != "bafyreigbtj4x7ip5legnfznufuopl4sg4knzc2cof6duas4b3q2fy6swua" {
+			t.Errorf("unexpected cid %s", c)
+		}
+	})
+
+	t.Run("cid round trip", func(t *testing.T) {
+		s := "bafyreigbtj4x7ip5legnfznufuopl4sg4knzc2cof6duas4b3q2fy6swua"
+		c, err := api.ParseCID(s)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if c.String() != s {
+			t.Errorf("expected %s, got %s", s, c.String())
+		}
+	})
+}
+
+func TestBuildThread(t *testing.T) {
+	t.Run("short messages are a single post", func(t *testing.T) {
+		if n := len(api.BuildThread(api.Message{Content: "hello"}, api.MaxPostLength)); n != 1 {
+			t.Errorf("expected 1 post, got %d", n)
+		}
+	})
+
+	t.Run("long messages are numbered", func(t *testing.T) {
+		m := api.Message{Content: strings.Repeat("courage is grace under pressure ", 30)}
+		posts := api.BuildThread(m, api.MaxPostLength)
+
+		if len(posts) < 2 {
+			t.Fatalf("expected a thread, got %d posts", len(posts))
+		}
+
+		for _, p := range posts {
+			if n := uniseg.GraphemeClusterCount(p.Text); n > api.MaxPostLength {
+				t.Errorf("part is %d graphemes", n)
+			}
+		}
+
+		if !strings.Contains(posts[0].Text, "(1/") {
+			t.Errorf("expected numbered part, got %q", posts[0].Text)
+		}
+	})
+
+	t.Run("length is counted in graphemes", func(t *testing.T) {
+		family := "\U0001F468\u200D\U0001F469\u200D\U0001F467"
+
+		fits := api.Message{Content: strings.Repeat(family, 250)}
+
+		if n := len(api.BuildThread(fits, api.MaxPostLength)); n != 1 {
+			t.Errorf("expected 250 emoji to fit one post, got %d posts", n)
+		}
+
+		posts := api.BuildThread(api.Message{Content: strings.Repeat(family, 400)},
+			api.MaxPostLength)
+
+		if len(posts) != 2 {
+			t.Fatalf("expected 2 posts, got %d", len(posts))
+		}
+
+		total := 0
+
+		for _, p := range posts {
+			if n := uniseg.GraphemeClusterCount(p.Text); n > api.MaxPostLength {
+				t.Errorf("part is %d graphemes", n)
+			}
+
+			text, _, _ := strings.Cut(p.Text, " (")
+
+			if strings.ReplaceAll(text, family, "") != "" {
+				t.Errorf("emoji split mid-sequence: %q", text)
+			}
+
+			total += strings.Count(text, family)
+		}
+
+		if total != 400 {
+			t.Errorf("expected every emoji once, got %d", total)
+		}
+	})
+}
@@ -0,0 +1,101 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/desertthunder/quotesky/lib/api"
+)
+
+// Transport answering every request with the same body
+type fakeTransport struct {
+	body     string
+	requests []*http.Request
+}
+
+func (f *fakeTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	f.requests = append(f.requests, r)
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader(f.body)),
+		Request:    r,
+	}, nil
+}
+
+func fakeClient(body string) (*api.Client, *fakeTransport) {
+	f := &fakeTransport{body: body}
+	c := api.Init("https://entryway.test", false)
+	c.HTTP = &http.Client{Transport: f}
+	c.UserAgent = "quotesky-test"
+	c.Credentials.DID = "did:plc:bot"
+	c.Credentials.AccessToken = "token"
+	c.Credentials.ServiceEndpoint = "https://pds.test"
+
+	return c, f
+}
+
+func TestClient(t *testing.T) {
+	t.Run("create post through fake transport", func(t *testing.T) {
+		c, f := fakeClient(
+			`{"uri":"at://did:plc:bot/app.bsky.feed.post/3jzfcijpj2z2a","cid":"bafy"}`,
+		)
+
+		res, err := c.CreatePost(context.Background(), api.Message{Content: "hi"})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(f.requests) != 1 {
+			t.Fatalf("expected 1 request, got %d", len(f.requests))
+		}
+
+		r := f.requests[0]
+
+		if r.Header.Get("User-Agent") != "quotesky-test" {
+			t.Errorf("unexpected user agent %q", r.Header.Get("User-Agent"))
+		}
+
+		if r.URL.Host != "pds.test" {
+			t.Errorf("expected request to the pds, got %s", r.URL.Host)
+		}
+
+		if res.WebURL() != "https://bsky.app/profile/did:plc:bot/post/3jzfcijpj2z2a" {
+			t.Errorf("unexpected link %s", res.WebURL())
+		}
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		c, _ := fakeClient(`{}`)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := c.CreatePost(ctx, api.Message{Content: "hi"})
+
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	})
+
+	t.Run("auth factor token required", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":"AuthFactorTokenRequired","message":"A sign in code has been sent"}`)
+		}))
+		defer srv.Close()
+
+		_, err := api.Init(srv.URL, false).CreateSession(context.Background())
+
+		if !errors.Is(err, api.ErrAuthFactorTokenRequired) {
+			t.Errorf("expected ErrAuthFactorTokenRequired, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,39 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/desertthunder/quotesky/lib/db"
+)
+
+// Runs the tests of t against a freshly migrated database
+//
+// Repositories open db.sqlite3 in the working directory, so the test moves
+// into a temporary one for its duration.
+func migrated(t *testing.T) {
+	t.Helper()
+
+	dir, err := filepath.Abs("../lib/db/migrations")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wd, err := os.Getwd()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	if err := db.Runner(dir, db.Connect(false), false).Execute(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,256 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/desertthunder/quotesky/cmd/server"
+	"github.com/desertthunder/quotesky/lib/api"
+	"github.com/desertthunder/quotesky/lib/db"
+)
+
+func TestDraftRepository(t *testing.T) {
+	migrated(t)
+
+	r := db.InitDraftRepo(false)
+
+	id, err := r.Add("bot.test", `{"Content":"first"}`, "cli")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := r.Add("", `{"Content":"second"}`, "tcp")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("added drafts are pending", func(t *testing.T) {
+		d, err := r.Get(id)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if d.Status != db.DraftPending || d.Account != "bot.test" || d.Source != "cli" {
+			t.Errorf("unexpected draft %+v", d)
+		}
+	})
+
+	t.Run("pending drafts can be edited", func(t *testing.T) {
+		if err := r.Update(id, "", `{"Content":"edited"}`); err != nil {
+			t.Fatal(err)
+		}
+
+		d, _ := r.Get(id)
+
+		if d.Message != `{"Content":"edited"}` || d.Account != "" {
+			t.Errorf("unexpected draft %+v", d)
+		}
+	})
+
+	t.Run("published drafts are frozen", func(t *testing.T) {
+		uri := "at://did:plc:bot/app.bsky.feed.post/3kpost"
+
+		if err := r.Published(id, uri); err != nil {
+			t.Fatal(err)
+		}
+
+		d, _ := r.Get(id)
+
+		if d.Status != db.DraftPublished || d.URI != uri {
+			t.Errorf("unexpected draft %+v", d)
+		}
+
+		if err := r.Update(id, "", `{"Content":"too late"}`); err == nil {
+			t.Error("expected a published draft not to be editable")
+		}
+
+		if err := r.Discard(id); err == nil {
+			t.Error("expected a published draft not to be discardable")
+		}
+
+		if err := r.Published(id, "at://elsewhere"); err == nil {
+			t.Error("expected a draft to be published once")
+		}
+	})
+
+	t.Run("list shows pending drafts unless all are asked for", func(t *testing.T) {
+		pending, _ := r.List(false)
+		all, _ := r.List(true)
+
+		if len(pending) != 1 || pending[0].ID != other {
+			t.Errorf("expected only draft %d pending, got %+v", other, pending)
+		}
+
+		if len(all) != 2 {
+			t.Errorf("expected 2 drafts, got %d", len(all))
+		}
+	})
+
+	t.Run("discarded drafts are gone", func(t *testing.T) {
+		if err := r.Discard(other); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := r.Get(other); err == nil {
+			t.Error("expected the draft to be deleted")
+		}
+
+		if err := r.Discard(other); err == nil {
+			t.Error("expected a second discard to fail")
+		}
+	})
+}
+
+func TestParseDraft(t *testing.T) {
+	cases := []struct {
+		arg  string
+		want api.Message
+		err  bool
+	}{
+		{arg: "plain text", want: api.Message{Content: "plain text"}},
+		{arg: `{"Content":"json","Langs":["en"],"Account":"bot.test"}`,
+			want: api.Message{Content: "json", Langs: []string{"en"}, Account: "bot.test"}},
+		{arg: `{"Content":"hi","Labels":["porn"],"Rkey":"3kpost"}`,
+			want: api.Message{Content: "hi", Labels: []string{"porn"}, Rkey: "3kpost"}},
+		{arg: `{"Content":`, err: true},
+		{arg: `{"Langs":["en"]}`, err: true},
+		{arg: "   ", err: true},
+		{arg: `{"Content":"hi","Langs":["not a tag"]}`, err: true},
+		{arg: `{"Content":"hi","Labels":["spoilers"]}`, err: true},
+		{arg: `{"Content":"hi","Gates":{"Replies":["everyone","followers"]}}`, err: true},
+	}
+
+	for _, c := range cases {
+		m, err := server.ParseDraft(c.arg)
+
+		if (err != nil) != c.err {
+			t.Errorf("ParseDraft(%q) error = %v", c.arg, err)
+			continue
+		}
+
+		if !c.err && !reflect.DeepEqual(m, c.want) {
+			t.Errorf("ParseDraft(%q) = %+v, want %+v", c.arg, m, c.want)
+		}
+	}
+}
+
+// Record without the parts that depend on when it was built
+func timeless(p api.PostRecord) api.PostRecord {
+	p.CreatedAt = ""
+	p.Text = p.Text[:strings.LastIndex(strings.TrimSuffix(p.Text, "\n"), "\n")]
+
+	return p
+}
+
+func TestPublishDraft(t *testing.T) {
+	migrated(t)
+
+	ctx := context.Background()
+	f := &repoTransport{}
+	c := repoClient(f)
+
+	s, err := server.NewSessions("https://entryway.test", false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Use("", c)
+
+	commands := server.NewCommands(s, false)
+	m := api.Message{Content: "Know thyself", Langs: []string{"el"}, Labels: []string{"nudity"}}
+	data, _ := json.Marshal(m)
+
+	if _, err := commands.Handle(ctx, "", "DRAFT:ADD "+string(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	f.failures = 1
+
+	if _, err := commands.PublishDraft(ctx, 1); err == nil {
+		t.Fatal("expected the first attempt to fail")
+	}
+
+	d, err := db.InitDraftRepo(false).Get(1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved := api.Message{}
+
+	if err := json.Unmarshal([]byte(d.Message), &saved); err != nil || saved.Rkey == "" {
+		t.Fatalf("expected the record key to be saved with the draft, got %s", d.Message)
+	}
+
+	res, err := commands.PublishDraft(ctx, 1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.CreatePost(ctx, m); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(f.created) != 2 {
+		t.Fatalf("expected the draft and the direct post, got %d records", len(f.created))
+	}
+
+	draft, direct := f.created[0], f.created[1]
+
+	t.Run("the draft posts the same record as a direct post", func(t *testing.T) {
+		if !reflect.DeepEqual(timeless(draft.Record), timeless(direct.Record)) {
+			t.Errorf("draft posted %+v, direct post %+v", draft.Record, direct.Record)
+		}
+
+		if draft.Repo != direct.Repo || draft.Collection != direct.Collection {
+			t.Errorf("draft went to %s/%s", draft.Repo, draft.Collection)
+		}
+	})
+
+	t.Run("the record key survives a failed attempt", func(t *testing.T) {
+		if draft.Rkey != saved.Rkey || res.Rkey != saved.Rkey {
+			t.Errorf("expected key %q to be reused, posted %q", saved.Rkey, draft.Rkey)
+		}
+
+		d, err := db.InitDraftRepo(false).Get(1)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if d.Status != db.DraftPublished || d.URI != res.URI {
+			t.Errorf("expected the draft to be published at %s, got %+v", res.URI, d)
+		}
+	})
+
+	t.Run("history carries the draft id", func(t *testing.T) {
+		posts, err := db.InitHistoryRepo(false).Since(time.Time{})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(posts) != 1 || posts[0].DraftID != 1 || posts[0].URI != res.URI {
+			t.Errorf("expected draft 1 in history, got %+v", posts)
+		}
+	})
+
+	t.Run("published drafts aren't posted twice", func(t *testing.T) {
+		if _, err := commands.PublishDraft(ctx, 1); err == nil {
+			t.Error("expected an error")
+		}
+
+		if len(f.created) != 2 {
+			t.Errorf("expected no new records, got %d", len(f.created))
+		}
+	})
+}
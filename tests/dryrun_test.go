@@ -0,0 +1,302 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/desertthunder/quotesky/cmd/server"
+	"github.com/desertthunder/quotesky/lib/api"
+	"github.com/desertthunder/quotesky/lib/db"
+	"github.com/desertthunder/quotesky/lib/publish"
+)
+
+// Client whose PDS fails the test on any request
+func dryRunClient(t *testing.T, out *bytes.Buffer) *api.Client {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+
+	t.Cleanup(srv.Close)
+
+	c := api.Init(srv.URL, false)
+	c.Credentials.DID = "did:plc:bot"
+	c.Credentials.AccessToken = "token"
+	c.Credentials.ServiceEndpoint = srv.URL
+	c.DryRun = out
+
+	return c
+}
+
+func dryRunRequests(t *testing.T, out *bytes.Buffer) []api.DryRunRequest {
+	reqs := []api.DryRunRequest{}
+
+	for _, l := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		r := api.DryRunRequest{}
+
+		if err := json.Unmarshal([]byte(l), &r); err != nil {
+			t.Fatalf("%s is not json: %s", l, err.Error())
+		}
+
+		reqs = append(reqs, r)
+	}
+
+	return reqs
+}
+
+func TestDryRun(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("single post prints createRecord", func(t *testing.T) {
+		out := bytes.Buffer{}
+		c := dryRunClient(t, &out)
+
+		res, err := c.CreatePost(ctx, api.Message{Content: "hello", Rkey: "3kabc"})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.URI != "at://did:plc:bot/app.bsky.feed.post/3kabc" || res.CID == "" {
+			t.Errorf("expected a local reference, got %+v", res)
+		}
+
+		reqs := dryRunRequests(t, &out)
+
+		if len(reqs) != 1 || reqs[0].NSID != api.CreateRecord {
+			t.Fatalf("unexpected requests %s", out.String())
+		}
+
+		body := api.CreateRecordRequest{}
+		json.Unmarshal(reqs[0].Input, &body)
+
+		if body.Repo != "did:plc:bot" || body.Rkey != "3kabc" {
+			t.Errorf("unexpected body %s", reqs[0].Input)
+		}
+	})
+
+	t.Run("threads print one applyWrites", func(t *testing.T) {
+		out := bytes.Buffer{}
+		c := dryRunClient(t, &out)
+
+		res, err := c.CreatePost(ctx, api.Message{Content: strings.Repeat("word ", 80)})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reqs := dryRunRequests(t, &out)
+
+		if len(reqs) != 1 || !strings.HasSuffix(reqs[0].NSID, "applyWrites") {
+			t.Fatalf("unexpected requests %s", out.String())
+		}
+
+		body := api.ApplyWritesRequest{}
+		json.Unmarshal(reqs[0].Input, &body)
+
+		if len(body.Writes) != 2 || len(res.Thread) != 2 {
+			t.Errorf("expected 2 posts, got %s", reqs[0].Input)
+		}
+	})
+
+	t.Run("blob uploads print their size", func(t *testing.T) {
+		out := bytes.Buffer{}
+		c := dryRunClient(t, &out)
+
+		blob, err := c.UploadBlob(ctx, []byte("GIF89a"), "image/gif")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.HasPrefix(blob.Ref.Link, "bafkrei") || blob.Size != 6 {
+			t.Errorf("expected a local reference, got %+v", blob)
+		}
+
+		reqs := dryRunRequests(t, &out)
+
+		if len(reqs) != 1 || reqs[0].NSID != "com.atproto.repo.uploadBlob" {
+			t.Fatalf("unexpected requests %s", out.String())
+		}
+
+		if string(reqs[0].Input) != `{"mimeType":"image/gif","size":6}` {
+			t.Errorf("unexpected input %s", reqs[0].Input)
+		}
+	})
+}
+
+// Buffer shared by destinations publishing concurrently
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func TestDryRunDestinations(t *testing.T) {
+	migrated(t)
+
+	mastodon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+
+	t.Cleanup(mastodon.Close)
+	t.Setenv("MASTODON_SERVER", mastodon.URL)
+	t.Setenv("MASTODON_TOKEN", "secret")
+
+	out := lockedBuffer{}
+	s, err := server.NewSessions("https://entryway.test", false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Use("", dryRunClient(t, &bytes.Buffer{}))
+	s.SetDryRun(&out)
+
+	path := filepath.Join(t.TempDir(), "posts.jsonl")
+	specs := []string{"bluesky", "mastodon", "jsonl:" + path}
+	dests, err := server.Destinations(specs, server.NewCommands(s, false), &out)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := publish.FanOut(context.Background(), dests, api.Message{Content: "hello"})
+
+	for _, r := range results {
+		if r.Err != nil {
+			t.Errorf("%s failed: %s", r.Destination, r.Err.Error())
+		}
+	}
+
+	if results[0].Account != "did:plc:bot" {
+		t.Errorf("expected bluesky to name the account it posted as, got %q", results[0].Account)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected %s not to be written, got %v", path, err)
+	}
+
+	printed := out.buf.String()
+
+	if n := strings.Count(printed, `"$type": "app.bsky.feed.post"`); n != 2 {
+		t.Errorf("expected mastodon & jsonl to print their records, got %s", printed)
+	}
+
+	if !strings.Contains(printed, "com.atproto.repo.createRecord") {
+		t.Errorf("expected bluesky to print its request, got %s", printed)
+	}
+}
+
+func TestDryRunPollers(t *testing.T) {
+	migrated(t)
+
+	ctx := context.Background()
+	mentions := db.InitMentionRepo(false)
+	seen, last := "2026-10-01T00:00:00Z", "m0"
+
+	if err := mentions.SetSeenAt("did:plc:bot", seen); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mentions.SetLastMessage("did:plc:bot", "convo", last); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/xrpc/app.bsky.notification.listNotifications":
+			fmt.Fprint(w, `{"notifications":[{"uri":"at://did:plc:partner/app.bsky.feed.post/3k",
+				"cid":"bafy","author":{"did":"did:plc:partner","handle":"partner.test"},
+				"reason":"mention","record":{"text":"@bot.test !quote courage"},
+				"indexedAt":"2026-10-02T00:00:00Z"}]}`)
+		case "/xrpc/chat.bsky.convo.listConvos":
+			fmt.Fprint(w, `{"convos":[{"id":"convo","unreadCount":1}]}`)
+		case "/xrpc/chat.bsky.convo.getMessages":
+			fmt.Fprint(w, `{"messages":[{"id":"m1","text":"!quote courage",
+				"sender":{"did":"did:plc:partner"}},{"id":"m0","text":"hi",
+				"sender":{"did":"did:plc:partner"}}]}`)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+
+	t.Cleanup(srv.Close)
+
+	c := api.Init(srv.URL, false)
+	c.Credentials.DID = "did:plc:bot"
+	c.Credentials.AccessToken = "token"
+	c.Credentials.ServiceEndpoint = srv.URL
+	c.Limiter = nil
+
+	s, err := server.NewSessions(srv.URL, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := bytes.Buffer{}
+	s.Use("", c)
+	s.SetDryRun(&out)
+
+	commands := server.NewCommands(s, false)
+	m := server.NewMentionPoller(s, commands, "", time.Minute)
+	dm := server.NewMessagePoller(s, commands, "", time.Minute)
+
+	for i := 0; i < 2; i++ {
+		if err := m.Poll(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := dm.Poll(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("answers are printed once", func(t *testing.T) {
+		nsids := []string{}
+
+		for _, r := range dryRunRequests(t, &out) {
+			nsids = append(nsids, r.NSID)
+		}
+
+		want := []string{
+			api.CreateRecord,
+			"app.bsky.notification.updateSeen",
+			"chat.bsky.convo.sendMessage",
+			"chat.bsky.convo.updateRead",
+		}
+
+		if strings.Join(nsids, " ") != strings.Join(want, " ") {
+			t.Errorf("expected %v, got %v", want, nsids)
+		}
+	})
+
+	t.Run("stored cursors are left alone", func(t *testing.T) {
+		if got, _ := mentions.SeenAt("did:plc:bot"); got != seen {
+			t.Errorf("expected mentions to stay seen at %s, got %s", seen, got)
+		}
+
+		if got, _ := mentions.LastMessage("did:plc:bot", "convo"); got != last {
+			t.Errorf("expected the last message to stay %s, got %s", last, got)
+		}
+	})
+}
@@ -0,0 +1,236 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/desertthunder/quotesky/cmd/server"
+	"github.com/desertthunder/quotesky/lib/api"
+)
+
+// Entry in a served author feed
+type feedEntry struct {
+	rkey    string
+	created string
+	reply   bool
+	repost  bool
+}
+
+// App view serving the bot's author feed in pages, newest first
+//
+// Each request's query is kept in queries.
+type feedServer struct {
+	pages   [][]feedEntry
+	queries []url.Values
+}
+
+func (f *feedServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/xrpc/app.bsky.feed.getAuthorFeed" {
+		http.NotFound(w, r)
+		return
+	}
+
+	q := r.URL.Query()
+	f.queries = append(f.queries, q)
+
+	i := 0
+	fmt.Sscan(q.Get("cursor"), &i)
+
+	page := api.AuthorFeed{Feed: []api.FeedViewPost{}}
+
+	for n, e := range f.pages[i] {
+		if e.reply && q.Get("filter") == api.FilterPostsNoReplies {
+			continue
+		}
+
+		record, _ := json.Marshal(api.PostRecord{
+			Type: api.PostType, Text: "post " + e.rkey, CreatedAt: e.created,
+		})
+
+		item := api.FeedViewPost{Post: api.PostView{
+			URI:         "at://did:plc:bot/app.bsky.feed.post/" + e.rkey,
+			CID:         "bafy" + e.rkey,
+			Author:      api.ProfileViewBasic{DID: "did:plc:bot", Handle: "bot.test"},
+			Record:      record,
+			LikeCount:   n + 1,
+			RepostCount: n,
+			ReplyCount:  i,
+		}}
+
+		if e.reply {
+			item.Reply = json.RawMessage(`{"parent":{}}`)
+		}
+
+		if e.repost {
+			item.Reason = &api.FeedReason{Type: "app.bsky.feed.defs#reasonRepost"}
+		}
+
+		page.Feed = append(page.Feed, item)
+	}
+
+	if i+1 < len(f.pages) {
+		page.Cursor = fmt.Sprint(i + 1)
+	}
+
+	json.NewEncoder(w).Encode(page)
+}
+
+func feedClient(t *testing.T) (*api.Client, *feedServer) {
+	f := &feedServer{pages: [][]feedEntry{
+		{
+			{rkey: "p1", created: "2026-10-05T09:00:00Z"},
+			{rkey: "r1", created: "2026-09-01T09:00:00Z", repost: true},
+			{rkey: "p2", created: "2026-10-04T12:00:00Z", reply: true},
+		},
+		{
+			{rkey: "p3", created: "2026-10-02T09:00:00Z"},
+			{rkey: "p4", created: "2026-09-20T09:00:00Z"},
+		},
+		{
+			{rkey: "p5", created: "2026-09-10T09:00:00Z"},
+		},
+	}}
+
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	c := api.Init(srv.URL, false)
+	c.Credentials.DID = "did:plc:bot"
+	c.Credentials.AccessToken = "token"
+	c.Credentials.ServiceEndpoint = srv.URL
+	c.Limiter = nil
+
+	return c, f
+}
+
+// Record keys of items, in order
+func feedKeys(items []server.FeedItem) string {
+	keys := []string{}
+
+	for _, i := range items {
+		keys = append(keys, i.URI[strings.LastIndex(i.URI, "/")+1:])
+	}
+
+	return strings.Join(keys, " ")
+}
+
+func TestFeed(t *testing.T) {
+	ctx := context.Background()
+	day := func(s string) time.Time {
+		d, _ := time.Parse(time.DateOnly, s)
+		return d
+	}
+
+	cases := []struct {
+		name    string
+		query   server.FeedQuery
+		pages   [][]feedEntry
+		want    string
+		cursors string
+	}{
+		{name: "every page", query: server.FeedQuery{Limit: 25},
+			want: "p1 r1 p2 p3 p4 p5", cursors: ",1,2"},
+		{name: "stops at the limit", query: server.FeedQuery{Limit: 2},
+			want: "p1 r1", cursors: ""},
+		{name: "without replies or reposts",
+			query: server.FeedQuery{Limit: 25, NoReplies: true, NoReposts: true},
+			want:  "p1 p3 p4 p5", cursors: ",1,2"},
+		{name: "stops paging before since",
+			query: server.FeedQuery{Limit: 25, Since: day("2026-10-01")},
+			want:  "p1 p2 p3", cursors: ",1"},
+		{name: "skips unreadable timestamps",
+			query: server.FeedQuery{Limit: 25, Since: day("2026-10-01")},
+			pages: [][]feedEntry{
+				{{rkey: "p1", created: "2026-10-05T09:00:00Z"}, {rkey: "bad", created: "soon"}},
+				{{rkey: "p3", created: "2026-10-02T09:00:00Z"}},
+			},
+			want: "p1 p3", cursors: ",1"},
+		{name: "until excludes later posts",
+			query: server.FeedQuery{Limit: 25, Until: day("2026-10-04")},
+			want:  "r1 p3 p4 p5", cursors: ",1,2"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, f := feedClient(t)
+
+			if tc.pages != nil {
+				f.pages = tc.pages
+			}
+
+			items, err := server.CollectFeed(ctx, c, tc.query)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := feedKeys(items); got != tc.want {
+				t.Errorf("expected %s, got %s", tc.want, got)
+			}
+
+			cursors := []string{}
+
+			for _, q := range f.queries {
+				cursors = append(cursors, q.Get("cursor"))
+			}
+
+			if got := strings.Join(cursors, ","); got != tc.cursors {
+				t.Errorf("expected cursors %q, got %q", tc.cursors, got)
+			}
+		})
+	}
+
+	t.Run("queries the account's own feed", func(t *testing.T) {
+		c, f := feedClient(t)
+
+		if _, err := server.CollectFeed(ctx, c, server.FeedQuery{Limit: 1}); err != nil {
+			t.Fatal(err)
+		}
+
+		q := f.queries[0]
+
+		if q.Get("actor") != "did:plc:bot" || q.Get("filter") != api.FilterPostsWithReplies ||
+			q.Get("limit") != "50" {
+			t.Errorf("unexpected query %v", q)
+		}
+
+		other := server.FeedQuery{Actor: "partner.test", Limit: 1, NoReplies: true}
+
+		if _, err := server.CollectFeed(ctx, c, other); err != nil {
+			t.Fatal(err)
+		}
+
+		if q := f.queries[1]; q.Get("actor") != "partner.test" ||
+			q.Get("filter") != api.FilterPostsNoReplies {
+			t.Errorf("unexpected query %v", q)
+		}
+	})
+
+	t.Run("rows carry counts, kinds and timestamps", func(t *testing.T) {
+		c, _ := feedClient(t)
+		items, err := server.CollectFeed(ctx, c, server.FeedQuery{Limit: 4})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p3, r1, p2 := items[3], items[1], items[2]
+		created, _ := time.Parse(time.RFC3339, "2026-10-02T09:00:00Z")
+
+		if p3.Likes != 1 || p3.Reposts != 0 || p3.Replies != 1 || p3.Text != "post p3" ||
+			!p3.CreatedAt.Equal(created) || p3.CID != "bafyp3" || p3.Author != "bot.test" {
+			t.Errorf("unexpected row %+v", p3)
+		}
+
+		if !r1.Repost || r1.Reply || !p2.Reply || p2.Repost || p3.Reply || p3.Repost {
+			t.Errorf("unexpected kinds %+v %+v %+v", r1, p2, p3)
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/desertthunder/quotesky/lib/api"
+)
+
+// Writes sent in the single applyWrites request f received
+func sentWrites(t *testing.T, f *fakeTransport) []api.WriteOp {
+	t.Helper()
+
+	if len(f.requests) != 1 || f.requests[0].URL.Path != "/xrpc/com.atproto.repo.applyWrites" {
+		t.Fatalf("expected one applyWrites request, got %d", len(f.requests))
+	}
+
+	body, err := f.requests[0].GetBody()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := io.ReadAll(body)
+	req := api.ApplyWritesRequest{}
+
+	if err := json.Unmarshal(data, &req); err != nil {
+		t.Fatal(err)
+	}
+
+	return req.Writes
+}
+
+func TestGates(t *testing.T) {
+	list := "at://did:plc:bot/app.bsky.graph.list/3kfriends"
+
+	t.Run("gates land with the post", func(t *testing.T) {
+		c, f := fakeClient(`{"commit":{"cid":"bafyc","rev":"r"},"results":[]}`)
+		g := api.Gates{Replies: []string{api.ReplyFollowers, list}, NoQuotes: true}
+
+		res, err := c.CreatePost(context.Background(), api.Message{Content: "hi", Gates: &g})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		writes := sentWrites(t, f)
+
+		if len(writes) != 3 {
+			t.Fatalf("expected post, threadgate & postgate, got %d writes", len(writes))
+		}
+
+		for i, want := range []string{api.PostType, api.ThreadgateType, api.PostgateType} {
+			if writes[i].Collection != want || writes[i].Rkey != res.Rkey {
+				t.Errorf("write %d is %s/%s, want %s/%s",
+					i, writes[i].Collection, writes[i].Rkey, want, res.Rkey)
+			}
+		}
+
+		gate, _ := json.Marshal(writes[1].Value)
+
+		for _, want := range []string{
+			`"post":"` + res.URI + `"`,
+			`"allow":[{"$type":"app.bsky.feed.threadgate#followerRule"},` +
+				`{"$type":"app.bsky.feed.threadgate#listRule","list":"` + list + `"}]`,
+		} {
+			if !strings.Contains(string(gate), want) {
+				t.Errorf("expected %s in threadgate %s", want, gate)
+			}
+		}
+	})
+
+	t.Run("account defaults apply, replies skip the threadgate", func(t *testing.T) {
+		c, f := fakeClient(`{"commit":{"cid":"bafyc","rev":"r"},"results":[]}`)
+		c.Gates = api.Gates{Replies: []string{api.ReplyNobody}, NoQuotes: true}
+		parent := api.StrongRef{URI: "at://did:plc:fan/app.bsky.feed.post/1", CID: "bafyp"}
+
+		m := api.Message{Content: "hi", Reply: &api.ReplyRef{Root: parent, Parent: parent}}
+
+		if _, err := c.CreatePost(context.Background(), m); err != nil {
+			t.Fatal(err)
+		}
+
+		writes := sentWrites(t, f)
+
+		if len(writes) != 2 || writes[1].Collection != api.PostgateType {
+			t.Errorf("expected a post and postgate, got %+v", writes)
+		}
+	})
+
+	t.Run("everyone leaves the post ungated", func(t *testing.T) {
+		c, f := fakeClient(`{"uri":"at://did:plc:bot/app.bsky.feed.post/3k","cid":"bafy"}`)
+		c.Gates = api.Gates{Replies: []string{api.ReplyNobody}}
+		g := api.Gates{Replies: []string{api.ReplyEveryone}}
+
+		_, err := c.CreatePost(context.Background(), api.Message{Content: "hi", Gates: &g})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if f.requests[0].URL.Path != "/xrpc/com.atproto.repo.createRecord" {
+			t.Errorf("expected a plain createRecord, got %s", f.requests[0].URL.Path)
+		}
+	})
+
+	t.Run("invalid rules", func(t *testing.T) {
+		for _, rules := range [][]string{
+			{"friends"},
+			{api.ReplyNobody, api.ReplyFollowers},
+			{"at://did:plc:bot/app.bsky.feed.post/3k"},
+		} {
+			if err := (api.Gates{Replies: rules}).Validate(); err == nil {
+				t.Errorf("expected %v to be rejected", rules)
+			}
+		}
+	})
+}
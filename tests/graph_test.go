@@ -0,0 +1,181 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/desertthunder/quotesky/cmd/server"
+	"github.com/desertthunder/quotesky/lib/api"
+)
+
+const likedPost string = "at://did:plc:partner/app.bsky.feed.post/3jzfcijpj2z2a"
+
+// PDS serving one post, liked with like when set
+func graphServer(t *testing.T, like string, writes *[]string) *api.Client {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/xrpc/com.atproto.identity.resolveHandle":
+			fmt.Fprint(w, `{"did":"did:plc:partner"}`)
+		case "/xrpc/app.bsky.feed.getPosts":
+			if r.URL.Query().Get("uris") != likedPost {
+				t.Errorf("unexpected uris %s", r.URL.RawQuery)
+			}
+
+			fmt.Fprintf(w, `{"posts":[{"uri":%q,"cid":"bafypost","viewer":{"like":%q}}]}`,
+				likedPost, like)
+		case "/xrpc/com.atproto.repo.createRecord", "/xrpc/com.atproto.repo.deleteRecord":
+			body := map[string]any{}
+			json.NewDecoder(r.Body).Decode(&body)
+			data, _ := json.Marshal(body)
+			*writes = append(*writes, r.URL.Path+" "+string(data))
+
+			fmt.Fprint(w, `{"uri":"at://did:plc:bot/app.bsky.feed.like/3k","cid":"bafylike"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	t.Cleanup(srv.Close)
+
+	c := api.Init(srv.URL, false)
+	c.Credentials.DID = "did:plc:bot"
+	c.Credentials.AccessToken = "token"
+	c.Credentials.ServiceEndpoint = srv.URL
+
+	return c
+}
+
+func TestEngagements(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("like references the post by uri and cid", func(t *testing.T) {
+		writes := []string{}
+		c := graphServer(t, "", &writes)
+
+		uri, err := c.Like(ctx, "https://bsky.app/profile/partner.test/post/3jzfcijpj2z2a")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if uri != "at://did:plc:bot/app.bsky.feed.like/3k" {
+			t.Errorf("unexpected like %s", uri)
+		}
+
+		if len(writes) != 1 {
+			t.Fatalf("expected 1 write, got %v", writes)
+		}
+
+		want := fmt.Sprintf(`"subject":{"cid":"bafypost","uri":%q}`, likedPost)
+
+		if !strings.Contains(writes[0], want) ||
+			!strings.Contains(writes[0], `"$type":"app.bsky.feed.like"`) {
+			t.Errorf("unexpected record %s", writes[0])
+		}
+	})
+
+	t.Run("liking twice keeps the existing like", func(t *testing.T) {
+		writes := []string{}
+		c := graphServer(t, "at://did:plc:bot/app.bsky.feed.like/3old", &writes)
+
+		uri, err := c.Like(ctx, likedPost)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if uri != "at://did:plc:bot/app.bsky.feed.like/3old" || len(writes) != 0 {
+			t.Errorf("expected the existing like, got %s and %v", uri, writes)
+		}
+	})
+
+	t.Run("unlike deletes the viewer's like", func(t *testing.T) {
+		writes := []string{}
+		c := graphServer(t, "at://did:plc:bot/app.bsky.feed.like/3old", &writes)
+
+		if _, err := c.Unlike(ctx, likedPost); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(writes) != 1 || !strings.Contains(writes[0], `"rkey":"3old"`) {
+			t.Errorf("unexpected writes %v", writes)
+		}
+	})
+
+	t.Run("unlike without a like", func(t *testing.T) {
+		writes := []string{}
+		c := graphServer(t, "", &writes)
+
+		if _, err := c.Unlike(ctx, likedPost); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("post links", func(t *testing.T) {
+		for _, s := range []string{
+			"https://bsky.app/profile/partner.test",
+			"at://did:plc:partner/app.bsky.graph.follow/3k",
+		} {
+			if _, err := api.ParsePostURI(s); err == nil {
+				t.Errorf("expected %s to be rejected", s)
+			}
+		}
+	})
+}
+
+func TestEngagementCommands(t *testing.T) {
+	migrated(t)
+
+	ctx := context.Background()
+	bot, brand := []string{}, []string{}
+
+	s, err := server.NewSessions("https://entryway.test", false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Use("", graphServer(t, "", &bot))
+	s.Use("brand.test", graphServer(t, "", &brand))
+
+	c := server.NewCommands(s, false)
+
+	steps := []struct {
+		account string
+		line    string
+		bot     int
+		brand   int
+		err     string
+	}{
+		{line: "LIKE: " + likedPost, bot: 1},
+		{line: "LIKE: " + likedPost + " | brand.test", bot: 1, brand: 1},
+		{account: "brand.test", line: "REPOST: " + likedPost, bot: 1, brand: 2},
+		{account: "brand.test", line: "LIKE: " + likedPost + " | ", bot: 1, brand: 3},
+		{line: "LIKE:", bot: 1, brand: 3, err: "LIKE: needs a target"},
+		{line: "like " + likedPost, bot: 1, brand: 3, err: "unknown command like"},
+		{line: "Like: " + likedPost, bot: 1, brand: 3, err: "unknown command Like:"},
+		{line: "LIKE " + likedPost, bot: 1, brand: 3, err: "unknown command LIKE"},
+	}
+
+	for _, step := range steps {
+		_, err := c.Handle(ctx, step.account, step.line)
+
+		if step.err == "" && err != nil {
+			t.Errorf("%s: %s", step.line, err.Error())
+		}
+
+		if step.err != "" && (err == nil || err.Error() != step.err) {
+			t.Errorf("%s: expected error %q, got %v", step.line, step.err, err)
+		}
+
+		if len(bot) != step.bot || len(brand) != step.brand {
+			t.Errorf("%s: expected %d and %d writes, got %d and %d",
+				step.line, step.bot, step.brand, len(bot), len(brand))
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/desertthunder/quotesky/lib/api"
+)
+
+func TestSelfLabels(t *testing.T) {
+	labels := []string{"graphic-media", "graphic-media"}
+	p := api.BuildPost(api.Message{Content: "war", Labels: labels})
+
+	if p.Labels == nil || len(p.Labels.Values) != 1 || p.Labels.Values[0].Val != "graphic-media" {
+		t.Errorf("unexpected labels %+v", p.Labels)
+	}
+
+	if p.Labels.Type != "com.atproto.label.defs#selfLabels" {
+		t.Errorf("unexpected type %s", p.Labels.Type)
+	}
+
+	if api.BuildPost(api.Message{Content: "calm"}).Labels != nil {
+		t.Error("expected no labels")
+	}
+
+	if err := api.ValidateLabels([]string{"gore"}); err == nil {
+		t.Error("expected an unknown label to fail")
+	}
+}
@@ -0,0 +1,52 @@
+package tests
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/desertthunder/quotesky/lib/api"
+)
+
+func TestDetectLangs(t *testing.T) {
+	cases := []struct {
+		text string
+		want []string
+	}{
+		{"The only thing we have to fear is fear itself. — Roosevelt", []string{"en"}},
+		{"El que lee mucho y anda mucho, ve mucho y sabe mucho. — Cervantes", []string{"es"}},
+		{"Je pense, donc je suis — Descartes", []string{"fr"}},
+		{"Was mich nicht umbringt, macht mich stärker. — Nietzsche", []string{"de"}},
+		{"Рукописи не горят. — Булгаков", []string{"ru"}},
+		{"千里之行，始于足下 — 老子", []string{"zh"}},
+		{"猿も木から落ちる", []string{"ja"}},
+		{
+			"L'enfer, c'est les autres. Hell is other people, and that is the point.",
+			[]string{"en", "fr"},
+		},
+		{"Carpe diem", nil},
+	}
+
+	for _, c := range cases {
+		if got := api.DetectLangs(c.text); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("DetectLangs(%q) = %v, want %v", c.text, got, c.want)
+		}
+	}
+
+	t.Run("explicit langs win over detection", func(t *testing.T) {
+		p := api.BuildPost(api.Message{Content: "the cat", Langs: []string{"pt-BR"}})
+
+		if !reflect.DeepEqual(p.Langs, []string{"pt-BR"}) {
+			t.Errorf("unexpected langs %v", p.Langs)
+		}
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		if err := api.ValidateLangs([]string{"en", "es", "fr", "de"}); err == nil {
+			t.Error("expected too many langs to fail")
+		}
+
+		if err := api.ValidateLangs([]string{"english"}); err == nil {
+			t.Error("expected a bad tag to fail")
+		}
+	})
+}
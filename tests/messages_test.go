@@ -0,0 +1,214 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/desertthunder/quotesky/cmd/server"
+	"github.com/desertthunder/quotesky/lib/api"
+	"github.com/desertthunder/quotesky/lib/db"
+)
+
+// Chat service holding one conversation between the bot and did:plc:partner
+//
+// Messages are served newest first, two to a page. Once failAfter messages
+// have been sent, if set, sending fails.
+type chatServer struct {
+	messages  []api.MessageView
+	unread    int
+	sent      []string
+	read      string
+	failAfter int
+}
+
+func (f *chatServer) receive(id string, sender string, text string) {
+	msg := api.MessageView{ID: id, Text: text, Sender: api.MessageSender{DID: sender}}
+	f.messages = append([]api.MessageView{msg}, f.messages...)
+	f.unread++
+}
+
+func (f *chatServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/xrpc/chat.bsky.convo.listConvos":
+		fmt.Fprintf(w, `{"convos":[{"id":"convo","unreadCount":%d}]}`, f.unread)
+	case "/xrpc/chat.bsky.convo.getMessages":
+		start, _ := strconv.Atoi(r.URL.Query().Get("cursor"))
+		end := min(start+2, len(f.messages))
+		page := api.Messages{Messages: f.messages[start:end]}
+
+		if end < len(f.messages) {
+			page.Cursor = strconv.Itoa(end)
+		}
+
+		json.NewEncoder(w).Encode(page)
+	case "/xrpc/chat.bsky.convo.sendMessage":
+		if f.failAfter > 0 && len(f.sent) >= f.failAfter {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"InvalidRequest","message":"try again later"}`)
+			return
+		}
+
+		body := struct {
+			Message struct{ Text string } `json:"message"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.sent = append(f.sent, body.Message.Text)
+
+		fmt.Fprint(w, `{"id":"reply"}`)
+	case "/xrpc/chat.bsky.convo.updateRead":
+		body := map[string]string{}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.read = body["messageId"]
+		f.unread = 0
+
+		fmt.Fprint(w, `{}`)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Polls the chat server once and returns the messages sent since the last poll
+func (f *chatServer) poll(t *testing.T, m *server.MessagePoller) []string {
+	t.Helper()
+
+	before := len(f.sent)
+
+	if err := m.Poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return f.sent[before:]
+}
+
+func TestMessagePoller(t *testing.T) {
+	migrated(t)
+
+	f := &chatServer{}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	c := api.Init(srv.URL, false)
+	c.Credentials.DID = "did:plc:bot"
+	c.Credentials.AccessToken = "token"
+	c.Credentials.ServiceEndpoint = srv.URL
+	c.MaxRetries = 0
+	c.Limiter = nil
+
+	s, err := server.NewSessions(srv.URL, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Use("", c)
+
+	commands := server.NewCommands(s, false)
+
+	_, err = commands.Handle(context.Background(), "", "QUOTE:ADD Courage is grace | Hemingway")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := server.NewMessagePoller(s, commands, "", time.Minute)
+	m.SetRateLimit(100, time.Hour)
+	notAvailable := "QUOTE:ADD isn't available in direct messages. "
+	dmHelp := "Send QUOTE:GET <topic>, QUOTE:LIST or \"!quote <topic>\" for a quote."
+
+	t.Run("first poll answers only unread messages across pages", func(t *testing.T) {
+		f.receive("m1", "did:plc:partner", "an old message")
+		f.unread = 0
+		f.receive("m2", "did:plc:partner", "QUOTE:ADD spam | spammer")
+		f.receive("m3", "did:plc:partner", "hello")
+		f.receive("m4", "did:plc:partner", "")
+		f.messages[0].Type = "chat.bsky.convo.defs#deletedMessageView"
+		f.receive("m5", "did:plc:bot", "QUOTE:GET")
+		f.receive("m6", "did:plc:partner", "!quote courage")
+
+		want := []string{notAvailable + dmHelp, dmHelp, "Courage is grace — Hemingway"}
+		got := f.poll(t, m)
+
+		if strings.Join(got, "|") != strings.Join(want, "|") {
+			t.Errorf("expected %q, got %q", want, got)
+		}
+
+		if f.read != "m6" {
+			t.Errorf("expected the convo to be read up to m6, got %q", f.read)
+		}
+	})
+
+	t.Run("later polls stop at the last answer", func(t *testing.T) {
+		f.receive("m7", "did:plc:partner", "QUOTE:LIST")
+
+		if got := f.poll(t, m); len(got) != 1 || got[0] != "1: Courage is grace — Hemingway" {
+			t.Errorf("expected only m7 to be answered, got %q", got)
+		}
+
+		if got := f.poll(t, m); len(got) != 0 {
+			t.Errorf("expected nothing new to answer, got %q", got)
+		}
+	})
+
+	t.Run("only exact verbs are commands", func(t *testing.T) {
+		f.receive("m7a", "did:plc:partner", "like this bot a lot")
+		f.receive("m7b", "did:plc:partner", "LIKE: at://did:plc:bot/app.bsky.feed.post/3k")
+
+		want := []string{dmHelp, "LIKE: isn't available in direct messages. " + dmHelp}
+		got := f.poll(t, m)
+
+		if strings.Join(got, "|") != strings.Join(want, "|") {
+			t.Errorf("expected %q, got %q", want, got)
+		}
+	})
+
+	t.Run("blocked senders are not answered", func(t *testing.T) {
+		if err := db.InitMentionRepo(false).Block("did:plc:partner"); err != nil {
+			t.Fatal(err)
+		}
+
+		t.Cleanup(func() { db.InitMentionRepo(false).Unblock("did:plc:partner") })
+
+		f.receive("m8", "did:plc:partner", "!quote courage")
+
+		if got := f.poll(t, m); len(got) != 0 {
+			t.Errorf("expected no answer, got %q", got)
+		}
+
+		if f.read != "m8" {
+			t.Errorf("expected m8 to be marked read, got %q", f.read)
+		}
+	})
+
+	t.Run("a failed send keeps earlier answers", func(t *testing.T) {
+		f.receive("m9", "did:plc:partner", "QUOTE:GET courage")
+
+		if got := f.poll(t, m); len(got) != 1 {
+			t.Fatalf("expected m9 to be answered, got %q", got)
+		}
+
+		f.receive("m10", "did:plc:partner", "QUOTE:GET")
+		f.receive("m11", "did:plc:partner", "QUOTE:GET")
+		f.failAfter = len(f.sent) + 1
+
+		if got := f.poll(t, m); len(got) != 1 {
+			t.Fatalf("expected m10 to be answered before the failure, got %q", got)
+		}
+
+		f.failAfter = 0
+
+		if got := f.poll(t, m); len(got) != 1 {
+			t.Errorf("expected only m11 to be answered again, got %q", got)
+		}
+
+		if f.read != "m11" {
+			t.Errorf("expected m11 to be marked read, got %q", f.read)
+		}
+	})
+}
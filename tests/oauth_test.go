@@ -0,0 +1,326 @@
+package tests
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/desertthunder/quotesky/lib/api"
+)
+
+// Claims of a DPoP proof, after checking its signature against its own key
+func verifyProof(t *testing.T, proof string) (map[string]any, string) {
+	parts := strings.Split(proof, ".")
+
+	if len(parts) != 3 {
+		t.Fatalf("malformed proof %s", proof)
+	}
+
+	header := struct {
+		Typ string            `json:"typ"`
+		Alg string            `json:"alg"`
+		JWK map[string]string `json:"jwk"`
+	}{}
+	claims := map[string]any{}
+
+	for i, out := range []any{&header, &claims} {
+		data, _ := base64.RawURLEncoding.DecodeString(parts[i])
+
+		if err := json.Unmarshal(data, out); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if header.Typ != "dpop+jwt" || header.Alg != "ES256" {
+		t.Errorf("unexpected header %+v", header)
+	}
+
+	x, _ := base64.RawURLEncoding.DecodeString(header.JWK["x"])
+	y, _ := base64.RawURLEncoding.DecodeString(header.JWK["y"])
+	sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	key := ecdsa.PublicKey{
+		Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y),
+	}
+	sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	rs, ss := new(big.Int), new(big.Int)
+
+	if len(sig) == 64 {
+		rs.SetBytes(sig[:32])
+		ss.SetBytes(sig[32:])
+	}
+
+	if !ecdsa.Verify(&key, sum[:], rs, ss) {
+		t.Errorf("proof signature doesn't verify")
+	}
+
+	return claims, header.JWK["x"]
+}
+
+// Authorization server, PDS and PLC directory in one
+type authServer struct {
+	t         *testing.T
+	url       string
+	mu        sync.Mutex
+	challenge string
+	key       string
+	expired   bool
+	refreshes int
+	sessions  int
+}
+
+// Demands the nonce in the proof, reporting whether the request may proceed
+func (s *authServer) checkProof(w http.ResponseWriter, r *http.Request, nonce string) bool {
+	claims, key := verifyProof(s.t, r.Header.Get("DPoP"))
+
+	if claims["htm"] != r.Method || claims["htu"] != s.url+r.URL.Path {
+		s.t.Errorf("proof is for %v %v", claims["htm"], claims["htu"])
+	}
+
+	if s.key != "" && key != s.key {
+		s.t.Errorf("proof signed with a different key")
+	}
+
+	s.key = key
+
+	if claims["nonce"] == nonce {
+		return true
+	}
+
+	w.Header().Set("DPoP-Nonce", nonce)
+
+	if strings.HasPrefix(r.URL.Path, "/xrpc/") {
+		w.Header().Set("WWW-Authenticate", `DPoP error="use_dpop_nonce"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error":"use_dpop_nonce"}`)
+
+		return false
+	}
+
+	w.WriteHeader(http.StatusBadRequest)
+	fmt.Fprint(w, `{"error":"use_dpop_nonce"}`)
+
+	return false
+}
+
+func (s *authServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r.ParseForm()
+
+	switch r.URL.Path {
+	case "/.well-known/oauth-protected-resource":
+		fmt.Fprintf(w, `{"resource":%q,"authorization_servers":[%q]}`, s.url, s.url)
+	case "/.well-known/oauth-authorization-server":
+		fmt.Fprintf(w, `{"issuer":%[1]q,"authorization_endpoint":"%[1]s/oauth/authorize",
+			"token_endpoint":"%[1]s/oauth/token",
+			"pushed_authorization_request_endpoint":"%[1]s/oauth/par",
+			"dpop_signing_alg_values_supported":["ES256"]}`, s.url)
+	case "/did:plc:bot":
+		fmt.Fprintf(w, `{"id":"did:plc:bot","alsoKnownAs":["at://bot.test"],
+			"service":[{"id":"#atproto_pds","type":"AtprotoPersonalDataServer",
+			"serviceEndpoint":%q}]}`, s.url)
+	case "/xrpc/com.atproto.identity.resolveHandle":
+		fmt.Fprint(w, `{"did":"did:plc:bot"}`)
+	case "/oauth/par":
+		if !s.checkProof(w, r, "as-nonce") {
+			return
+		}
+
+		if r.Form.Get("code_challenge_method") != "S256" ||
+			r.Form.Get("login_hint") != "bot.test" ||
+			!strings.HasPrefix(r.Form.Get("client_id"), "http://localhost?") {
+			s.t.Errorf("unexpected authorization request %v", r.Form)
+		}
+
+		s.challenge = r.Form.Get("code_challenge")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"request_uri":"urn:ietf:params:oauth:request_uri:req-1","expires_in":60}`)
+	case "/oauth/token":
+		if !s.checkProof(w, r, "as-nonce") {
+			return
+		}
+
+		access, refresh := "access-1", "refresh-1"
+
+		switch r.Form.Get("grant_type") {
+		case "authorization_code":
+			if api.PKCEChallenge(r.Form.Get("code_verifier")) != s.challenge ||
+				r.Form.Get("code") != "code-1" {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error":"invalid_grant"}`)
+
+				return
+			}
+		case "refresh_token":
+			if r.Form.Get("refresh_token") != "refresh-1" {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error":"invalid_grant"}`)
+
+				return
+			}
+
+			s.refreshes++
+			s.expired = false
+			access, refresh = "access-2", "refresh-2"
+		}
+
+		fmt.Fprintf(w, `{"access_token":%q,"token_type":"DPoP","refresh_token":%q,
+			"scope":"atproto transition:generic","expires_in":60,"sub":"did:plc:bot"}`,
+			access, refresh)
+	case "/xrpc/com.atproto.server.getSession":
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "DPoP ")
+
+		if !ok {
+			s.t.Errorf("expected a DPoP token, got %s", r.Header.Get("Authorization"))
+		}
+
+		if !s.checkProof(w, r, "pds-nonce") {
+			return
+		}
+
+		claims, _ := verifyProof(s.t, r.Header.Get("DPoP"))
+		ath := sha256.Sum256([]byte(token))
+
+		if claims["ath"] != base64.RawURLEncoding.EncodeToString(ath[:]) {
+			s.t.Errorf("proof isn't bound to the access token")
+		}
+
+		if s.expired || token == "access-1" && s.refreshes > 0 {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":"invalid_token","message":"token expired"}`)
+
+			return
+		}
+
+		s.sessions++
+		fmt.Fprint(w, `{"handle":"bot.test","did":"did:plc:bot","active":true}`)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestOAuth(t *testing.T) {
+	ctx := context.Background()
+	s := &authServer{t: t}
+	srv := httptest.NewServer(s)
+	s.url = srv.URL
+
+	t.Cleanup(srv.Close)
+
+	c := api.Init(srv.URL, false)
+	c.Resolver = api.NewResolver(srv.URL, srv.Client())
+
+	l, err := api.ListenLoopback(0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := c.StartOAuth(ctx, "bot.test", l.RedirectURI())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, _ := url.Parse(r.URL)
+
+	if u.Path != "/oauth/authorize" || u.Query().Get("request_uri") == "" {
+		t.Fatalf("unexpected authorization page %s", r.URL)
+	}
+
+	// The browser lands on the loopback listener once the user approves
+	go func() {
+		q := url.Values{"code": {"code-1"}, "state": {r.State}, "iss": {srv.URL}}
+		res, err := http.Get(r.RedirectURI + "?" + q.Encode())
+
+		if err == nil {
+			res.Body.Close()
+		}
+	}()
+
+	q, err := l.Wait(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tok, err := c.FinishOAuth(ctx, r, q)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tok.Sub != "did:plc:bot" || r.PDS != srv.URL {
+		t.Fatalf("unexpected grant %+v for %s", tok, r.PDS)
+	}
+
+	c.OAuth = r.Session()
+	c.SetOAuthTokens(*tok, r.PDS)
+
+	t.Run("requests are signed with DPoP", func(t *testing.T) {
+		sess, err := c.GetSession(ctx)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if sess.Handle != "bot.test" || s.sessions != 1 {
+			t.Errorf("unexpected session %+v", sess)
+		}
+	})
+
+	t.Run("expired tokens are refreshed", func(t *testing.T) {
+		stored := []string{}
+		c.OAuth.OnRefresh = func(t api.TokenResponse) error {
+			stored = append(stored, t.AccessToken)
+			return nil
+		}
+
+		s.mu.Lock()
+		s.expired = true
+		s.mu.Unlock()
+
+		if _, err := c.GetSession(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if s.refreshes != 1 || c.Credentials.AccessToken != "access-2" ||
+			len(stored) != 1 || stored[0] != "access-2" {
+			t.Errorf("expected one stored refresh, got %d %v", s.refreshes, stored)
+		}
+	})
+
+	t.Run("mismatched state is rejected", func(t *testing.T) {
+		q := url.Values{"code": {"code-1"}, "state": {"forged"}, "iss": {srv.URL}}
+
+		if _, err := c.FinishOAuth(ctx, r, q); err == nil {
+			t.Error("expected a state error")
+		}
+	})
+
+	t.Run("dpop keys round trip", func(t *testing.T) {
+		enc, err := r.DPoP.Encode()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d, err := api.ParseDPoP(enc)
+
+		if err != nil || d.JWK()["x"] != r.DPoP.JWK()["x"] {
+			t.Errorf("expected the same key, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/desertthunder/quotesky/lib/api"
+)
+
+func TestProfile(t *testing.T) {
+	t.Run("unmanaged fields survive a round trip", func(t *testing.T) {
+		in := `{"$type":"app.bsky.actor.profile","displayName":"Bot",` +
+			`"labels":{"$type":"com.atproto.label.defs#selfLabels","values":[]}}`
+		p := api.Profile{}
+
+		if err := json.Unmarshal([]byte(in), &p); err != nil {
+			t.Fatal(err)
+		}
+
+		p.Description = "quotes"
+		out, err := json.Marshal(p)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, want := range []string{
+			`"$type":"app.bsky.actor.profile"`, `"description":"quotes"`, `"labels":{`,
+		} {
+			if !strings.Contains(string(out), want) {
+				t.Errorf("expected %s in %s", want, out)
+			}
+		}
+	})
+
+	t.Run("update retries when the swap fails", func(t *testing.T) {
+		reads, swaps := 0, []string{}
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/xrpc/com.atproto.repo.getRecord":
+				reads++
+				fmt.Fprintf(w, `{"uri":"at://did:plc:bot/app.bsky.actor.profile/self",`+
+					`"cid":"bafy%d","value":{"displayName":"v%d"}}`, reads, reads)
+			case "/xrpc/com.atproto.repo.putRecord":
+				body := api.PutRecordRequest{}
+				json.NewDecoder(r.Body).Decode(&body)
+				swaps = append(swaps, *body.SwapRecord)
+
+				if len(swaps) == 1 {
+					w.WriteHeader(http.StatusBadRequest)
+					fmt.Fprint(w, `{"error":"InvalidSwap","message":"Record was at bafy2"}`)
+					return
+				}
+
+				fmt.Fprint(w, `{"uri":"at://did:plc:bot/app.bsky.actor.profile/self","cid":"c"}`)
+			}
+		}))
+		defer srv.Close()
+
+		c := api.Init(srv.URL, false)
+		c.Credentials.DID = "did:plc:bot"
+		c.Credentials.ServiceEndpoint = srv.URL
+
+		p, err := c.UpdateProfile(context.Background(), func(p *api.Profile) error {
+			p.Description = "about"
+			return nil
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(swaps) != 2 || swaps[0] != "bafy1" || swaps[1] != "bafy2" {
+			t.Errorf("expected swaps against each read, got %v", swaps)
+		}
+
+		if p.DisplayName != "v2" || p.Description != "about" {
+			t.Errorf("expected the edit on the fresh copy, got %+v", p)
+		}
+	})
+
+	t.Run("display name too long", func(t *testing.T) {
+		p := api.Profile{DisplayName: strings.Repeat("a", api.MaxDisplayName+1)}
+
+		if err := p.Validate(); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
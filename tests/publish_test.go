@@ -0,0 +1,306 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/desertthunder/quotesky/lib/api"
+	"github.com/desertthunder/quotesky/lib/publish"
+)
+
+// Mastodon API stub recording the statuses it was sent
+//
+// Like the real API, a status repeating an earlier idempotency key isn't
+// posted again.
+func mastodonServer(t *testing.T, statuses *[]map[string]any, deleted *[]string) string {
+	mu := sync.Mutex{}
+	keys := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":"The access token is invalid"}`)
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v1/statuses":
+			if id, ok := keys[r.Header.Get("Idempotency-Key")]; ok {
+				fmt.Fprintf(w, `{"id":"%d","url":"https://masto.test/@bot/%d"}`, id, id)
+				return
+			}
+
+			s := map[string]any{}
+			json.NewDecoder(r.Body).Decode(&s)
+			s["idempotency"] = r.Header.Get("Idempotency-Key")
+			*statuses = append(*statuses, s)
+
+			id := len(*statuses)
+			keys[r.Header.Get("Idempotency-Key")] = id
+			fmt.Fprintf(w, `{"id":"%d","url":"https://masto.test/@bot/%d"}`, id, id)
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/api/v1/statuses/"):
+			*deleted = append(*deleted, strings.TrimPrefix(r.URL.Path, "/api/v1/statuses/"))
+			fmt.Fprint(w, `{}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	t.Cleanup(srv.Close)
+
+	return srv.URL
+}
+
+// Transport dropping the connection after n requests
+type dropAfter struct {
+	n int
+}
+
+func (d *dropAfter) RoundTrip(r *http.Request) (*http.Response, error) {
+	if d.n == 0 {
+		return nil, errors.New("connection reset")
+	}
+
+	d.n--
+
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+// Clients by DID
+type accounts map[string]*api.Client
+
+func (a accounts) Client(_ context.Context, account string) (*api.Client, error) {
+	if c, ok := a[account]; ok {
+		return c, nil
+	}
+
+	return nil, fmt.Errorf("unknown account %q", account)
+}
+
+type failing struct{}
+
+func (failing) Publish(context.Context, api.Message) (*publish.Result, error) {
+	return nil, errors.New("unreachable")
+}
+
+func (failing) Delete(context.Context, string) error { return nil }
+
+func (failing) Capabilities() publish.Capabilities { return publish.Capabilities{} }
+
+func TestPublishers(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("mastodon threads long messages as replies", func(t *testing.T) {
+		statuses, deleted := []map[string]any{}, []string{}
+		m := publish.NewMastodon(mastodonServer(t, &statuses, &deleted), "secret")
+
+		res, err := m.Publish(ctx, api.Message{
+			Content: strings.Repeat("word ", 120),
+			Rkey:    "3kabc",
+			Langs:   []string{"en-US"},
+			Labels:  []string{"graphic-media"},
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.ID != "1" || res.URL != "https://masto.test/@bot/1" {
+			t.Errorf("unexpected result %+v", res)
+		}
+
+		if len(statuses) != 2 {
+			t.Fatalf("expected 2 statuses, got %v", statuses)
+		}
+
+		if statuses[1]["in_reply_to_id"] != "1" || statuses[0]["in_reply_to_id"] != nil {
+			t.Errorf("expected a reply chain, got %v", statuses)
+		}
+
+		for _, s := range statuses {
+			if text := s["status"].(string); !strings.HasPrefix(text, "word") ||
+				!strings.HasSuffix(text, "/2)") || len(text) > publish.MastodonMaxLength {
+				t.Errorf("expected a numbered part without a timestamp, got %q", text)
+			}
+		}
+
+		first := statuses[0]
+
+		if first["language"] != "en" || first["sensitive"] != true ||
+			first["spoiler_text"] != "graphic-media" || first["idempotency"] != "3kabc-0" {
+			t.Errorf("unexpected status %v", first)
+		}
+
+		if err := m.Delete(ctx, "1"); err != nil || len(deleted) != 1 || deleted[0] != "1" {
+			t.Errorf("expected status 1 to be deleted, got %v %v", err, deleted)
+		}
+	})
+
+	t.Run("mastodon fits more in a status than bluesky does in a post", func(t *testing.T) {
+		statuses, deleted := []map[string]any{}, []string{}
+		m := publish.NewMastodon(mastodonServer(t, &statuses, &deleted), "secret")
+		content := strings.Repeat("word ", 80)
+
+		if _, err := m.Publish(ctx, api.Message{Content: content}); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(statuses) != 1 || statuses[0]["status"] != content {
+			t.Errorf("expected the message as a single status, got %v", statuses)
+		}
+
+		if n := len(api.BuildThread(api.Message{Content: content}, api.MaxPostLength)); n != 2 {
+			t.Errorf("expected bluesky to need 2 posts, got %d", n)
+		}
+	})
+
+	t.Run("mastodon keeps the statuses posted before a failure", func(t *testing.T) {
+		statuses, deleted := []map[string]any{}, []string{}
+		m := publish.NewMastodon(mastodonServer(t, &statuses, &deleted), "secret")
+		msg := api.Message{Content: strings.Repeat("word ", 120)}
+		m.HTTP = &http.Client{Transport: &dropAfter{n: 1}}
+
+		res, err := m.Publish(ctx, msg)
+
+		if err == nil || res == nil || res.ID != "1" {
+			t.Fatalf("expected status 1 with an error, got %+v %v", res, err)
+		}
+
+		m.HTTP = http.DefaultClient
+		res, err = m.Publish(ctx, msg)
+
+		if err != nil || res.ID != "1" {
+			t.Fatalf("expected the retry to continue status 1, got %+v %v", res, err)
+		}
+
+		if len(statuses) != 2 || statuses[1]["in_reply_to_id"] != "1" {
+			t.Errorf("expected the second part once, got %v", statuses)
+		}
+
+		key := statuses[0]["idempotency"].(string)
+
+		if len(key) < 16 || !strings.HasSuffix(key, "-0") {
+			t.Errorf("expected a derived idempotency key, got %q", key)
+		}
+	})
+
+	t.Run("bluesky deletes as the post's account", func(t *testing.T) {
+		bot, _ := fakeClient(`{"commit":{"cid":"bafyc","rev":"r"},"results":[]}`)
+		other, f := fakeClient(`{"commit":{"cid":"bafyc","rev":"r"},"results":[]}`)
+		other.Credentials.DID = "did:plc:other"
+		b := publish.NewBluesky(accounts{"": bot, "did:plc:bot": bot, "did:plc:other": other})
+
+		if err := b.Delete(ctx, "at://did:plc:other/app.bsky.feed.post/3kpost"); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(f.requests) != 1 {
+			t.Errorf("expected the other account to delete, got %d requests", len(f.requests))
+		}
+
+		if err := b.Delete(ctx, "not an at-uri"); err == nil {
+			t.Error("expected an invalid uri error")
+		}
+	})
+
+	t.Run("mastodon reports api errors", func(t *testing.T) {
+		statuses, deleted := []map[string]any{}, []string{}
+		m := publish.NewMastodon(mastodonServer(t, &statuses, &deleted), "wrong")
+
+		_, err := m.Publish(ctx, api.Message{Content: "hello"})
+
+		if err == nil || !strings.Contains(err.Error(), "access token is invalid") {
+			t.Errorf("expected an auth error, got %v", err)
+		}
+	})
+
+	t.Run("jsonl appends entries and tombstones", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "posts.jsonl")
+		j := publish.NewJSONL(path)
+
+		res, err := j.Publish(ctx, api.Message{Content: "hello", Rkey: "3kabc"})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := j.Delete(ctx, res.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := os.ReadFile(path)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+
+		if len(lines) != 2 {
+			t.Fatalf("expected 2 lines, got %s", data)
+		}
+
+		entries := make([]publish.Entry, 2)
+
+		for i, l := range lines {
+			if err := json.Unmarshal([]byte(l), &entries[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if entries[0].ID != "3kabc" || len(entries[0].Records) != 1 ||
+			!strings.HasPrefix(entries[0].Records[0].Text, "hello") {
+			t.Errorf("unexpected entry %+v", entries[0])
+		}
+
+		if entries[1].ID != "3kabc" || entries[1].DeletedAt == "" {
+			t.Errorf("expected a tombstone, got %+v", entries[1])
+		}
+	})
+
+	t.Run("fan out reports every destination", func(t *testing.T) {
+		out := strings.Builder{}
+		dests := []publish.Destination{
+			{Name: "stdout", Publisher: publish.NewStdout(&out)},
+			{Name: "broken", Publisher: failing{}},
+		}
+
+		results := publish.FanOut(ctx, dests, api.Message{Content: "hello"})
+
+		if len(results) != 2 || results[0].Destination != "stdout" || results[0].Err != nil {
+			t.Fatalf("unexpected results %+v", results)
+		}
+
+		if results[1].Destination != "broken" || results[1].Err == nil {
+			t.Errorf("expected the broken destination to fail, got %+v", results[1])
+		}
+
+		if !strings.Contains(out.String(), `"$type": "app.bsky.feed.post"`) {
+			t.Errorf("expected the record on stdout, got %s", out.String())
+		}
+	})
+
+	t.Run("select destinations by name", func(t *testing.T) {
+		dests := []publish.Destination{{Name: "stdout"}, {Name: "jsonl"}}
+
+		if got, err := publish.Select(dests, []string{"jsonl"}); err != nil ||
+			len(got) != 1 || got[0].Name != "jsonl" {
+			t.Errorf("unexpected selection %v %v", got, err)
+		}
+
+		if _, err := publish.Select(dests, []string{"mastodon"}); err == nil {
+			t.Error("expected an unknown destination error")
+		}
+	})
+}
@@ -0,0 +1,204 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/desertthunder/quotesky/cmd/server"
+	"github.com/desertthunder/quotesky/lib/db"
+)
+
+func TestParseMention(t *testing.T) {
+	cases := []struct {
+		text string
+		term string
+		ok   bool
+	}{
+		{"@bot.test !quote stoicism", "stoicism", true},
+		{"@bot.test !QUOTE", "", true},
+		{"hey @bot.test, got a quote about courage?", "courage", true},
+		{"@bot.test !quote \"grace\"!\nthanks", "grace", true},
+		{"@bot.test quote about  #resilience", "#resilience", true},
+		{"@bot.test nice quote!", "", false},
+		{"@bot.test misquote about things", "", false},
+		{"", "", false},
+	}
+
+	for _, c := range cases {
+		term, ok := server.ParseMention(c.text)
+
+		if term != c.term || ok != c.ok {
+			t.Errorf("ParseMention(%q) = %q, %v, want %q, %v", c.text, term, ok, c.term, c.ok)
+		}
+	}
+}
+
+func TestParseQuote(t *testing.T) {
+	cases := []struct {
+		arg  string
+		want db.Quote
+		err  bool
+	}{
+		{arg: "be kind", want: db.Quote{Text: "be kind"}},
+		{arg: " be kind | Plato ", want: db.Quote{Text: "be kind", Author: "Plato"}},
+		{
+			arg: "be kind | Plato | kindness,ethics | en, fr | sexual",
+			want: db.Quote{
+				Text: "be kind", Author: "Plato", Tags: []string{"kindness", "ethics"},
+				Langs: []string{"en", "fr"}, Labels: []string{"sexual"},
+			},
+		},
+		{arg: "be kind | Plato | a | b | c | with | pipes", err: true},
+		{arg: "   | Plato", err: true},
+		{arg: "be kind | | | not a language tag!", err: true},
+		{arg: "be kind | | | en | spoilers", err: true},
+	}
+
+	for _, c := range cases {
+		q, err := server.ParseQuote(c.arg)
+
+		if (err != nil) != c.err {
+			t.Errorf("ParseQuote(%q) error = %v", c.arg, err)
+			continue
+		}
+
+		if c.err {
+			continue
+		}
+
+		if q.Text != c.want.Text || q.Author != c.want.Author ||
+			strings.Join(q.Tags, ",") != strings.Join(c.want.Tags, ",") ||
+			strings.Join(q.Langs, ",") != strings.Join(c.want.Langs, ",") ||
+			strings.Join(q.Labels, ",") != strings.Join(c.want.Labels, ",") {
+			t.Errorf("ParseQuote(%q) = %+v, want %+v", c.arg, q, c.want)
+		}
+	}
+}
+
+func TestQuoteRepository(t *testing.T) {
+	migrated(t)
+
+	r := db.InitQuoteRepo(false)
+
+	t.Run("random with no quotes", func(t *testing.T) {
+		if _, err := r.Random(""); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("expected sql.ErrNoRows, got %v", err)
+		}
+	})
+
+	quotes := []db.Quote{
+		{Text: "The obstacle is the way", Author: "Marcus Aurelius", Tags: []string{"Stoicism"}},
+		{Text: "Courage is grace under pressure", Author: "Hemingway"},
+		{Text: "Know thyself", Tags: []string{"#philosophy"}},
+	}
+
+	for _, q := range quotes {
+		if _, err := r.Add(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		term string
+		want string
+	}{
+		{"stoicism", "The obstacle is the way"},
+		{"#STOICISM", "The obstacle is the way"},
+		{"GRACE", "Courage is grace under pressure"},
+		{"hemingway", "Courage is grace under pressure"},
+		{"#philosophy", "Know thyself"},
+	}
+
+	for _, c := range cases {
+		t.Run("random about "+c.term, func(t *testing.T) {
+			q, err := r.Random(c.term)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if q.Text != c.want {
+				t.Errorf("expected %q, got %q", c.want, q.Text)
+			}
+		})
+	}
+
+	t.Run("random without a match", func(t *testing.T) {
+		if _, err := r.Random("nihilism"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("expected sql.ErrNoRows, got %v", err)
+		}
+	})
+
+	t.Run("random without a term picks any quote", func(t *testing.T) {
+		seen := map[string]bool{}
+
+		for i := 0; i < 100; i++ {
+			q, err := r.Random("")
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			seen[q.Text] = true
+		}
+
+		if len(seen) != len(quotes) {
+			t.Errorf("expected every quote to come up, got %d", len(seen))
+		}
+	})
+}
+
+func TestQuoteCommands(t *testing.T) {
+	migrated(t)
+
+	c := server.NewCommands(nil, false)
+	ctx := context.Background()
+
+	steps := []struct {
+		line string
+		want string
+		err  string
+	}{
+		{line: "QUOTE:GET", err: "no quotes yet"},
+		{line: "QUOTE:ADD Know thyself | Socrates | philosophy", want: "OK 1"},
+		{line: "QUOTE:ADD The obstacle is the way | Marcus Aurelius", want: "OK 2"},
+		{line: "QUOTE:ADD  | nobody", err: "quote text is empty"},
+		{line: "QUOTE:GET philosophy", want: "Know thyself — Socrates"},
+		{line: "QUOTE:GET obstacle", want: "The obstacle is the way — Marcus Aurelius"},
+		{line: "quote:get obstacle", err: "unknown command quote:get"},
+		{line: "QUOTE:GET courage", err: "no quotes about courage"},
+		{line: "QUOTE:UPDATE 2 The impediment to action advances action | Marcus Aurelius",
+			want: "OK 2"},
+		{line: "QUOTE:UPDATE two words", err: `expected a quote id, got "two"`},
+		{line: "QUOTE:UPDATE 9 Ghost", err: "no quote with id 9"},
+		{line: "QUOTE:LIST",
+			want: "1: Know thyself — Socrates\n" +
+				"2: The impediment to action advances action — Marcus Aurelius"},
+		{line: "QUOTE:REMOVE 1", want: "OK 1"},
+		{line: "QUOTE:REMOVE 1", err: "no quote with id 1"},
+		{line: "QUOTE:LIST",
+			want: "2: The impediment to action advances action — Marcus Aurelius"},
+		{line: "QUOTE:SHUFFLE", err: "unknown command QUOTE:SHUFFLE"},
+	}
+
+	for _, s := range steps {
+		got, err := c.Handle(ctx, "", s.line)
+
+		if s.err != "" {
+			if err == nil || err.Error() != s.err {
+				t.Errorf("%s: expected error %q, got %v", s.line, s.err, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %s", s.line, err.Error())
+		} else if got != s.want {
+			t.Errorf("%s: expected %q, got %q", s.line, s.want, got)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/desertthunder/quotesky/lib/api"
+)
+
+func TestRateLimit(t *testing.T) {
+	t.Run("parse headers", func(t *testing.T) {
+		reset := time.Now().Add(time.Minute).Unix()
+		h := http.Header{}
+		h.Set("RateLimit-Limit", "100")
+		h.Set("RateLimit-Remaining", "42")
+		h.Set("RateLimit-Reset", fmt.Sprint(reset))
+
+		rl, ok := api.ParseRateLimit(h)
+
+		if !ok {
+			t.Fatal("expected headers to parse")
+		}
+
+		if rl.Limit != 100 || rl.Remaining != 42 || rl.Reset.Unix() != reset {
+			t.Errorf("unexpected rate limit %+v", rl)
+		}
+	})
+
+	t.Run("missing headers", func(t *testing.T) {
+		if _, ok := api.ParseRateLimit(http.Header{}); ok {
+			t.Error("expected missing headers to fail")
+		}
+	})
+
+	t.Run("retries server errors", func(t *testing.T) {
+		calls := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+
+			if calls == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+
+			fmt.Fprint(w, `{"handle":"bot.test","did":"did:plc:bot","didDoc":{"service":[`+
+				`{"id":"#atproto_pds","serviceEndpoint":"https://pds.test"}]}}`)
+		}))
+		defer srv.Close()
+
+		c := api.Init(srv.URL, false)
+		s, err := c.CreateSession(context.Background())
+
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+
+		if calls != 2 || s.Handle != "bot.test" {
+			t.Errorf("expected a retried session, got %d calls", calls)
+		}
+	})
+}
+
+// App view answering every request with status and the given rate limit
+//
+// The time of each request is kept in times.
+type limitedServer struct {
+	status    int
+	remaining int
+	reset     time.Time
+	times     []time.Time
+	mu        sync.Mutex
+}
+
+func (l *limitedServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.times = append(l.times, time.Now())
+
+	w.Header().Set("RateLimit-Limit", "100")
+	w.Header().Set("RateLimit-Remaining", fmt.Sprint(l.remaining))
+	w.Header().Set("RateLimit-Reset", fmt.Sprint(l.reset.Unix()))
+	w.WriteHeader(l.status)
+	fmt.Fprint(w, `{"did":"did:plc:bot","handle":"bot.test"}`)
+}
+
+func limitedClient(t *testing.T, l *limitedServer) *api.Client {
+	srv := httptest.NewServer(l)
+	t.Cleanup(srv.Close)
+
+	c := api.Init(srv.URL, false)
+	c.Credentials.AccessToken = "token"
+	c.Credentials.ServiceEndpoint = srv.URL
+	c.Limiter = api.NewLimiter(time.Millisecond)
+
+	return c
+}
+
+func TestLimiter(t *testing.T) {
+	// Resets are sent in whole seconds, so they fall one to two seconds out
+	soon := func() time.Time { return time.Unix(time.Now().Add(2*time.Second).Unix(), 0) }
+
+	t.Run("spreads a low remaining budget until the reset", func(t *testing.T) {
+		l := &limitedServer{status: http.StatusOK, remaining: 2, reset: soon()}
+		c := limitedClient(t, l)
+
+		for i := 0; i < 3; i++ {
+			if _, err := c.GetSession(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// The second request is the first to know the budget, the third waits
+		// for half of what is left of the window
+		want := l.reset.Sub(l.times[1]) / 2
+		gap := l.times[2].Sub(l.times[1])
+
+		if gap < want-100*time.Millisecond || gap > want+250*time.Millisecond {
+			t.Errorf("expected the third request to wait about %s, got %s", want, gap)
+		}
+	})
+
+	t.Run("waits for the reset after too many requests", func(t *testing.T) {
+		l := &limitedServer{status: http.StatusTooManyRequests, reset: soon()}
+		c := limitedClient(t, l)
+		c.MaxRetries = 1
+
+		c.GetSession(context.Background())
+
+		if len(l.times) != 2 {
+			t.Fatalf("expected a single retry, got %d requests", len(l.times))
+		}
+
+		if l.times[1].Before(l.reset) {
+			t.Errorf("expected the retry after %s, got %s", l.reset, l.times[1])
+		}
+	})
+
+	t.Run("gives up when the deadline comes before the next slot", func(t *testing.T) {
+		l := &limitedServer{status: http.StatusTooManyRequests, reset: time.Now().Add(time.Hour)}
+		c := limitedClient(t, l)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		start := time.Now()
+		_, err := c.GetSession(ctx)
+
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the deadline to be exceeded, got %v", err)
+		}
+
+		if d := time.Since(start); d > time.Second || len(l.times) != 1 {
+			t.Errorf("expected an early return, waited %s for %d requests", d, len(l.times))
+		}
+
+		if _, err := c.GetSession(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the limiter to hold back new requests, got %v", err)
+		}
+
+		if len(l.times) != 1 {
+			t.Errorf("expected no further requests, got %d", len(l.times))
+		}
+	})
+}
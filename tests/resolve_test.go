@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/desertthunder/quotesky/lib/api"
+)
+
+const plcDoc string = `{"id":"did:plc:bot","service":[
+	{"id":"#bsky_chat","type":"BskyChatService","serviceEndpoint":"https://chat.test"},
+	{"id":"#atproto_pds","type":"AtprotoPersonalDataServer","serviceEndpoint":"https://pds.test"}
+]}`
+
+func TestResolver(t *testing.T) {
+	t.Run("did:plc through a local directory", func(t *testing.T) {
+		hits := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits++
+
+			if r.URL.Path != "/did:plc:bot" {
+				http.NotFound(w, r)
+				return
+			}
+
+			fmt.Fprint(w, plcDoc)
+		}))
+		defer srv.Close()
+
+		r := api.NewResolver(srv.URL, nil)
+
+		for i := 0; i < 2; i++ {
+			endpoint, err := r.PDSEndpoint(context.Background(), "did:plc:bot")
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if endpoint != "https://pds.test" {
+				t.Errorf("expected the #atproto_pds entry, got %s", endpoint)
+			}
+		}
+
+		if hits != 1 {
+			t.Errorf("expected cached lookup, got %d requests", hits)
+		}
+	})
+
+	t.Run("missing pds service", func(t *testing.T) {
+		s := api.Session{DidDoc: api.DidDoc{ID: "did:plc:bot"}}
+
+		if s.GetServiceEndpoint() != "" {
+			t.Error("expected no endpoint")
+		}
+	})
+
+	t.Run("did:web", func(t *testing.T) {
+		did := ""
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/.well-known/did.json" {
+				http.NotFound(w, r)
+				return
+			}
+
+			fmt.Fprintf(w, `{"id":"%s","service":[`+
+				`{"id":"%s#atproto_pds","serviceEndpoint":"http://pds.local"}]}`, did, did)
+		}))
+		defer srv.Close()
+
+		u, _ := url.Parse(srv.URL)
+		did = fmt.Sprintf("did:web:localhost%%3A%s", u.Port())
+		endpoint, err := api.NewResolver("", nil).PDSEndpoint(context.Background(), did)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if endpoint != "http://pds.local" {
+			t.Errorf("unexpected endpoint %s", endpoint)
+		}
+	})
+
+	t.Run("did:web subdomains of localhost use https", func(t *testing.T) {
+		for _, did := range []string{
+			"did:web:localhost.attacker.example",
+			"did:web:localhost.attacker.example%3A8080",
+		} {
+			f := &refusingTransport{}
+			r := api.NewResolver("", &http.Client{Transport: f})
+
+			if _, err := r.PDSEndpoint(context.Background(), did); err == nil {
+				t.Errorf("%s: expected an error", did)
+			}
+
+			want := []string{"https://localhost.attacker.example/.well-known/did.json"}
+
+			if strings.Contains(did, "%3A") {
+				want = nil
+			}
+
+			if strings.Join(f.urls, " ") != strings.Join(want, " ") {
+				t.Errorf("%s: expected requests to %v, got %v", did, want, f.urls)
+			}
+		}
+	})
+}
+
+// Transport noting the URL of each request and refusing it
+type refusingTransport struct {
+	urls []string
+}
+
+func (f *refusingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	f.urls = append(f.urls, r.URL.String())
+
+	return nil, fmt.Errorf("refused %s", r.URL)
+}
@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/desertthunder/quotesky/lib/db"
+)
+
+func TestSecrets(t *testing.T) {
+	t.Run("passphrase round trip", func(t *testing.T) {
+		c, err := db.PassphraseCipher("correct horse")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sealed, err := c.Seal("abcd-efgh-ijkl-mnop")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !db.IsSealed(sealed) || strings.Contains(sealed, "abcd") {
+			t.Fatalf("expected ciphertext, got %s", sealed)
+		}
+
+		plain, err := c.Open(sealed)
+
+		if err != nil || plain != "abcd-efgh-ijkl-mnop" {
+			t.Errorf("expected the original value, got %q (%v)", plain, err)
+		}
+
+		other, _ := db.PassphraseCipher("battery staple")
+
+		if _, err := other.Open(sealed); err == nil {
+			t.Error("expected the wrong passphrase to fail")
+		}
+	})
+
+	t.Run("key file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "key")
+
+		if err := db.GenerateKeyFile(path); err != nil {
+			t.Fatal(err)
+		}
+
+		a, err := db.KeyFileCipher(path)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, _ := db.KeyFileCipher(path)
+		sealed, _ := a.Seal("token")
+
+		if plain, err := b.Open(sealed); err != nil || plain != "token" {
+			t.Errorf("expected the same key to open the value, got %q (%v)", plain, err)
+		}
+	})
+}
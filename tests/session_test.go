@@ -0,0 +1,202 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/desertthunder/quotesky/lib/api"
+)
+
+// Transport for an account whose access tokens expire
+//
+// Only the tokens in valid are accepted, refreshing trades the refresh token
+// for "refreshed" unless rejectRefresh is set, and signing in issues "fresh".
+type expiringTransport struct {
+	valid         map[string]bool
+	rejectRefresh bool
+	calls         []string
+	mu            sync.Mutex
+}
+
+func (f *expiringTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	nsid := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	f.calls = append(f.calls, nsid)
+
+	status, body := http.StatusOK, ""
+	expired := `{"error":"ExpiredToken","message":"Token has expired"}`
+
+	switch {
+	case nsid == "com.atproto.server.createSession":
+		body = expiringSession("fresh")
+		f.valid["fresh"] = true
+	case nsid == "com.atproto.server.refreshSession" && !f.rejectRefresh && token == "refresh":
+		body = expiringSession("refreshed")
+		f.valid["refreshed"] = true
+	case nsid == "com.atproto.server.refreshSession", !f.valid[token]:
+		status, body = http.StatusBadRequest, expired
+	default:
+		body = `{"did":"did:plc:bot","handle":"bot.test","active":true}`
+	}
+
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    r,
+	}, nil
+}
+
+func expiringSession(token string) string {
+	return fmt.Sprintf(`{"accessJwt":%q,"refreshJwt":"%s-refresh","did":"did:plc:bot",`+
+		`"didDoc":{"id":"did:plc:bot","service":[{"id":"#atproto_pds",`+
+		`"type":"AtprotoPersonalDataServer","serviceEndpoint":"https://pds.test"}]}}`,
+		token, token)
+}
+
+func expiringClient(f *expiringTransport) (*api.Client, *[]api.Session) {
+	c, _ := fakeClient(`{}`)
+	c.HTTP = &http.Client{Transport: f}
+	c.Credentials.Handle = "bot.test"
+	c.Credentials.Password = "hunter2"
+	c.Credentials.AccessToken = "stale"
+	c.Credentials.RefreshToken = "refresh"
+
+	stored := []api.Session{}
+	c.OnSession = func(s api.Session) { stored = append(stored, s) }
+
+	return c, &stored
+}
+
+func TestExpiredSessions(t *testing.T) {
+	t.Run("refreshes and retries", func(t *testing.T) {
+		f := &expiringTransport{valid: map[string]bool{}}
+		c, stored := expiringClient(f)
+
+		if _, err := c.GetSession(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		want := []string{
+			"com.atproto.server.getSession",
+			"com.atproto.server.refreshSession",
+			"com.atproto.server.getSession",
+		}
+
+		if strings.Join(f.calls, " ") != strings.Join(want, " ") {
+			t.Errorf("unexpected calls %v", f.calls)
+		}
+
+		if c.Credentials.AccessToken != "refreshed" {
+			t.Errorf("expected the refreshed token, got %s", c.Credentials.AccessToken)
+		}
+
+		if len(*stored) != 1 || (*stored)[0].RefreshJwt != "refreshed-refresh" {
+			t.Errorf("expected the new tokens to be stored, got %+v", *stored)
+		}
+	})
+
+	t.Run("signs in again when the refresh token is rejected", func(t *testing.T) {
+		f := &expiringTransport{valid: map[string]bool{}, rejectRefresh: true}
+		c, stored := expiringClient(f)
+
+		if _, err := c.GetSession(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		if f.calls[2] != "com.atproto.server.createSession" {
+			t.Errorf("expected a new session, got %v", f.calls)
+		}
+
+		if c.Credentials.AccessToken != "fresh" || len(*stored) != 1 {
+			t.Errorf("expected the new session to be stored, got %s", c.Credentials.AccessToken)
+		}
+	})
+
+	t.Run("downloads and uploads renew the session too", func(t *testing.T) {
+		f := &expiringTransport{valid: map[string]bool{}}
+		c, _ := expiringClient(f)
+
+		if _, err := c.GetRepo(context.Background(), "did:plc:bot"); err != nil {
+			t.Fatal(err)
+		}
+
+		f.valid = map[string]bool{}
+
+		if _, err := c.UploadBlob(context.Background(), []byte("GIF89a"), ""); err != nil {
+			t.Fatal(err)
+		}
+
+		want := []string{
+			"com.atproto.sync.getRepo",
+			"com.atproto.server.refreshSession",
+			"com.atproto.sync.getRepo",
+			"com.atproto.repo.uploadBlob",
+			"com.atproto.server.refreshSession",
+			"com.atproto.server.createSession",
+			"com.atproto.repo.uploadBlob",
+		}
+
+		if strings.Join(f.calls, " ") != strings.Join(want, " ") {
+			t.Errorf("unexpected calls %v", f.calls)
+		}
+	})
+
+	t.Run("concurrent requests share one renewal", func(t *testing.T) {
+		f := &expiringTransport{valid: map[string]bool{}}
+		c, stored := expiringClient(f)
+		wg := sync.WaitGroup{}
+		errs := make(chan error, 8)
+
+		for i := 0; i < cap(errs); i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				_, err := c.GetSession(context.Background())
+				errs <- err
+			}()
+		}
+
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			if err != nil {
+				t.Error(err)
+			}
+		}
+
+		refreshes := strings.Count(strings.Join(f.calls, " "), "refreshSession")
+
+		if refreshes != 1 || len(*stored) != 1 {
+			t.Errorf("expected one renewal, got %d refreshes, %d stored", refreshes, len(*stored))
+		}
+
+		if access, _ := c.Credentials.Tokens(); access != "refreshed" {
+			t.Errorf("expected the refreshed token, got %s", access)
+		}
+	})
+
+	t.Run("valid tokens are left alone", func(t *testing.T) {
+		f := &expiringTransport{valid: map[string]bool{"stale": true}}
+		c, stored := expiringClient(f)
+
+		if _, err := c.GetSession(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(f.calls) != 1 || len(*stored) != 0 {
+			t.Errorf("expected a single call, got %v", f.calls)
+		}
+	})
+}
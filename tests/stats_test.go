@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/desertthunder/quotesky/lib/db"
+)
+
+func TestBuildReport(t *testing.T) {
+	monday := time.Date(2026, 10, 19, 9, 0, 0, 0, time.Local)
+	tuesday := time.Date(2026, 10, 20, 18, 0, 0, 0, time.Local)
+
+	posts := []db.HistoryPost{
+		{ID: 1, Text: "courage", QuoteID: 1, QuoteText: "courage, edited",
+			Tags: []string{"stoic"}, PostedAt: monday},
+		{ID: 2, Text: "courage", QuoteID: 1, QuoteText: "courage, edited",
+			Tags: []string{"stoic"}, PostedAt: tuesday},
+		{ID: 3, Text: "patience", QuoteID: 2, QuoteText: "patience",
+			Tags: []string{"zen"}, PostedAt: tuesday},
+		{ID: 4, Text: "never collected", PostedAt: monday},
+	}
+
+	snap := func(id int, likes int, at time.Time, hours int) db.Snapshot {
+		return db.Snapshot{
+			PostID:      id,
+			Metrics:     db.Metrics{Likes: likes},
+			CollectedAt: at.Add(time.Duration(hours) * time.Hour),
+		}
+	}
+
+	snaps := []db.Snapshot{
+		snap(1, 5, monday, 1),
+		snap(1, 10, monday, 24),
+		snap(2, 2, tuesday, 24),
+		snap(3, 0, tuesday, 24),
+	}
+
+	r := db.BuildReport(posts, snaps, 1)
+
+	if r.Posts != 3 {
+		t.Errorf("expected 3 posts with data, got %d", r.Posts)
+	}
+
+	if len(r.TopQuotes) != 1 || r.TopQuotes[0].Key != "courage, edited" ||
+		r.TopQuotes[0].QuoteID != 1 {
+		t.Fatalf("unexpected top quotes %+v", r.TopQuotes)
+	}
+
+	if r.TopQuotes[0].Posts != 2 || r.TopQuotes[0].Engagement != 6 {
+		t.Errorf("expected courage to average 6 over 2 posts, got %+v", r.TopQuotes[0])
+	}
+
+	if r.Hours[0].Key != "09:00" || r.Weekdays[0].Key != "Monday" {
+		t.Errorf("expected 09:00 on Monday first, got %+v %+v", r.Hours, r.Weekdays)
+	}
+
+	if r.Tags[0].Key != "#stoic" {
+		t.Errorf("unexpected tags %+v", r.Tags)
+	}
+
+	// Post 1 had half its likes after the first hour, post 2 none yet
+	if r.Decay[0].Hours != 1 || r.Decay[0].Posts != 2 || r.Decay[0].Share != 0.25 {
+		t.Errorf("unexpected first decay point %+v", r.Decay[0])
+	}
+
+	if last := r.Decay[len(r.Decay)-1]; last.Hours != 24 || last.Share != 1 {
+		t.Errorf("unexpected last decay point %+v", last)
+	}
+}
+
+func TestTopQuotes(t *testing.T) {
+	at := time.Date(2026, 10, 19, 9, 0, 0, 0, time.Local)
+
+	posts := []db.HistoryPost{
+		{ID: 1, Text: "same", QuoteID: 1, QuoteText: "same", PostedAt: at},
+		{ID: 2, Text: "same", QuoteID: 2, QuoteText: "same", PostedAt: at},
+		{ID: 3, Text: "posted text", QuoteID: 3, PostedAt: at},
+		{ID: 4, Text: "same", PostedAt: at},
+	}
+
+	snaps := []db.Snapshot{}
+
+	for _, p := range posts {
+		snaps = append(snaps, db.Snapshot{
+			PostID: p.ID, Metrics: db.Metrics{Likes: p.ID}, CollectedAt: at.Add(time.Hour),
+		})
+	}
+
+	r := db.BuildReport(posts, snaps, 0)
+	want := []db.Ranked{
+		{Key: "posted text", Posts: 1, Engagement: 3, QuoteID: 3},
+		{Key: "same", Posts: 1, Engagement: 2, QuoteID: 2},
+		{Key: "same", Posts: 1, Engagement: 1, QuoteID: 1},
+	}
+
+	if !reflect.DeepEqual(r.TopQuotes, want) {
+		t.Errorf("expected %+v, got %+v", want, r.TopQuotes)
+	}
+}
+
+func TestHistoryQuotes(t *testing.T) {
+	migrated(t)
+
+	quotes, history := db.InitQuoteRepo(false), db.InitHistoryRepo(false)
+	id, err := quotes.Add(db.Quote{Text: "Know thyself", Author: "Socrates"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	posted := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+
+	for i, p := range []db.HistoryPost{
+		{URI: "at://did:plc:bot/app.bsky.feed.post/1", Text: "Know thyself — Socrates",
+			QuoteID: id},
+		{URI: "at://did:plc:bot/app.bsky.feed.post/2", Text: "free text"},
+	} {
+		p.Account = "did:plc:bot"
+		p.PostedAt = posted.Add(time.Duration(i) * time.Hour)
+
+		if err := history.Record(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = quotes.Update(db.Quote{ID: id, Text: "Know yourself", Author: "Socrates"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	posts, err := history.Since(posted)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(posts) != 2 || posts[0].QuoteText != "Know yourself" || posts[0].QuoteID != id ||
+		posts[0].Text != "Know thyself — Socrates" || posts[1].QuoteText != "" {
+		t.Errorf("unexpected history %+v", posts)
+	}
+}
@@ -0,0 +1,46 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/desertthunder/quotesky/lib/api"
+)
+
+func TestTID(t *testing.T) {
+	t.Run("encode zero", func(t *testing.T) {
+		if tid := api.EncodeTID(0, 0); tid != "2222222222222" {
+			t.Errorf("expected all twos, got %s", tid)
+		}
+	})
+
+	t.Run("generated ids are valid and sortable", func(t *testing.T) {
+		g := api.NewTIDGenerator()
+		prev := g.Next()
+
+		for i := 0; i < 1000; i++ {
+			next := g.Next()
+
+			if !api.ValidTID(next) {
+				t.Fatalf("invalid tid %s", next)
+			}
+
+			if next <= prev {
+				t.Fatalf("expected %s to sort after %s", next, prev)
+			}
+
+			prev = next
+		}
+	})
+
+	t.Run("validate", func(t *testing.T) {
+		if !api.ValidTID("3jzfcijpj2z2a") {
+			t.Error("expected spec example to be valid")
+		}
+
+		for _, s := range []string{"", "3jzfcijpj2z2", "zjzfcijpj2z2a", "3jzfcijpj2z2A"} {
+			if api.ValidTID(s) {
+				t.Errorf("expected %q to be invalid", s)
+			}
+		}
+	})
+}
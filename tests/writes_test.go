@@ -0,0 +1,193 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/desertthunder/quotesky/lib/api"
+)
+
+// Transport for a repo where every write may already have landed
+//
+// With conflict set, writes are refused as duplicates and getRecord answers
+// with the landed record, whose CID is "landed-" followed by its key. The
+// first failures writes are refused outright, with refusal as the message
+// when set.
+type repoTransport struct {
+	conflict bool
+	failures int
+	refusal  string
+	writes   [][]api.WriteOp
+	created  []api.PostRequest
+	calls    []string
+}
+
+func (f *repoTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	nsid := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	f.calls = append(f.calls, nsid)
+
+	status, body := http.StatusOK, ""
+
+	switch {
+	case nsid == "com.atproto.repo.getRecord":
+		rkey := r.URL.Query().Get("rkey")
+		body = fmt.Sprintf(`{"uri":"at://did:plc:bot/%s/%s","cid":"landed-%s","value":{}}`,
+			r.URL.Query().Get("collection"), rkey, rkey)
+	case f.conflict:
+		status = http.StatusConflict
+		body = `{"error":"RecordAlreadyExists","message":"Record already exists"}`
+	case f.failures > 0:
+		f.failures--
+		status = http.StatusBadRequest
+		body = `{"error":"InvalidRequest","message":"try again later"}`
+
+		if f.refusal != "" {
+			body = fmt.Sprintf(`{"error":"InvalidRequest","message":%q}`, f.refusal)
+		}
+	case nsid == "com.atproto.repo.applyWrites":
+		req := api.ApplyWritesRequest{}
+		data, _ := io.ReadAll(r.Body)
+
+		if err := json.Unmarshal(data, &req); err != nil {
+			return nil, err
+		}
+
+		f.writes = append(f.writes, req.Writes)
+		body = `{"commit":{"cid":"bafyc","rev":"r"},"results":[]}`
+	default:
+		req := api.PostRequest{}
+		data, _ := io.ReadAll(r.Body)
+
+		if err := json.Unmarshal(data, &req); err != nil {
+			return nil, err
+		}
+
+		f.created = append(f.created, req)
+		body = fmt.Sprintf(`{"uri":"at://did:plc:bot/%s/%s","cid":"bafy"}`,
+			req.Collection, req.Rkey)
+	}
+
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    r,
+	}, nil
+}
+
+func repoClient(f *repoTransport) *api.Client {
+	c, _ := fakeClient(`{}`)
+	c.HTTP = &http.Client{Transport: f}
+	c.MaxRetries = 0
+	c.Limiter = nil
+
+	return c
+}
+
+func TestRetries(t *testing.T) {
+	long := api.Message{
+		Content: strings.Repeat("courage is grace under pressure ", 30),
+		Rkey:    "3kthreadroot2",
+	}
+
+	t.Run("retried posts return the landed post", func(t *testing.T) {
+		f := &repoTransport{}
+		c := repoClient(f)
+		m := api.Message{Content: "Know thyself", Rkey: "3kpostroot222"}
+
+		first, err := c.CreatePost(context.Background(), m)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f.conflict = true
+		again, err := c.CreatePost(context.Background(), m)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(f.created) != 1 || f.calls[len(f.calls)-1] != "com.atproto.repo.getRecord" {
+			t.Fatalf("expected the retry to look the post up, got calls %v", f.calls)
+		}
+
+		if again.URI != first.URI || again.Rkey != m.Rkey || again.CID != "landed-"+m.Rkey {
+			t.Errorf("expected the landed post %s, got %+v", first.URI, again)
+		}
+	})
+
+	t.Run("other refusals aren't conflicts", func(t *testing.T) {
+		f := &repoTransport{failures: 1, refusal: "repo already exists in a bad state"}
+		m := api.Message{Content: "Know thyself", Rkey: "3kpostroot222"}
+
+		if _, err := repoClient(f).CreatePost(context.Background(), m); err == nil {
+			t.Error("expected the refusal to be returned")
+		}
+
+		for _, call := range f.calls {
+			if call == "com.atproto.repo.getRecord" {
+				t.Errorf("expected no lookup, got calls %v", f.calls)
+			}
+		}
+	})
+
+	t.Run("retried threads return the landed parts", func(t *testing.T) {
+		f := &repoTransport{}
+		c := repoClient(f)
+
+		first, err := c.CreatePost(context.Background(), long)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f.conflict = true
+		again, err := c.CreatePost(context.Background(), long)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(again.Thread) != len(first.Thread) || len(f.writes) != 1 {
+			t.Fatalf("expected %d parts, got %d", len(first.Thread), len(again.Thread))
+		}
+
+		for i, part := range again.Thread {
+			if part.Rkey != f.writes[0][i].Rkey || part.Rkey != first.Thread[i].Rkey {
+				t.Errorf("part %d retried as %s, first written as %s",
+					i, part.Rkey, f.writes[0][i].Rkey)
+			}
+
+			if part.CID != "landed-"+part.Rkey {
+				t.Errorf("part %d has cid %s, not the landed record's", i, part.CID)
+			}
+		}
+
+		if again.URI != "at://did:plc:bot/app.bsky.feed.post/3kthreadroot2" {
+			t.Errorf("unexpected root %s", again.URI)
+		}
+	})
+
+	t.Run("thread keys follow the root", func(t *testing.T) {
+		f := &repoTransport{}
+		res, err := repoClient(f).CreatePost(context.Background(), long)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		us, clock := api.DecodeTID(long.Rkey)
+
+		for i, part := range res.Thread {
+			if !api.ValidTID(part.Rkey) || part.Rkey != api.EncodeTID(us, clock+uint64(i)) {
+				t.Errorf("part %d has key %s", i, part.Rkey)
+			}
+		}
+	})
+}